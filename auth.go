@@ -0,0 +1,449 @@
+package main
+
+import (
+	"context"
+	"crypto/hmac"
+	crand "crypto/rand"
+	"crypto/sha256"
+	"crypto/subtle"
+	"database/sql"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+	"os"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/gorilla/mux"
+)
+
+// role orders what a caller may do; each role includes the ones below it.
+type role int
+
+const (
+	roleSpectator role = iota
+	rolePlayer
+	roleReferee
+	roleAdmin
+)
+
+func (r role) String() string {
+	switch r {
+	case rolePlayer:
+		return "player"
+	case roleReferee:
+		return "referee"
+	case roleAdmin:
+		return "admin"
+	default:
+		return "spectator"
+	}
+}
+
+func (r role) MarshalJSON() ([]byte, error) { return json.Marshal(r.String()) }
+
+func parseRole(s string) (role, bool) {
+	switch strings.ToLower(strings.TrimSpace(s)) {
+	case "spectator":
+		return roleSpectator, true
+	case "player":
+		return rolePlayer, true
+	case "referee":
+		return roleReferee, true
+	case "admin":
+		return roleAdmin, true
+	}
+	return roleSpectator, false
+}
+
+// identity is the authenticated caller attached to each request.
+type identity struct {
+	Role role `json:"role"`
+	// Stable ID of the player the credential belongs to (player tokens)
+	PlayerID string `json:"player_id,omitempty"`
+	// ID of the API token used (directly or via session)
+	TokenID string `json:"token_id,omitempty"`
+	// "token", "session", "bootstrap", "anonymous" or "disabled"
+	Via string `json:"via"`
+}
+
+type ctxKey int
+
+const identityKey ctxKey = iota
+
+func identityFrom(r *http.Request) identity {
+	if id, ok := r.Context().Value(identityKey).(identity); ok {
+		return id
+	}
+	return identity{Role: roleSpectator, Via: "anonymous"}
+}
+
+// apiToken is an issued credential. Only the SHA-256 of the secret is kept.
+type apiToken struct {
+	ID        string     `json:"id"`
+	Role      role       `json:"role"`
+	PlayerID  string     `json:"player_id,omitempty"`
+	Label     string     `json:"label"`
+	CreatedAt time.Time  `json:"created_at"`
+	RevokedAt *time.Time `json:"revoked_at,omitempty"`
+	hash      string
+}
+
+// tokenStore caches all tokens in memory and writes through to the
+// api_tokens table when the DB is enabled.
+type tokenStore struct {
+	mu     sync.RWMutex
+	byID   map[string]*apiToken
+	byHash map[string]*apiToken
+}
+
+var tokens = &tokenStore{byID: map[string]*apiToken{}, byHash: map[string]*apiToken{}}
+
+func hashToken(secret string) string {
+	sum := sha256.Sum256([]byte(secret))
+	return hex.EncodeToString(sum[:])
+}
+
+func randomHex(n int) string {
+	b := make([]byte, n)
+	if _, err := crand.Read(b); err != nil {
+		panic(fmt.Sprintf("crypto/rand: %v", err))
+	}
+	return hex.EncodeToString(b)
+}
+
+func (ts *tokenStore) put(t *apiToken) {
+	ts.mu.Lock()
+	defer ts.mu.Unlock()
+	ts.byID[t.ID] = t
+	ts.byHash[t.hash] = t
+}
+
+// load reads existing tokens from the DB.
+func (ts *tokenStore) load(ctx context.Context) error {
+	if db == nil {
+		return nil
+	}
+	rows, err := db.sql.QueryContext(ctx, "SELECT id, token_hash, role, player_id, label, created_at, revoked_at FROM api_tokens")
+	if err != nil {
+		return err
+	}
+	defer rows.Close()
+	for rows.Next() {
+		var t apiToken
+		var roleStr string
+		var pid sql.NullInt64
+		var revoked sql.NullTime
+		if err := rows.Scan(&t.ID, &t.hash, &roleStr, &pid, &t.Label, &t.CreatedAt, &revoked); err != nil {
+			return err
+		}
+		t.Role, _ = parseRole(roleStr)
+		if pid.Valid {
+			t.PlayerID = formatPlayerID(pid.Int64)
+		}
+		t.RevokedAt = nullTimePtr(revoked)
+		ts.put(&t)
+	}
+	return rows.Err()
+}
+
+// Issue creates a token and returns it with its secret (shown once).
+func (ts *tokenStore) Issue(ctx context.Context, rl role, playerID, label string) (*apiToken, string, error) {
+	secret := "kott_" + randomHex(24)
+	t := &apiToken{
+		ID:        randomHex(8),
+		Role:      rl,
+		PlayerID:  playerID,
+		Label:     label,
+		CreatedAt: time.Now().UTC(),
+		hash:      hashToken(secret),
+	}
+	if db != nil {
+		var pid any
+		if id, ok := playerRefID(playerID); ok {
+			pid = id
+		}
+		if _, err := db.sql.ExecContext(ctx,
+			"INSERT INTO api_tokens (id, token_hash, role, player_id, label, created_at) VALUES (?,?,?,?,?,?)",
+			t.ID, t.hash, t.Role.String(), pid, t.Label, t.CreatedAt); err != nil {
+			return nil, "", err
+		}
+	}
+	ts.put(t)
+	return t, secret, nil
+}
+
+// Revoke marks the token unusable. Returns false if unknown.
+func (ts *tokenStore) Revoke(ctx context.Context, id string) (bool, error) {
+	ts.mu.RLock()
+	t, ok := ts.byID[id]
+	ts.mu.RUnlock()
+	if !ok {
+		return false, nil
+	}
+	now := time.Now().UTC()
+	if db != nil {
+		if _, err := db.sql.ExecContext(ctx, "UPDATE api_tokens SET revoked_at = ? WHERE id = ? AND revoked_at IS NULL", now, id); err != nil {
+			return true, err
+		}
+	}
+	ts.mu.Lock()
+	if t.RevokedAt == nil {
+		t.RevokedAt = &now
+	}
+	ts.mu.Unlock()
+	return true, nil
+}
+
+// List returns all tokens, newest first.
+func (ts *tokenStore) List() []apiToken {
+	ts.mu.RLock()
+	defer ts.mu.RUnlock()
+	out := make([]apiToken, 0, len(ts.byID))
+	for _, t := range ts.byID {
+		out = append(out, *t)
+	}
+	sort.Slice(out, func(i, j int) bool { return out[i].CreatedAt.After(out[j].CreatedAt) })
+	return out
+}
+
+// lookupSecret returns the live token for a presented secret.
+func (ts *tokenStore) lookupSecret(secret string) (*apiToken, bool) {
+	ts.mu.RLock()
+	defer ts.mu.RUnlock()
+	t, ok := ts.byHash[hashToken(secret)]
+	if !ok || t.RevokedAt != nil {
+		return nil, false
+	}
+	return t, true
+}
+
+// lookupID returns the live token with the given ID.
+func (ts *tokenStore) lookupID(id string) (*apiToken, bool) {
+	ts.mu.RLock()
+	defer ts.mu.RUnlock()
+	t, ok := ts.byID[id]
+	if !ok || t.RevokedAt != nil {
+		return nil, false
+	}
+	return t, true
+}
+
+// authConfig is read once at startup by initAuth.
+var authConfig struct {
+	enabled       bool
+	anonRole      role
+	bootstrap     string
+	sessionSecret []byte
+	sessionTTL    time.Duration
+	secureCookie  bool
+}
+
+const sessionCookie = "kott_session"
+
+// initAuth reads auth settings from the environment and loads tokens.
+func initAuth() {
+	authConfig.enabled = !strings.EqualFold(strings.TrimSpace(os.Getenv("KOTT_AUTH")), "off")
+	authConfig.anonRole = roleSpectator
+	if rl, ok := parseRole(os.Getenv("KOTT_ANON_ROLE")); ok {
+		authConfig.anonRole = rl
+	}
+	authConfig.bootstrap = strings.TrimSpace(os.Getenv("KOTT_ADMIN_TOKEN"))
+	if s := os.Getenv("KOTT_SESSION_SECRET"); s != "" {
+		authConfig.sessionSecret = []byte(s)
+	} else {
+		authConfig.sessionSecret = []byte(randomHex(32))
+		log.Printf("[auth] KOTT_SESSION_SECRET not set; sessions will not survive restarts")
+	}
+	authConfig.sessionTTL = envDuration("KOTT_SESSION_TTL", 12*time.Hour)
+	authConfig.secureCookie = strings.EqualFold(strings.TrimSpace(os.Getenv("KOTT_COOKIE_SECURE")), "true")
+
+	if !authConfig.enabled {
+		log.Printf("[auth] KOTT_AUTH=off; every request is treated as admin")
+		return
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+	if err := tokens.load(ctx); err != nil {
+		log.Printf("[auth] loading tokens failed: %v", err)
+	}
+	if authConfig.bootstrap == "" && len(tokens.List()) == 0 {
+		log.Printf("[auth] no KOTT_ADMIN_TOKEN and no issued tokens; only %s access is available", authConfig.anonRole)
+	}
+}
+
+// presentedToken extracts a bearer token from Authorization or X-API-Token.
+func presentedToken(r *http.Request) string {
+	if h := r.Header.Get("Authorization"); len(h) > 7 && strings.EqualFold(h[:7], "bearer ") {
+		return strings.TrimSpace(h[7:])
+	}
+	return strings.TrimSpace(r.Header.Get("X-API-Token"))
+}
+
+// credentialIdentity maps a presented secret to an identity.
+func credentialIdentity(secret string) (identity, bool) {
+	if authConfig.bootstrap != "" && subtle.ConstantTimeCompare([]byte(secret), []byte(authConfig.bootstrap)) == 1 {
+		return identity{Role: roleAdmin, Via: "bootstrap"}, true
+	}
+	if t, ok := tokens.lookupSecret(secret); ok {
+		return identity{Role: t.Role, PlayerID: t.PlayerID, TokenID: t.ID, Via: "token"}, true
+	}
+	return identity{}, false
+}
+
+// authenticate attaches the caller's identity to the request context. A
+// bad token is rejected outright; no credentials means anonymous.
+func authenticate(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		id := identity{Role: authConfig.anonRole, Via: "anonymous"}
+		switch {
+		case !authConfig.enabled:
+			id = identity{Role: roleAdmin, Via: "disabled"}
+		case presentedToken(r) != "":
+			var ok bool
+			id, ok = credentialIdentity(presentedToken(r))
+			if !ok {
+				writeError(w, http.StatusUnauthorized, "invalid or revoked token")
+				return
+			}
+		default:
+			if c, err := r.Cookie(sessionCookie); err == nil {
+				if sid, ok := verifySession(r.Context(), c.Value); ok {
+					id = sid
+				}
+			}
+		}
+		next.ServeHTTP(w, r.WithContext(context.WithValue(r.Context(), identityKey, id)))
+	})
+}
+
+// actsFor reports whether the caller may act on behalf of the player with
+// the given stable ID: referees act for anyone, players only for themselves.
+func (id identity) actsFor(playerID string) bool {
+	if id.Role >= roleReferee {
+		return true
+	}
+	own, ok := playerRefID(id.PlayerID)
+	if !ok {
+		return false
+	}
+	other, ok := playerRefID(playerID)
+	return ok && directory.canonical(own) == directory.canonical(other)
+}
+
+// routeRoles records the minimum role for each registered route. Routes
+// missing from the table require admin, so a forgotten entry fails closed.
+type routeRoles map[*mux.Route]role
+
+func (rr routeRoles) allow(rt *mux.Route, min role) *mux.Route {
+	rr[rt] = min
+	return rt
+}
+
+// authorize enforces the matched route's minimum role.
+func (rr routeRoles) authorize(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		need := roleAdmin
+		if rt := mux.CurrentRoute(r); rt != nil {
+			if min, ok := rr[rt]; ok {
+				need = min
+			}
+		}
+		id := identityFrom(r)
+		if id.Role < need {
+			if id.Via == "anonymous" {
+				writeError(w, http.StatusUnauthorized, "authentication required")
+				return
+			}
+			writeError(w, http.StatusForbidden, need.String()+" role required")
+			return
+		}
+		next.ServeHTTP(w, r)
+	})
+}
+
+// sessionClaims is the signed payload of the session cookie.
+type sessionClaims struct {
+	TokenID  string `json:"tid,omitempty"`
+	Role     role   `json:"-"`
+	RoleName string `json:"role"`
+	PlayerID string `json:"pid,omitempty"`
+	// PIN fingerprint for sessions opened with a player PIN
+	PIN     string `json:"pin,omitempty"`
+	Expires int64  `json:"exp"`
+}
+
+func signSession(c sessionClaims) string {
+	c.RoleName = c.Role.String()
+	payload, _ := json.Marshal(c)
+	enc := base64.RawURLEncoding.EncodeToString(payload)
+	mac := hmac.New(sha256.New, authConfig.sessionSecret)
+	mac.Write([]byte(enc))
+	return enc + "." + base64.RawURLEncoding.EncodeToString(mac.Sum(nil))
+}
+
+// verifySession checks the signature and expiry, and that the token (or
+// PIN) the session was opened with has not been revoked or changed since.
+func verifySession(ctx context.Context, v string) (identity, bool) {
+	enc, sig, ok := strings.Cut(v, ".")
+	if !ok {
+		return identity{}, false
+	}
+	mac := hmac.New(sha256.New, authConfig.sessionSecret)
+	mac.Write([]byte(enc))
+	want := mac.Sum(nil)
+	got, err := base64.RawURLEncoding.DecodeString(sig)
+	if err != nil || !hmac.Equal(got, want) {
+		return identity{}, false
+	}
+	payload, err := base64.RawURLEncoding.DecodeString(enc)
+	if err != nil {
+		return identity{}, false
+	}
+	var c sessionClaims
+	if err := json.Unmarshal(payload, &c); err != nil {
+		return identity{}, false
+	}
+	if time.Now().Unix() > c.Expires {
+		return identity{}, false
+	}
+	rl, ok := parseRole(c.RoleName)
+	if !ok {
+		return identity{}, false
+	}
+	if c.TokenID != "" {
+		t, ok := tokens.lookupID(c.TokenID)
+		if !ok {
+			return identity{}, false
+		}
+		rl = t.Role
+	}
+	if c.PIN != "" {
+		pid, ok := playerRefID(c.PlayerID)
+		if !ok || pins.Fingerprint(ctx, pid) != c.PIN {
+			return identity{}, false
+		}
+	}
+	return identity{Role: rl, PlayerID: c.PlayerID, TokenID: c.TokenID, Via: "session"}, true
+}
+
+// setSessionCookie opens a signed session for id. pin is the PIN
+// fingerprint for PIN logins, empty otherwise.
+func setSessionCookie(w http.ResponseWriter, r *http.Request, id identity, pin string) time.Time {
+	exp := time.Now().Add(authConfig.sessionTTL)
+	http.SetCookie(w, &http.Cookie{
+		Name:     sessionCookie,
+		Value:    signSession(sessionClaims{TokenID: id.TokenID, Role: id.Role, PlayerID: id.PlayerID, PIN: pin, Expires: exp.Unix()}),
+		Path:     "/",
+		Expires:  exp,
+		HttpOnly: true,
+		Secure:   authConfig.secureCookie || r.TLS != nil,
+		SameSite: http.SameSiteLaxMode,
+	})
+	return exp
+}
@@ -0,0 +1,417 @@
+// Command kott is a command-line client for the kingofthetable API.
+//
+//	kott [-server URL] [-token T] [-o table|json] <command> [args]
+//
+// The server and token default to $KOTT_SERVER (http://localhost:8080) and
+// $KOTT_TOKEN. Run "kott help" for the commands.
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"net/url"
+	"os"
+	"os/signal"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+const usage = `usage: kott [-server URL] [-token T] [-o table|json] <command> [args]
+
+commands:
+  start -players a,b,c,d [-mode balanced|random]
+  start -red f,g -blue f,g [-waiting a,b,...]
+                                 start a game
+  list                           list games
+  show <game>                    show a game's teams and queue
+  watch <game>                   follow a game live
+  queue <game> [player...]       add players to the queue (yourself if none)
+  goal <game> red|blue           record a goal for a team
+  undo <game>                    undo the last action
+  remove <game> [player]         remove a player (yourself if none)
+  players [-query text] [-limit n]
+                                 search players
+  leaderboard [-limit n]         show the leaderboard
+`
+
+// cli holds the global options shared by every command.
+type cli struct {
+	c      *client
+	json   bool
+	out    io.Writer
+	errOut io.Writer
+}
+
+func main() {
+	os.Exit(run(os.Args[1:], os.Stdout, os.Stderr))
+}
+
+func run(args []string, stdout, stderr io.Writer) int {
+	fs := flag.NewFlagSet("kott", flag.ContinueOnError)
+	fs.SetOutput(stderr)
+	fs.Usage = func() { fmt.Fprint(stderr, usage) }
+	server := fs.String("server", envOr("KOTT_SERVER", "http://localhost:8080"), "server base URL")
+	token := fs.String("token", os.Getenv("KOTT_TOKEN"), "API token")
+	output := fs.String("o", "table", "output format: table or json")
+	timeout := fs.Duration("timeout", 10*time.Second, "request timeout")
+	if err := fs.Parse(args); err != nil {
+		return 2
+	}
+	if *output != "table" && *output != "json" {
+		fmt.Fprintln(stderr, "kott: -o must be table or json")
+		return 2
+	}
+	if fs.NArg() == 0 || fs.Arg(0) == "help" {
+		fmt.Fprint(stdout, usage)
+		return 0
+	}
+
+	k := &cli{c: newClient(*server, *token, *timeout), json: *output == "json", out: stdout, errOut: stderr}
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt)
+	defer stop()
+
+	cmd, rest := fs.Arg(0), fs.Args()[1:]
+	commands := map[string]func(context.Context, []string) error{
+		"start":       k.start,
+		"list":        k.list,
+		"show":        k.show,
+		"watch":       k.watch,
+		"queue":       k.queue,
+		"goal":        k.goal,
+		"undo":        k.undo,
+		"remove":      k.remove,
+		"players":     k.players,
+		"leaderboard": k.leaderboard,
+	}
+	fn, ok := commands[cmd]
+	if !ok {
+		fmt.Fprintf(stderr, "kott: unknown command %q\n\n%s", cmd, usage)
+		return 2
+	}
+	if err := fn(ctx, rest); err != nil {
+		var ue usageError
+		if errors.As(err, &ue) {
+			fmt.Fprintf(stderr, "kott %s: %s\n", cmd, ue)
+			return 2
+		}
+		fmt.Fprintf(stderr, "kott %s: %v\n", cmd, err)
+		return 1
+	}
+	return 0
+}
+
+// usageError reports bad command-line arguments (exit status 2).
+type usageError string
+
+func (e usageError) Error() string { return string(e) }
+
+func envOr(key, def string) string {
+	if v := strings.TrimSpace(os.Getenv(key)); v != "" {
+		return v
+	}
+	return def
+}
+
+// splitList splits a comma-separated flag value, dropping blanks.
+func splitList(s string) []string {
+	var out []string
+	for _, p := range strings.Split(s, ",") {
+		if p = strings.TrimSpace(p); p != "" {
+			out = append(out, p)
+		}
+	}
+	return out
+}
+
+// pair parses "forward,goalkeeper".
+func pair(s, flagName string) (team, error) {
+	p := splitList(s)
+	if len(p) != 2 {
+		return team{}, usageError("-" + flagName + " takes forward,goalkeeper")
+	}
+	return team{Forward: p[0], Goalkeeper: p[1]}, nil
+}
+
+// gameArg returns the game ID argument and the remaining ones.
+func gameArg(args []string) (string, []string, error) {
+	if len(args) == 0 || strings.TrimSpace(args[0]) == "" {
+		return "", nil, usageError("game ID required")
+	}
+	return url.PathEscape(args[0]), args[1:], nil
+}
+
+// emit prints the raw reply in JSON mode, or calls table otherwise.
+func (k *cli) emit(raw json.RawMessage, table func()) {
+	if k.json {
+		printJSON(k.out, raw)
+		return
+	}
+	table()
+}
+
+func (k *cli) start(ctx context.Context, args []string) error {
+	fs := flag.NewFlagSet("start", flag.ContinueOnError)
+	fs.SetOutput(k.errOut)
+	players := fs.String("players", "", "players present, comma-separated (teams are generated)")
+	mode := fs.String("mode", "", "team generation: balanced (default) or random")
+	red := fs.String("red", "", "red forward,goalkeeper")
+	blue := fs.String("blue", "", "blue forward,goalkeeper")
+	waiting := fs.String("waiting", "", "waiting queue, comma-separated")
+	if err := fs.Parse(args); err != nil {
+		return usageError(err.Error())
+	}
+	body := map[string]any{}
+	switch {
+	case *players != "":
+		if *red != "" || *blue != "" || *waiting != "" {
+			return usageError("use either -players or -red/-blue/-waiting")
+		}
+		body["players"] = splitList(*players)
+		if *mode != "" {
+			body["mode"] = *mode
+		}
+	default:
+		r, err := pair(*red, "red")
+		if err != nil {
+			return err
+		}
+		b, err := pair(*blue, "blue")
+		if err != nil {
+			return err
+		}
+		body["red"], body["blue"], body["waiting"] = r, b, splitList(*waiting)
+	}
+	var res startResponse
+	raw, err := k.c.postJSON(ctx, "/games/start", body, &res)
+	if err != nil {
+		return err
+	}
+	k.emit(raw, func() {
+		fmt.Fprintf(k.out, "Started game %s\n", res.ID)
+		if res.Teams != nil {
+			fmt.Fprintf(k.out, "Teams (%s): red %.2f, blue %.2f\n", res.Teams.Mode, res.Teams.RedRating, res.Teams.BlueRating)
+		}
+		printGame(k.out, res.State)
+	})
+	return nil
+}
+
+func (k *cli) list(ctx context.Context, args []string) error {
+	var res []gameSummary
+	raw, err := k.c.getJSON(ctx, "/games", &res)
+	if err != nil {
+		return err
+	}
+	k.emit(raw, func() {
+		rows := [][]string{{"ID", "STARTED"}}
+		for _, g := range res {
+			rows = append(rows, []string{g.ID, strconv.FormatBool(g.Started)})
+		}
+		printTable(k.out, rows)
+	})
+	return nil
+}
+
+func (k *cli) show(ctx context.Context, args []string) error {
+	id, _, err := gameArg(args)
+	if err != nil {
+		return err
+	}
+	var g game
+	raw, err := k.c.getJSON(ctx, "/games/"+id, &g)
+	if err != nil {
+		return err
+	}
+	k.emit(raw, func() { printGame(k.out, g) })
+	return nil
+}
+
+func (k *cli) queue(ctx context.Context, args []string) error {
+	id, players, err := gameArg(args)
+	if err != nil {
+		return err
+	}
+	var g game
+	var raw json.RawMessage
+	switch len(players) {
+	case 0:
+		raw, err = k.c.postJSON(ctx, "/games/"+id+"/queue", nil, &g)
+	case 1:
+		raw, err = k.c.postJSON(ctx, "/games/"+id+"/queue", map[string]string{"player_id": players[0]}, &g)
+	default:
+		raw, err = k.c.postJSON(ctx, "/games/"+id+"/queue/batch-add", map[string][]string{"player_ids": players}, &g)
+	}
+	if err != nil {
+		return err
+	}
+	k.emit(raw, func() { printGame(k.out, g) })
+	return nil
+}
+
+func (k *cli) goal(ctx context.Context, args []string) error {
+	id, rest, err := gameArg(args)
+	if err != nil {
+		return err
+	}
+	if len(rest) != 1 || (rest[0] != "red" && rest[0] != "blue") {
+		return usageError("usage: goal <game> red|blue")
+	}
+	var g game
+	raw, err := k.c.postJSON(ctx, "/games/"+id+"/goal", map[string]string{"team": rest[0]}, &g)
+	if err != nil {
+		return err
+	}
+	k.emit(raw, func() {
+		if r := g.Rotation; r != nil {
+			fmt.Fprintf(k.out, "Goal %s. Benched %s, %s to goal, %s comes on.\n",
+				rest[0], g.name(r.Benched), g.name(r.MovedToGoalkeeper), g.name(r.NewForward))
+		} else {
+			fmt.Fprintf(k.out, "Goal %s.\n", rest[0])
+		}
+		if c := g.Celebration; c != nil {
+			fmt.Fprintf(k.out, "Full rotation for %s!\n", g.names(c.Players))
+		}
+		printGame(k.out, g)
+	})
+	return nil
+}
+
+func (k *cli) undo(ctx context.Context, args []string) error {
+	id, _, err := gameArg(args)
+	if err != nil {
+		return err
+	}
+	var g game
+	raw, err := k.c.postJSON(ctx, "/games/"+id+"/undo", nil, &g)
+	if err != nil {
+		return err
+	}
+	k.emit(raw, func() { printGame(k.out, g) })
+	return nil
+}
+
+func (k *cli) remove(ctx context.Context, args []string) error {
+	id, rest, err := gameArg(args)
+	if err != nil {
+		return err
+	}
+	body := map[string]string{}
+	if len(rest) > 0 {
+		body["player_id"] = rest[0]
+	}
+	var g game
+	raw, err := k.c.postJSON(ctx, "/games/"+id+"/remove", body, &g)
+	if err != nil {
+		return err
+	}
+	k.emit(raw, func() { printGame(k.out, g) })
+	return nil
+}
+
+func (k *cli) players(ctx context.Context, args []string) error {
+	fs := flag.NewFlagSet("players", flag.ContinueOnError)
+	fs.SetOutput(k.errOut)
+	query := fs.String("query", "", "name contains")
+	limit := fs.Int("limit", 20, "maximum results")
+	if err := fs.Parse(args); err != nil {
+		return usageError(err.Error())
+	}
+	q := url.Values{"limit": {strconv.Itoa(*limit)}}
+	if *query != "" {
+		q.Set("query", *query)
+	}
+	var res []player
+	raw, err := k.c.getJSON(ctx, "/players?"+q.Encode(), &res)
+	if err != nil {
+		return err
+	}
+	k.emit(raw, func() { printPlayers(k.out, res, false) })
+	return nil
+}
+
+func (k *cli) leaderboard(ctx context.Context, args []string) error {
+	fs := flag.NewFlagSet("leaderboard", flag.ContinueOnError)
+	fs.SetOutput(k.errOut)
+	limit := fs.Int("limit", 20, "number of players")
+	if err := fs.Parse(args); err != nil {
+		return usageError(err.Error())
+	}
+	var res []player
+	raw, err := k.c.getJSON(ctx, "/leaderboard/data?limit="+strconv.Itoa(*limit), &res)
+	if err != nil {
+		return err
+	}
+	k.emit(raw, func() { printPlayers(k.out, res, true) })
+	return nil
+}
+
+// watch prints the game, then follows its event stream: each event is
+// printed, followed by the new state (table), or one JSON event per line
+// (json). The stream is reopened if it drops; Ctrl-C ends it.
+func (k *cli) watch(ctx context.Context, args []string) error {
+	id, _, err := gameArg(args)
+	if err != nil {
+		return err
+	}
+	if !k.json {
+		if err := k.show(ctx, []string{id}); err != nil {
+			return err
+		}
+	}
+	// A goal publishes several events at once: print each, then the state
+	// once they stop coming
+	var mu sync.Mutex
+	var render *time.Timer
+	refresh := func() {
+		mu.Lock()
+		defer mu.Unlock()
+		var g game
+		if _, err := k.c.getJSON(ctx, "/games/"+id, &g); err != nil {
+			fmt.Fprintf(k.errOut, "kott watch: %v\n", err)
+			return
+		}
+		printGame(k.out, g)
+	}
+	backoff := time.Second
+	for {
+		err := k.c.stream(ctx, "/games/"+id+"/events", func(ev sseEvent) error {
+			backoff = time.Second
+			mu.Lock()
+			defer mu.Unlock()
+			if k.json {
+				fmt.Fprintln(k.out, string(ev.Data))
+				return nil
+			}
+			var e event
+			_ = json.Unmarshal(ev.Data, &e)
+			fmt.Fprintf(k.out, "\n%s  %s\n", e.At.Local().Format("15:04:05"), describe(e))
+			if render != nil {
+				render.Stop()
+			}
+			render = time.AfterFunc(200*time.Millisecond, refresh)
+			return nil
+		})
+		if ctx.Err() != nil {
+			return nil
+		}
+		var ae *apiError
+		if errors.As(err, &ae) && ae.Status/100 == 4 {
+			return err
+		}
+		if err != nil {
+			fmt.Fprintf(k.errOut, "kott watch: %v; reconnecting in %s\n", err, backoff)
+		}
+		select {
+		case <-ctx.Done():
+			return nil
+		case <-time.After(backoff):
+		}
+		backoff = min(2*backoff, 30*time.Second)
+	}
+}
@@ -0,0 +1,223 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+	"text/tabwriter"
+	"time"
+)
+
+// The subset of the API's JSON the CLI renders.
+
+type team struct {
+	Forward    string `json:"forward"`
+	Goalkeeper string `json:"goalkeeper"`
+}
+
+type queueEntry struct {
+	PlayerID             string     `json:"player_id"`
+	Position             int        `json:"position"`
+	Priority             int        `json:"priority"`
+	SkipNext             bool       `json:"skip_next"`
+	ReservedUntil        *time.Time `json:"reserved_until"`
+	EstimatedWaitSeconds int        `json:"estimated_wait_seconds"`
+}
+
+type game struct {
+	Red      team         `json:"red"`
+	Blue     team         `json:"blue"`
+	Waiting  []string     `json:"waiting"`
+	Queue    []queueEntry `json:"queue"`
+	Started  bool         `json:"started"`
+	VenueID  string       `json:"venue_id"`
+	Rotation *struct {
+		Benched           string `json:"benched"`
+		MovedToGoalkeeper string `json:"moved_to_goalkeeper"`
+		NewForward        string `json:"new_forward"`
+	} `json:"rotation"`
+	Match *struct {
+		GoalsToWin int `json:"goals_to_win"`
+		RedScore   int `json:"red_score"`
+		BlueScore  int `json:"blue_score"`
+	} `json:"match"`
+	Celebration *struct {
+		Team    string   `json:"team"`
+		Players []string `json:"players"`
+	} `json:"celebration"`
+	Players map[string]string `json:"players"`
+}
+
+// name returns a player's display name, falling back to the ID.
+func (g game) name(id string) string {
+	if id == "" {
+		return "-"
+	}
+	if n := g.Players[id]; n != "" {
+		return n
+	}
+	return id
+}
+
+func (g game) names(ids []string) string {
+	out := make([]string, len(ids))
+	for i, id := range ids {
+		out[i] = g.name(id)
+	}
+	return strings.Join(out, " & ")
+}
+
+type gameSummary struct {
+	ID      string `json:"id"`
+	Started bool   `json:"started"`
+}
+
+type startResponse struct {
+	ID    string `json:"id"`
+	State game   `json:"state"`
+	Teams *struct {
+		Mode       string  `json:"mode"`
+		RedRating  float64 `json:"red_rating"`
+		BlueRating float64 `json:"blue_rating"`
+	} `json:"teams"`
+}
+
+type player struct {
+	ID           int64  `json:"id"`
+	Name         string `json:"name"`
+	Wins         int64  `json:"wins"`
+	Survives     int64  `json:"survives"`
+	FullRotation int64  `json:"full_rotation"`
+	Nickname     string `json:"nickname"`
+}
+
+type event struct {
+	Type     string         `json:"type"`
+	PlayerID string         `json:"player_id"`
+	At       time.Time      `json:"at"`
+	Data     map[string]any `json:"data"`
+}
+
+// printJSON pretty-prints a raw reply.
+func printJSON(w io.Writer, raw json.RawMessage) {
+	var buf bytes.Buffer
+	if json.Indent(&buf, raw, "", "  ") != nil {
+		w.Write(raw)
+		fmt.Fprintln(w)
+		return
+	}
+	buf.WriteByte('\n')
+	buf.WriteTo(w)
+}
+
+// printTable writes rows as aligned columns; the first row is the header.
+func printTable(w io.Writer, rows [][]string) {
+	tw := tabwriter.NewWriter(w, 0, 0, 2, ' ', 0)
+	for _, r := range rows {
+		fmt.Fprintln(tw, strings.Join(r, "\t"))
+	}
+	tw.Flush()
+}
+
+func printGame(w io.Writer, g game) {
+	status := "started"
+	if !g.Started {
+		status = "not started"
+		if g.Match != nil {
+			status = "over"
+		}
+	}
+	fmt.Fprintf(w, "Status: %s", status)
+	if g.VenueID != "" {
+		fmt.Fprintf(w, " (venue %s)", g.VenueID)
+	}
+	fmt.Fprintln(w)
+	rows := [][]string{{"TEAM", "FORWARD", "GOALKEEPER"}}
+	red, blue := []string{"red", g.name(g.Red.Forward), g.name(g.Red.Goalkeeper)}, []string{"blue", g.name(g.Blue.Forward), g.name(g.Blue.Goalkeeper)}
+	if g.Match != nil {
+		rows[0] = append(rows[0], "SCORE")
+		red = append(red, strconv.Itoa(g.Match.RedScore)+"/"+strconv.Itoa(g.Match.GoalsToWin))
+		blue = append(blue, strconv.Itoa(g.Match.BlueScore)+"/"+strconv.Itoa(g.Match.GoalsToWin))
+	}
+	printTable(w, append(rows, red, blue))
+	if g.Match != nil {
+		return
+	}
+	if len(g.Queue) == 0 {
+		fmt.Fprintln(w, "Queue: empty")
+		return
+	}
+	fmt.Fprintln(w)
+	rows = [][]string{{"#", "PLAYER", "WAIT", "NOTE"}}
+	for _, e := range g.Queue {
+		var notes []string
+		if e.Priority > 0 {
+			notes = append(notes, "priority "+strconv.Itoa(e.Priority))
+		}
+		if e.SkipNext {
+			notes = append(notes, "stepping aside")
+		}
+		if e.ReservedUntil != nil && e.ReservedUntil.After(time.Now()) {
+			notes = append(notes, "away until "+e.ReservedUntil.Local().Format("15:04"))
+		}
+		wait := "-"
+		if e.EstimatedWaitSeconds > 0 {
+			wait = fmt.Sprintf("~%d min", (e.EstimatedWaitSeconds+59)/60)
+		}
+		rows = append(rows, []string{strconv.Itoa(e.Position), g.name(e.PlayerID), wait, strings.Join(notes, ", ")})
+	}
+	printTable(w, rows)
+}
+
+func printPlayers(w io.Writer, ps []player, ranked bool) {
+	header := []string{"ID", "NAME", "WINS", "SURVIVES", "FULL ROTATIONS"}
+	if ranked {
+		header = append([]string{"#"}, header...)
+	}
+	rows := [][]string{header}
+	for i, p := range ps {
+		name := p.Name
+		if p.Nickname != "" {
+			name += " (" + p.Nickname + ")"
+		}
+		r := []string{strconv.FormatInt(p.ID, 10), name, strconv.FormatInt(p.Wins, 10), strconv.FormatInt(p.Survives, 10), strconv.FormatInt(p.FullRotation, 10)}
+		if ranked {
+			r = append([]string{strconv.Itoa(i + 1)}, r...)
+		}
+		rows = append(rows, r)
+	}
+	printTable(w, rows)
+}
+
+// describe summarizes an event in one line.
+func describe(e event) string {
+	s := func(k string) string { return fmt.Sprint(e.Data[k]) }
+	switch e.Type {
+	case "goal":
+		if _, ok := e.Data["red_score"]; ok {
+			return fmt.Sprintf("goal %s (%s - %s)", s("team"), s("red_score"), s("blue_score"))
+		}
+		return "goal " + s("team")
+	case "rotation":
+		return fmt.Sprintf("%s rotates: %s benched, %s comes on", s("team"), s("benched"), s("new_forward"))
+	case "full_rotation":
+		return "full rotation for " + s("team")
+	case "game_ended":
+		return fmt.Sprintf("game over: %s - %s, %s wins", s("red_score"), s("blue_score"), s("winner"))
+	case "player_joined_queue":
+		return fmt.Sprintf("player %s joined the queue (#%s)", e.PlayerID, s("position"))
+	case "player_left":
+		return "player " + e.PlayerID + " left"
+	case "swap":
+		return s("team") + " swaps forward and goalkeeper"
+	case "substitute":
+		return fmt.Sprintf("substitute on %s: %s in, %s out", s("team"), s("in"), s("out"))
+	}
+	if e.PlayerID != "" {
+		return e.Type + " " + e.PlayerID
+	}
+	return e.Type
+}
@@ -0,0 +1,668 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"os/signal"
+	"path/filepath"
+	"slices"
+	"strconv"
+	"strings"
+	"syscall"
+	"text/tabwriter"
+	"time"
+)
+
+// command is a subcommand of the server binary. Everything but serve is a
+// one-off ops task that talks to MySQL directly.
+type command struct {
+	name    string
+	args    string
+	summary string
+	run     func(args []string) error
+}
+
+var commands []command
+
+func init() {
+	commands = []command{
+		{"serve", "", "run the HTTP server (default)", serve},
+		{"migrate", "[-dry-run] [-baseline NNN]", "apply pending schema migrations", runMigrate},
+		{"recompute-stats", "[-dry-run]", "rebuild player counters from goal events", runRecomputeStats},
+		{"export", "[-out file] [-tables t1,t2]", "dump players, games and events as JSON lines", runExport},
+		{"import", "[-dry-run] <file|->", "restore an export into an empty database", runImport},
+		{"import-games", "[-dry-run] [-format csv|json] [-tz zone] <file|->", "load historical games (timestamp, four players, scoring team)", runImportGames},
+		{"merge-players", "<from> <into>", "fold one player into another (IDs or names)", runMergePlayers},
+		{"check-config", "[-offline]", "validate the environment and the MySQL connection", runCheckConfig},
+		{"help", "", "show this help", nil},
+	}
+}
+
+// usageError is a bad invocation; it exits with status 2.
+type usageError string
+
+func (e usageError) Error() string { return string(e) }
+
+// runCommand dispatches args to a subcommand and returns the exit status.
+// Without a subcommand the server is started, as before subcommands existed.
+func runCommand(args []string) int {
+	name := "serve"
+	if len(args) > 0 && !strings.HasPrefix(args[0], "-") {
+		name, args = args[0], args[1:]
+	}
+	if name == "help" {
+		usage(os.Stdout)
+		return 0
+	}
+	for _, c := range commands {
+		if c.name != name || c.run == nil {
+			continue
+		}
+		err := c.run(args)
+		var ue usageError
+		switch {
+		case err == nil:
+			return 0
+		case errors.Is(err, flag.ErrHelp):
+			return 0
+		case errors.As(err, &ue):
+			fmt.Fprintf(os.Stderr, "kingofthetable %s: %v\nusage: kingofthetable %s\n", name, err, strings.TrimSpace(name+" "+c.args))
+			return 2
+		}
+		fmt.Fprintf(os.Stderr, "kingofthetable %s: %v\n", name, err)
+		return 1
+	}
+	fmt.Fprintf(os.Stderr, "kingofthetable: unknown command %q\n\n", name)
+	usage(os.Stderr)
+	return 2
+}
+
+func usage(w io.Writer) {
+	fmt.Fprintln(w, "usage: kingofthetable [command] [flags]")
+	fmt.Fprintln(w)
+	tw := tabwriter.NewWriter(w, 0, 0, 2, ' ', 0)
+	for _, c := range commands {
+		fmt.Fprintf(tw, "  %s %s\t%s\n", c.name, c.args, c.summary)
+	}
+	tw.Flush()
+	fmt.Fprintln(w, "\nConfiguration comes from the environment (see README); commands other than serve need MYSQL_DSN.")
+}
+
+// newFlagSet returns a flag set that reports errors instead of exiting.
+func newFlagSet(name, args string) *flag.FlagSet {
+	fs := flag.NewFlagSet(name, flag.ContinueOnError)
+	fs.Usage = func() {
+		fmt.Fprintf(fs.Output(), "usage: kingofthetable %s\n", strings.TrimSpace(name+" "+args))
+		fs.PrintDefaults()
+	}
+	return fs
+}
+
+// parseFlags parses args for the named command; wrong flags are usage errors.
+func parseFlags(fs *flag.FlagSet, args []string) error {
+	fs.SetOutput(io.Discard)
+	err := fs.Parse(args)
+	if err != nil && !errors.Is(err, flag.ErrHelp) {
+		return usageError(err.Error())
+	}
+	if errors.Is(err, flag.ErrHelp) {
+		fs.SetOutput(os.Stdout)
+		fs.Usage()
+	}
+	return err
+}
+
+// commandFlags builds the flag set for a registered command.
+func commandFlags(name string) *flag.FlagSet {
+	for _, c := range commands {
+		if c.name == name {
+			return newFlagSet(name, c.args)
+		}
+	}
+	return newFlagSet(name, "")
+}
+
+// openAdminDB connects to MYSQL_DSN for a one-off command. Writes go straight
+// to MySQL: no worker, outbox or dead-letter store.
+func openAdminDB() (*DB, error) {
+	dsn := strings.TrimSpace(os.Getenv("MYSQL_DSN"))
+	if dsn == "" {
+		return nil, errors.New("MYSQL_DSN not set")
+	}
+	sqldb, err := openMySQL(dsn)
+	if err != nil {
+		return nil, err
+	}
+	return &DB{sql: sqldb}, nil
+}
+
+// commandContext is cancelled by SIGINT/SIGTERM.
+func commandContext() (context.Context, context.CancelFunc) {
+	return signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+}
+
+// runMergePlayers: merge-players <from> <into>
+func runMergePlayers(args []string) error {
+	fs := commandFlags("merge-players")
+	if err := parseFlags(fs, args); err != nil {
+		return err
+	}
+	if fs.NArg() != 2 {
+		return usageError("expected two players")
+	}
+	d, err := openAdminDB()
+	if err != nil {
+		return err
+	}
+	defer d.sql.Close()
+	ctx, cancel := commandContext()
+	defer cancel()
+	from, err := lookupPlayer(ctx, d, fs.Arg(0))
+	if err != nil {
+		return err
+	}
+	into, err := lookupPlayer(ctx, d, fs.Arg(1))
+	if err != nil {
+		return err
+	}
+	p, err := d.MergePlayers(ctx, from.ID, into.ID)
+	if err != nil {
+		return err
+	}
+	fmt.Printf("merged %s (#%d) into %s (#%d): wins %d, survives %d, full rotations %d\n",
+		from.Name, from.ID, p.Name, p.ID, p.Wins, p.Survives, p.FullRotation)
+	fmt.Println("restart the server (or merge through POST /players/merge) so its name cache picks this up")
+	return nil
+}
+
+// lookupPlayer resolves a numeric ID or an exact name.
+func lookupPlayer(ctx context.Context, d *DB, ref string) (Player, error) {
+	if id, ok := playerRefID(ref); ok {
+		p, err := d.GetPlayer(ctx, id)
+		if err != nil {
+			return Player{}, fmt.Errorf("player %d: %w", id, err)
+		}
+		return p, nil
+	}
+	p, err := d.GetPlayerByName(ctx, normalizePlayerName(ref))
+	if err != nil {
+		return Player{}, fmt.Errorf("player %q: %w", ref, err)
+	}
+	return p, nil
+}
+
+// runRecomputeStats: recompute-stats [-dry-run]
+func runRecomputeStats(args []string) error {
+	fs := commandFlags("recompute-stats")
+	dryRun := fs.Bool("dry-run", false, "report the differences without writing them")
+	if err := parseFlags(fs, args); err != nil {
+		return err
+	}
+	if fs.NArg() != 0 {
+		return usageError("unexpected arguments")
+	}
+	d, err := openAdminDB()
+	if err != nil {
+		return err
+	}
+	defer d.sql.Close()
+	ctx, cancel := commandContext()
+	defer cancel()
+	changes, err := d.RecomputeStats(ctx, !*dryRun)
+	if err != nil {
+		return err
+	}
+	if len(changes) == 0 {
+		fmt.Println("all player counters match goal_events")
+		return nil
+	}
+	tw := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(tw, "ID\tNAME\tWINS\tSURVIVES\tFULL ROTATIONS")
+	change := func(from, to int64) string {
+		if from == to {
+			return strconv.FormatInt(to, 10)
+		}
+		return fmt.Sprintf("%d -> %d", from, to)
+	}
+	for _, c := range changes {
+		fmt.Fprintf(tw, "%d\t%s\t%s\t%s\t%s\n", c.ID, c.Name,
+			change(c.Stored.Wins, c.Recomputed.Wins),
+			change(c.Stored.Survives, c.Recomputed.Survives),
+			change(c.Stored.FullRotation, c.Recomputed.FullRotation))
+	}
+	tw.Flush()
+	if *dryRun {
+		fmt.Printf("%d player(s) would change (dry run)\n", len(changes))
+	} else {
+		fmt.Printf("%d player(s) updated\n", len(changes))
+	}
+	return nil
+}
+
+// runExport: export [-out file] [-tables t1,t2]
+func runExport(args []string) error {
+	fs := commandFlags("export")
+	out := fs.String("out", "-", "output file (- for stdout)")
+	tables := fs.String("tables", strings.Join(exportTables, ","), "tables to export")
+	if err := parseFlags(fs, args); err != nil {
+		return err
+	}
+	if fs.NArg() != 0 {
+		return usageError("unexpected arguments")
+	}
+	var list []string
+	for _, t := range strings.Split(*tables, ",") {
+		if t = strings.TrimSpace(t); t == "" {
+			continue
+		}
+		if !isExportTable(t) {
+			return usageError("unknown table: " + t + " (one of " + strings.Join(exportTables, ", ") + ")")
+		}
+		list = append(list, t)
+	}
+	d, err := openAdminDB()
+	if err != nil {
+		return err
+	}
+	defer d.sql.Close()
+	ctx, cancel := commandContext()
+	defer cancel()
+
+	w := io.Writer(os.Stdout)
+	var f *os.File
+	if *out != "-" {
+		if f, err = os.Create(*out); err != nil {
+			return err
+		}
+		defer f.Close()
+		w = f
+	}
+	counts, err := d.ExportTables(ctx, w, list)
+	if err != nil {
+		return err
+	}
+	if f != nil {
+		if err := f.Close(); err != nil {
+			return err
+		}
+	}
+	for _, t := range list {
+		fmt.Fprintf(os.Stderr, "%s: %d row(s)\n", t, counts[t])
+	}
+	return nil
+}
+
+// runImport: import [-dry-run] <file|->
+func runImport(args []string) error {
+	fs := commandFlags("import")
+	dryRun := fs.Bool("dry-run", false, "load everything, then roll back")
+	if err := parseFlags(fs, args); err != nil {
+		return err
+	}
+	if fs.NArg() != 1 {
+		return usageError("expected one input file")
+	}
+	r := io.Reader(os.Stdin)
+	if name := fs.Arg(0); name != "-" {
+		f, err := os.Open(name)
+		if err != nil {
+			return err
+		}
+		defer f.Close()
+		r = f
+	}
+	d, err := openAdminDB()
+	if err != nil {
+		return err
+	}
+	defer d.sql.Close()
+	ctx, cancel := commandContext()
+	defer cancel()
+	counts, err := d.ImportTables(ctx, r, !*dryRun)
+	if err != nil {
+		return err
+	}
+	for _, t := range exportTables {
+		if n, ok := counts[t]; ok {
+			fmt.Printf("%s: %d row(s)\n", t, n)
+		}
+	}
+	if *dryRun {
+		fmt.Println("dry run: nothing was written")
+	}
+	return nil
+}
+
+// runImportGames: import-games [-dry-run] [-format csv|json] [-tz zone] <file|->
+//
+// Every line is validated before anything is written; any problem aborts
+// the import with a report of all bad lines.
+func runImportGames(args []string) error {
+	fs := commandFlags("import-games")
+	dryRun := fs.Bool("dry-run", false, "validate and report without writing")
+	format := fs.String("format", "", "csv or json (default: from the file extension, else csv)")
+	tz := fs.String("tz", "UTC", "time zone for timestamps without an offset")
+	if err := parseFlags(fs, args); err != nil {
+		return err
+	}
+	if fs.NArg() != 1 {
+		return usageError("expected one input file")
+	}
+	name := fs.Arg(0)
+	if *format == "" {
+		*format = "csv"
+		if ext := strings.ToLower(filepath.Ext(name)); ext == ".json" || ext == ".ndjson" || ext == ".jsonl" {
+			*format = "json"
+		}
+	}
+	parse := parseHistoryCSV
+	switch *format {
+	case "csv":
+	case "json":
+		parse = parseHistoryJSON
+	default:
+		return usageError("format must be csv or json")
+	}
+	loc, err := time.LoadLocation(*tz)
+	if err != nil {
+		return usageError("unknown time zone: " + *tz)
+	}
+	r := io.Reader(os.Stdin)
+	if name != "-" {
+		f, err := os.Open(name)
+		if err != nil {
+			return err
+		}
+		defer f.Close()
+		r = f
+	}
+	rows, lines, errs, err := parse(r)
+	if err != nil {
+		return err
+	}
+	games, verrs := groupHistory(rows, lines, loc)
+	errs = append(errs, verrs...)
+
+	d, err := openAdminDB()
+	if err != nil {
+		return err
+	}
+	defer d.sql.Close()
+	ctx, cancel := commandContext()
+	defer cancel()
+	gameIDs := make([]string, len(games))
+	for i, gm := range games {
+		gameIDs[i] = gm.ID
+	}
+	existing, err := d.ExistingGames(ctx, gameIDs)
+	if err != nil {
+		return err
+	}
+	for _, gm := range games {
+		if existing[gm.ID] {
+			errs = append(errs, importError{gm.Goals[0].Line, "already imported (game " + gm.ID + ")"})
+		}
+	}
+	if len(errs) > 0 {
+		slices.SortStableFunc(errs, func(a, b importError) int { return a.Line - b.Line })
+		for _, e := range errs {
+			fmt.Fprintln(os.Stderr, e)
+		}
+		return fmt.Errorf("%d invalid line(s); nothing imported", len(errs))
+	}
+	if len(games) == 0 {
+		fmt.Println("no rows to import")
+		return nil
+	}
+
+	// Players: report the new ones; ImportHistory creates them
+	names := historyPlayerNames(games)
+	known, err := d.GetPlayersByNames(ctx, names)
+	if err != nil {
+		return err
+	}
+	knownKeys := map[string]bool{}
+	for n := range known {
+		knownKeys[playerNameKey(n)] = true
+	}
+	var fresh []string
+	for _, n := range names {
+		if !knownKeys[playerNameKey(n)] {
+			fresh = append(fresh, n)
+		}
+	}
+	goals := 0
+	first, last := games[0].Goals[0].At, games[0].Goals[0].At
+	for _, gm := range games {
+		goals += len(gm.Goals)
+		for _, g := range gm.Goals {
+			first, last = minTime(first, g.At), maxTime(last, g.At)
+		}
+	}
+	fmt.Printf("%d goal(s) in %d game(s), %s to %s\n", goals, len(games), first.Format(time.DateOnly), last.Format(time.DateOnly))
+	if len(fresh) > 0 {
+		fmt.Printf("%d new player(s): %s\n", len(fresh), strings.Join(fresh, ", "))
+	}
+	if *dryRun {
+		fmt.Println("dry run: nothing was written")
+		return nil
+	}
+
+	if err := d.ImportHistory(ctx, games); err != nil {
+		return err
+	}
+	fmt.Printf("imported %d goal(s) in %d game(s)\n", goals, len(games))
+	changes, err := d.RecomputeStats(ctx, true)
+	if err != nil {
+		return fmt.Errorf("imported, but recomputing counters failed (run recompute-stats): %w", err)
+	}
+	fmt.Printf("counters recomputed for %d player(s)\n", len(changes))
+	return nil
+}
+
+func minTime(a, b time.Time) time.Time {
+	if b.Before(a) {
+		return b
+	}
+	return a
+}
+
+func maxTime(a, b time.Time) time.Time {
+	if b.After(a) {
+		return b
+	}
+	return a
+}
+
+// configCheck is one finding of check-config.
+type configCheck struct {
+	level string // ok, warn or error
+	key   string
+	msg   string
+}
+
+// Every integer and duration setting, with the default used when unset or invalid.
+var (
+	intSettings = []struct {
+		key string
+		def int
+	}{
+		{"DB_QUEUE_SIZE", 1024}, {"DB_MAX_ATTEMPTS", 8},
+		{"KOTT_MAX_BODY_BYTES", 64 << 10},
+		{"KOTT_RATE_IP", 300}, {"KOTT_RATE_IP_BURST", 60}, {"KOTT_RATE_TOKEN", 600}, {"KOTT_RATE_TOKEN_BURST", 120},
+		{"KOTT_READY_MOVE_BACK", 1}, {"KOTT_READY_MAX_MISSES", 3},
+		{"KOTT_WEBHOOK_MAX_ATTEMPTS", 5}, {"KOTT_WEBHOOK_LOG_SIZE", 500}, {"KOTT_WEBHOOK_WORKERS", 4},
+	}
+	durationSettings = []struct {
+		key string
+		def time.Duration
+	}{
+		{"SHUTDOWN_TIMEOUT", 15 * time.Second}, {"DB_DRAIN_TIMEOUT", 30 * time.Second},
+		{"KOTT_SESSION_TTL", 12 * time.Hour}, {"KOTT_MIN_GOAL_INTERVAL", 3 * time.Second},
+		{"KOTT_READY_TIMEOUT", 0},
+		{"KOTT_WEBHOOK_RETRY_BASE", 2 * time.Second}, {"KOTT_WEBHOOK_TIMEOUT", 5 * time.Second},
+	}
+	boolSettings = []string{"KOTT_COOKIE_SECURE", "KOTT_TRUST_PROXY", "DB_OUTBOX_FSYNC"}
+)
+
+// runCheckConfig: check-config [-offline]
+func runCheckConfig(args []string) error {
+	fs := commandFlags("check-config")
+	offline := fs.Bool("offline", false, "skip connecting to MySQL")
+	if err := parseFlags(fs, args); err != nil {
+		return err
+	}
+	if fs.NArg() != 0 {
+		return usageError("unexpected arguments")
+	}
+	checks := checkConfig(!*offline)
+	errs := 0
+	tw := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+	for _, c := range checks {
+		fmt.Fprintf(tw, "%s\t%s\t%s\n", c.level, c.key, c.msg)
+		if c.level == "error" {
+			errs++
+		}
+	}
+	tw.Flush()
+	if errs > 0 {
+		return fmt.Errorf("%d problem(s) found", errs)
+	}
+	return nil
+}
+
+// checkConfig inspects the same environment the server reads at startup.
+// Invalid numbers are errors because the server silently falls back to the
+// default for them.
+func checkConfig(connect bool) []configCheck {
+	var out []configCheck
+	add := func(level, key, format string, a ...any) {
+		out = append(out, configCheck{level, key, fmt.Sprintf(format, a...)})
+	}
+	env := func(key string) string { return strings.TrimSpace(os.Getenv(key)) }
+
+	if port := env("PORT"); port != "" {
+		if n, err := strconv.Atoi(port); err != nil || n < 1 || n > 65535 {
+			add("error", "PORT", "%q is not a port number; the server would listen on :8080", port)
+		} else {
+			add("ok", "PORT", "listening on :%d", n)
+		}
+	}
+	for _, s := range intSettings {
+		if v := env(s.key); v != "" {
+			if n, err := strconv.Atoi(v); err != nil || n <= 0 {
+				add("error", s.key, "%q is not a positive integer; the default %d would be used", v, s.def)
+			}
+		}
+	}
+	for _, s := range durationSettings {
+		if v := env(s.key); v != "" {
+			if d, err := time.ParseDuration(v); err != nil || d <= 0 {
+				add("error", s.key, "%q is not a positive duration (e.g. 10s); the default %s would be used", v, s.def)
+			}
+		}
+	}
+	for _, key := range boolSettings {
+		if v := env(key); v != "" && !strings.EqualFold(v, "true") && !strings.EqualFold(v, "false") {
+			add("warn", key, "%q is neither true nor false", v)
+		}
+	}
+
+	// Auth
+	authOn := !strings.EqualFold(env("KOTT_AUTH"), "off")
+	if !authOn {
+		add("warn", "KOTT_AUTH", "off: every request is treated as admin")
+	}
+	if v := env("KOTT_ANON_ROLE"); v != "" {
+		if _, ok := parseRole(v); !ok {
+			add("error", "KOTT_ANON_ROLE", "%q is not a role (spectator, player, referee, admin)", v)
+		} else if strings.EqualFold(v, "admin") && authOn {
+			add("warn", "KOTT_ANON_ROLE", "anonymous callers are admins")
+		}
+	}
+	if s := os.Getenv("KOTT_SESSION_SECRET"); s == "" {
+		add("warn", "KOTT_SESSION_SECRET", "not set; sessions will not survive restarts")
+	} else if len(s) < 16 {
+		add("warn", "KOTT_SESSION_SECRET", "shorter than 16 characters")
+	}
+	if authOn && env("KOTT_ADMIN_TOKEN") == "" && env("MYSQL_DSN") == "" {
+		add("warn", "KOTT_ADMIN_TOKEN", "not set and no database for API tokens; nobody can act as admin")
+	}
+	if strings.EqualFold(env("KOTT_RATE_LIMIT"), "off") {
+		add("warn", "KOTT_RATE_LIMIT", "off: requests are not throttled")
+	}
+
+	// Queue
+	switch v := strings.ToLower(env("KOTT_READY_ACTION")); v {
+	case "", "remove", "move":
+	default:
+		add("warn", "KOTT_READY_ACTION", "%q is not remove; missed checks move the player back", v)
+	}
+	switch v := strings.ToLower(env("DB_QUEUE_OVERFLOW")); v {
+	case "", "spill", "drop", "block":
+	default:
+		add("error", "DB_QUEUE_OVERFLOW", "%q is not spill, drop or block; spill would be used", v)
+	}
+
+	// Files written next to the database queue
+	for _, f := range []struct{ key, path string }{{"DB_OUTBOX_PATH", outboxPath()}, {"DB_DEADLETTER_PATH", deadLetterPath()}} {
+		if f.path == "" {
+			add("warn", f.key, "disabled")
+			continue
+		}
+		if st, err := os.Stat(filepath.Dir(f.path)); err != nil || !st.IsDir() {
+			add("error", f.key, "directory of %s does not exist", f.path)
+		}
+	}
+
+	// Slack
+	if env("KOTT_SLACK_SIGNING_SECRET") == "" {
+		if env("KOTT_SLACK_GAME") != "" {
+			add("warn", "KOTT_SLACK_GAME", "set but KOTT_SLACK_SIGNING_SECRET is not; Slack requests are rejected")
+		}
+	} else {
+		add("ok", "KOTT_SLACK_SIGNING_SECRET", "Slack integration enabled")
+	}
+
+	// Database
+	dsn := env("MYSQL_DSN")
+	if dsn == "" {
+		add("warn", "MYSQL_DSN", "not set; data is kept in memory only and lost on restart")
+		return out
+	}
+	ndsn, err := normalizeMySQLDSN(dsn)
+	if err == nil {
+		_, err = maybeAugmentTLS(ndsn)
+	}
+	if err != nil {
+		add("error", "MYSQL_DSN", "%v", err)
+		return out
+	}
+	if !connect {
+		add("ok", "MYSQL_DSN", "parsed (not connected)")
+		return out
+	}
+	sqldb, err := openMySQL(dsn)
+	if err != nil {
+		add("error", "MYSQL_DSN", "%v", err)
+		return out
+	}
+	defer sqldb.Close()
+	add("ok", "MYSQL_DSN", "connected")
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+	pending, err := pendingMigrations(ctx, sqldb)
+	switch {
+	case err != nil:
+		add("warn", "migrations", "%v", err)
+	case len(pending) > 0:
+		add("warn", "migrations", "%d pending (%s); run migrate", len(pending), strings.Join(pending, ", "))
+	default:
+		add("ok", "migrations", "schema up to date")
+	}
+	return out
+}
@@ -0,0 +1,396 @@
+package main
+
+import (
+	"bufio"
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"slices"
+	"strings"
+	"time"
+)
+
+// statCounters are the denormalized counters kept on players.
+type statCounters struct {
+	Wins         int64 `json:"wins"`
+	Survives     int64 `json:"survives"`
+	FullRotation int64 `json:"full_rotation"`
+}
+
+// statsChange is a player whose stored counters differ from goal_events.
+type statsChange struct {
+	ID         int64        `json:"id"`
+	Name       string       `json:"name"`
+	Stored     statCounters `json:"stored"`
+	Recomputed statCounters `json:"recomputed"`
+}
+
+// goalEventStats aggregates goal_events per player with RecordGoal's rules:
+// both scorers win; the scorers and the losing forward (who moves to
+// goalkeeper) survive, so a forward survives every goal; scorers of a
+// full_rotation goal earn one. Merged players own no events and come out
+// as zero.
+const goalEventStats = `SELECT player_id,
+       CAST(SUM(win) AS SIGNED) AS wins,
+       CAST(SUM(survive) AS SIGNED) AS survives,
+       CAST(SUM(win AND full_rotation) AS SIGNED) AS full_rotation
+  FROM (SELECT red_forward_id AS player_id, scoring_team = 'red' AS win, 1 AS survive, full_rotation FROM goal_events
+        UNION ALL
+        SELECT red_goalkeeper_id, scoring_team = 'red', scoring_team = 'red', full_rotation FROM goal_events
+        UNION ALL
+        SELECT blue_forward_id, scoring_team = 'blue', 1, full_rotation FROM goal_events
+        UNION ALL
+        SELECT blue_goalkeeper_id, scoring_team = 'blue', scoring_team = 'blue', full_rotation FROM goal_events) e
+ GROUP BY player_id`
+
+// RecomputeStats compares every player's counters with the totals derived
+// from goal_events and, when apply is set, overwrites the ones that differ.
+// The changed players are returned either way.
+func (d *DB) RecomputeStats(ctx context.Context, apply bool) ([]statsChange, error) {
+	if d == nil || d.sql == nil {
+		return nil, errors.New("database disabled")
+	}
+	tx, err := d.sql.BeginTx(ctx, nil)
+	if err != nil {
+		return nil, err
+	}
+	defer func() { _ = tx.Rollback() }()
+
+	rows, err := tx.QueryContext(ctx, `SELECT p.id, p.name, p.wins, p.survives, p.full_rotation,
+       COALESCE(s.wins, 0), COALESCE(s.survives, 0), COALESCE(s.full_rotation, 0)
+  FROM players p LEFT JOIN (`+goalEventStats+`) s ON s.player_id = p.id
+ WHERE p.wins <> COALESCE(s.wins, 0) OR p.survives <> COALESCE(s.survives, 0) OR p.full_rotation <> COALESCE(s.full_rotation, 0)
+ ORDER BY p.id
+   FOR UPDATE OF p`)
+	if err != nil {
+		return nil, err
+	}
+	var out []statsChange
+	for rows.Next() {
+		var c statsChange
+		if err := rows.Scan(&c.ID, &c.Name, &c.Stored.Wins, &c.Stored.Survives, &c.Stored.FullRotation,
+			&c.Recomputed.Wins, &c.Recomputed.Survives, &c.Recomputed.FullRotation); err != nil {
+			rows.Close()
+			return nil, err
+		}
+		out = append(out, c)
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	if !apply || len(out) == 0 {
+		return out, nil
+	}
+	for _, c := range out {
+		if _, err := tx.ExecContext(ctx, "UPDATE players SET wins = ?, survives = ?, full_rotation = ? WHERE id = ?",
+			c.Recomputed.Wins, c.Recomputed.Survives, c.Recomputed.FullRotation, c.ID); err != nil {
+			return nil, err
+		}
+	}
+	return out, tx.Commit()
+}
+
+// exportTables are the tables covered by export/import, parents first so an
+// import satisfies foreign keys row by row. API tokens and webhooks are left
+// out: they carry credentials.
+var exportTables = []string{
+	"players", "games", "goal_events", "lineup_events",
+	"seasons", "season_teams", "season_fixtures", "season_standings",
+}
+
+func isExportTable(t string) bool { return slices.Contains(exportTables, t) }
+
+// exportRow is one line of an export file.
+type exportRow struct {
+	Table string         `json:"table"`
+	Row   map[string]any `json:"row"`
+}
+
+// ExportTables writes every row of tables to w as JSON lines and returns
+// the row count per table. DATETIME columns are written as UTC
+// "2006-01-02 15:04:05", DATE columns as "2006-01-02".
+func (d *DB) ExportTables(ctx context.Context, w io.Writer, tables []string) (map[string]int, error) {
+	if d == nil || d.sql == nil {
+		return nil, errors.New("database disabled")
+	}
+	bw := bufio.NewWriter(w)
+	enc := json.NewEncoder(bw)
+	counts := make(map[string]int, len(tables))
+	// One transaction so the tables are a consistent snapshot
+	tx, err := d.sql.BeginTx(ctx, &sql.TxOptions{ReadOnly: true})
+	if err != nil {
+		return nil, err
+	}
+	defer func() { _ = tx.Rollback() }()
+	for _, t := range tables {
+		if !isExportTable(t) {
+			return nil, fmt.Errorf("unknown table: %s", t)
+		}
+		rows, err := tx.QueryContext(ctx, "SELECT * FROM `"+t+"` ORDER BY 1")
+		if err != nil {
+			return nil, err
+		}
+		cols, err := rows.ColumnTypes()
+		if err != nil {
+			rows.Close()
+			return nil, err
+		}
+		vals := make([]any, len(cols))
+		ptrs := make([]any, len(cols))
+		for i := range vals {
+			ptrs[i] = &vals[i]
+		}
+		for rows.Next() {
+			if err := rows.Scan(ptrs...); err != nil {
+				rows.Close()
+				return nil, err
+			}
+			row := make(map[string]any, len(cols))
+			for i, c := range cols {
+				switch v := vals[i].(type) {
+				case []byte:
+					row[c.Name()] = string(v)
+				case time.Time:
+					if c.DatabaseTypeName() == "DATE" {
+						row[c.Name()] = v.Format(time.DateOnly)
+					} else {
+						row[c.Name()] = v.UTC().Format(time.DateTime)
+					}
+				default:
+					row[c.Name()] = v
+				}
+			}
+			if err := enc.Encode(exportRow{Table: t, Row: row}); err != nil {
+				rows.Close()
+				return nil, err
+			}
+			counts[t]++
+		}
+		rows.Close()
+		if err := rows.Err(); err != nil {
+			return nil, err
+		}
+	}
+	return counts, bw.Flush()
+}
+
+// ImportTables loads an ExportTables stream into empty tables in a single
+// transaction, keeping the original IDs. Nothing is written unless every
+// line is valid and apply is set.
+func (d *DB) ImportTables(ctx context.Context, r io.Reader, apply bool) (map[string]int, error) {
+	if d == nil || d.sql == nil {
+		return nil, errors.New("database disabled")
+	}
+	tx, err := d.sql.BeginTx(ctx, nil)
+	if err != nil {
+		return nil, err
+	}
+	defer func() { _ = tx.Rollback() }()
+
+	// Known columns per table; a table is only checked once it appears
+	columns := map[string][]string{}
+	counts := map[string]int{}
+	dec := json.NewDecoder(bufio.NewReader(r))
+	dec.UseNumber()
+	for line := 1; ; line++ {
+		var er exportRow
+		if err := dec.Decode(&er); err == io.EOF {
+			break
+		} else if err != nil {
+			return nil, fmt.Errorf("row %d: %w", line, err)
+		}
+		if !isExportTable(er.Table) {
+			return nil, fmt.Errorf("row %d: unknown table %q", line, er.Table)
+		}
+		known, ok := columns[er.Table]
+		if !ok {
+			var n int
+			err := tx.QueryRowContext(ctx, "SELECT COUNT(*) FROM `"+er.Table+"`").Scan(&n)
+			if err != nil {
+				return nil, err
+			}
+			if n > 0 {
+				return nil, fmt.Errorf("table %s already has %d row(s); import only restores into empty tables", er.Table, n)
+			}
+			rows, err := tx.QueryContext(ctx, "SELECT * FROM `"+er.Table+"` LIMIT 0")
+			if err != nil {
+				return nil, err
+			}
+			known, err = rows.Columns()
+			rows.Close()
+			if err != nil {
+				return nil, err
+			}
+			columns[er.Table] = known
+		}
+		if len(er.Row) == 0 {
+			return nil, fmt.Errorf("row %d: empty row", line)
+		}
+		cols := make([]string, 0, len(er.Row))
+		for c := range er.Row {
+			if !slices.Contains(known, c) {
+				return nil, fmt.Errorf("row %d: table %s has no column %q", line, er.Table, c)
+			}
+			cols = append(cols, c)
+		}
+		slices.Sort(cols)
+		args := make([]any, len(cols))
+		for i, c := range cols {
+			switch v := er.Row[c].(type) {
+			case json.Number:
+				args[i] = v.String()
+			case string, bool, nil:
+				args[i] = v
+			default:
+				return nil, fmt.Errorf("row %d: column %s: unsupported value %v", line, c, v)
+			}
+		}
+		q := fmt.Sprintf("INSERT INTO `%s` (`%s`) VALUES (%s)", er.Table, strings.Join(cols, "`, `"),
+			strings.TrimRight(strings.Repeat("?,", len(cols)), ","))
+		if _, err := tx.ExecContext(ctx, q, args...); err != nil {
+			return nil, fmt.Errorf("row %d (%s): %w", line, er.Table, err)
+		}
+		counts[er.Table]++
+	}
+	if !apply {
+		return counts, nil
+	}
+	return counts, tx.Commit()
+}
+
+// ExistingGames returns which of ids already have a games row.
+func (d *DB) ExistingGames(ctx context.Context, ids []string) (map[string]bool, error) {
+	if d == nil || d.sql == nil {
+		return nil, errors.New("database disabled")
+	}
+	out := map[string]bool{}
+	for start := 0; start < len(ids); start += 1000 {
+		chunk := ids[start:min(start+1000, len(ids))]
+		rows, err := d.sql.QueryContext(ctx, "SELECT id FROM games WHERE id IN ("+
+			strings.TrimRight(strings.Repeat("?,", len(chunk)), ",")+")", anySlice(chunk)...)
+		if err != nil {
+			return nil, err
+		}
+		for rows.Next() {
+			var id string
+			if err := rows.Scan(&id); err != nil {
+				rows.Close()
+				return nil, err
+			}
+			out[id] = true
+		}
+		rows.Close()
+		if err := rows.Err(); err != nil {
+			return nil, err
+		}
+	}
+	return out, nil
+}
+
+// ImportHistory stores validated historical games in one transaction:
+// players missing by name are created, then a games row each and a
+// goal_events row per goal, with created_at set to the goal's time. A
+// player's last_seen only moves forward, to their latest imported goal, so
+// old history does not mark existing players as seen today. Counters are
+// not touched; recompute them afterwards.
+func (d *DB) ImportHistory(ctx context.Context, games []historicalGame) error {
+	if d == nil || d.sql == nil {
+		return errors.New("database disabled")
+	}
+	tx, err := d.sql.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer func() { _ = tx.Rollback() }()
+
+	names := historyPlayerNames(games)
+	if len(names) > 0 {
+		vals := strings.TrimRight(strings.Repeat("(?),", len(names)), ",")
+		if _, err := tx.ExecContext(ctx, "INSERT IGNORE INTO players (name) VALUES "+vals, anySlice(names)...); err != nil {
+			return err
+		}
+	}
+	ids, err := historyPlayerIDs(ctx, tx, names)
+	if err != nil {
+		return err
+	}
+	id := func(name string) int64 { return ids[playerNameKey(name)] }
+	latest := map[int64]time.Time{}
+	for _, gm := range games {
+		if _, err := tx.ExecContext(ctx, "INSERT INTO games (id, created_at) VALUES (?, ?)", gm.ID, gm.Goals[0].At); err != nil {
+			return fmt.Errorf("line %d: %w", gm.Goals[0].Line, err)
+		}
+		for _, g := range gm.Goals {
+			if _, err := tx.ExecContext(ctx,
+				`INSERT INTO goal_events (game_id, seq, scoring_team, red_forward_id, red_goalkeeper_id, blue_forward_id, blue_goalkeeper_id, benched_player_id, moved_to_goalkeeper_id, new_forward_id, full_rotation, created_at)
+         VALUES (?,NULL,?,?,?,?,?,?,?,?,?,?)`,
+				gm.ID, g.Team, id(g.RedForward), id(g.RedGoalkeeper), id(g.BlueForward), id(g.BlueGoalkeeper),
+				id(g.Benched), id(g.Moved), id(g.NewForward), g.FullRotation, g.At); err != nil {
+				return fmt.Errorf("line %d: %w", g.Line, err)
+			}
+			for _, n := range []string{g.RedForward, g.RedGoalkeeper, g.BlueForward, g.BlueGoalkeeper, g.NewForward} {
+				latest[id(n)] = maxTime(latest[id(n)], g.At)
+			}
+		}
+	}
+	for pid, at := range latest {
+		if _, err := tx.ExecContext(ctx,
+			"UPDATE players SET last_seen = GREATEST(COALESCE(last_seen, ?), ?) WHERE id = ?", at, at, pid); err != nil {
+			return err
+		}
+	}
+	return tx.Commit()
+}
+
+// historyPlayerIDs maps the playerNameKey of each name to its player ID,
+// following merges, reading through tx.
+func historyPlayerIDs(ctx context.Context, tx *sql.Tx, names []string) (map[string]int64, error) {
+	out := make(map[string]int64, len(names))
+	if len(names) == 0 {
+		return out, nil
+	}
+	placeholders := strings.TrimRight(strings.Repeat("?,", len(names)), ",")
+	rows, err := tx.QueryContext(ctx,
+		fmt.Sprintf("SELECT id, name, merged_into FROM players WHERE name IN (%s)", placeholders), anySlice(names)...)
+	if err != nil {
+		return nil, err
+	}
+	merged := map[string]int64{}
+	for rows.Next() {
+		var id int64
+		var name string
+		var into sql.NullInt64
+		if err := rows.Scan(&id, &name, &into); err != nil {
+			rows.Close()
+			return nil, err
+		}
+		out[playerNameKey(name)] = id
+		if into.Valid {
+			merged[playerNameKey(name)] = into.Int64
+		}
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	for key, id := range merged {
+		for i := 0; i < 8 && id != 0; i++ {
+			out[key] = id
+			var into sql.NullInt64
+			if err := tx.QueryRowContext(ctx, "SELECT merged_into FROM players WHERE id = ?", id).Scan(&into); err != nil {
+				return nil, err
+			}
+			id = into.Int64
+		}
+	}
+	for _, n := range names {
+		if out[playerNameKey(n)] == 0 {
+			return nil, fmt.Errorf("player %q could not be resolved after creating it", n)
+		}
+	}
+	return out, nil
+}
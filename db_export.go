@@ -0,0 +1,186 @@
+package main
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// exportFilter narrows the bulk exports. Zero values match everything.
+type exportFilter struct {
+	From    time.Time // inclusive
+	To      time.Time // exclusive
+	GameIDs []string
+}
+
+// exportedGoalEvent is a goal_events row with player names joined in.
+type exportedGoalEvent struct {
+	ID                int64     `json:"id"`
+	GameID            string    `json:"game_id"`
+	Seq               *int64    `json:"seq"`
+	At                time.Time `json:"at"`
+	ScoringTeam       string    `json:"scoring_team"`
+	RedForward        string    `json:"red_forward"`
+	RedGoalkeeper     string    `json:"red_goalkeeper"`
+	BlueForward       string    `json:"blue_forward"`
+	BlueGoalkeeper    string    `json:"blue_goalkeeper"`
+	Benched           string    `json:"benched"`
+	MovedToGoalkeeper string    `json:"moved_to_goalkeeper"`
+	NewForward        string    `json:"new_forward"`
+	FullRotation      bool      `json:"full_rotation"`
+}
+
+var goalEventCSVHeader = []string{
+	"id", "game_id", "seq", "at", "scoring_team",
+	"red_forward", "red_goalkeeper", "blue_forward", "blue_goalkeeper",
+	"benched", "moved_to_goalkeeper", "new_forward", "full_rotation",
+}
+
+func (e exportedGoalEvent) csvRecord() []string {
+	seq := ""
+	if e.Seq != nil {
+		seq = strconv.FormatInt(*e.Seq, 10)
+	}
+	return []string{
+		strconv.FormatInt(e.ID, 10), e.GameID, seq, e.At.UTC().Format(time.RFC3339), e.ScoringTeam,
+		e.RedForward, e.RedGoalkeeper, e.BlueForward, e.BlueGoalkeeper,
+		e.Benched, e.MovedToGoalkeeper, e.NewForward, strconv.FormatBool(e.FullRotation),
+	}
+}
+
+// exportedPlayer is a players row as exported. Merged rows are left out;
+// their events already belong to the surviving player.
+type exportedPlayer struct {
+	ID            int64      `json:"id"`
+	Name          string     `json:"name"`
+	Nickname      string     `json:"nickname"`
+	PreferredRole string     `json:"preferred_role"`
+	Active        bool       `json:"active"`
+	Wins          int64      `json:"wins"`
+	Survives      int64      `json:"survives"`
+	FullRotation  int64      `json:"full_rotation"`
+	CreatedAt     time.Time  `json:"created_at"`
+	LastSeen      *time.Time `json:"last_seen"`
+}
+
+var playerCSVHeader = []string{
+	"id", "name", "nickname", "preferred_role", "active",
+	"wins", "survives", "full_rotation", "created_at", "last_seen",
+}
+
+func (p exportedPlayer) csvRecord() []string {
+	lastSeen := ""
+	if p.LastSeen != nil {
+		lastSeen = p.LastSeen.UTC().Format(time.RFC3339)
+	}
+	return []string{
+		strconv.FormatInt(p.ID, 10), p.Name, p.Nickname, p.PreferredRole, strconv.FormatBool(p.Active),
+		strconv.FormatInt(p.Wins, 10), strconv.FormatInt(p.Survives, 10), strconv.FormatInt(p.FullRotation, 10),
+		p.CreatedAt.UTC().Format(time.RFC3339), lastSeen,
+	}
+}
+
+// conditions builds the filter's SQL conditions on the given time and game
+// columns; an empty gameCol skips the game filter.
+func (f exportFilter) conditions(timeCol, gameCol string) ([]string, []any) {
+	var conds []string
+	var args []any
+	if !f.From.IsZero() {
+		conds = append(conds, timeCol+" >= ?")
+		args = append(args, f.From.UTC())
+	}
+	if !f.To.IsZero() {
+		conds = append(conds, timeCol+" < ?")
+		args = append(args, f.To.UTC())
+	}
+	if len(f.GameIDs) > 0 && gameCol != "" {
+		conds = append(conds, gameCol+" IN ("+strings.TrimRight(strings.Repeat("?,", len(f.GameIDs)), ",")+")")
+		args = append(args, anySlice(f.GameIDs)...)
+	}
+	return conds, args
+}
+
+// ExportGoalEvents calls fn for every matching goal event, oldest first,
+// while the rows are read; an error from fn stops the scan.
+func (d *DB) ExportGoalEvents(ctx context.Context, f exportFilter, fn func(exportedGoalEvent) error) error {
+	if d == nil || d.sql == nil {
+		return errors.New("database disabled")
+	}
+	conds, args := f.conditions("e.created_at", "e.game_id")
+	where := ""
+	if len(conds) > 0 {
+		where = "\n WHERE " + strings.Join(conds, " AND ")
+	}
+	rows, err := d.sql.QueryContext(ctx, `SELECT e.id, e.game_id, e.seq, e.created_at, e.scoring_team,
+       rf.name, rg.name, bf.name, bg.name, bp.name, mg.name, nf.name, e.full_rotation
+  FROM goal_events e
+  JOIN players rf ON rf.id = e.red_forward_id
+  JOIN players rg ON rg.id = e.red_goalkeeper_id
+  JOIN players bf ON bf.id = e.blue_forward_id
+  JOIN players bg ON bg.id = e.blue_goalkeeper_id
+  JOIN players bp ON bp.id = e.benched_player_id
+  JOIN players mg ON mg.id = e.moved_to_goalkeeper_id
+  JOIN players nf ON nf.id = e.new_forward_id`+where+`
+ ORDER BY e.id`, args...)
+	if err != nil {
+		return err
+	}
+	defer rows.Close()
+	for rows.Next() {
+		var e exportedGoalEvent
+		var seq sql.NullInt64
+		if err := rows.Scan(&e.ID, &e.GameID, &seq, &e.At, &e.ScoringTeam,
+			&e.RedForward, &e.RedGoalkeeper, &e.BlueForward, &e.BlueGoalkeeper,
+			&e.Benched, &e.MovedToGoalkeeper, &e.NewForward, &e.FullRotation); err != nil {
+			return err
+		}
+		if seq.Valid {
+			e.Seq = &seq.Int64
+		}
+		if err := fn(e); err != nil {
+			return err
+		}
+	}
+	return rows.Err()
+}
+
+// ExportPlayers calls fn for every player, by ID. The date range applies to
+// last_seen; game IDs keep the players with a goal event in those games.
+func (d *DB) ExportPlayers(ctx context.Context, f exportFilter, fn func(exportedPlayer) error) error {
+	if d == nil || d.sql == nil {
+		return errors.New("database disabled")
+	}
+	conds, args := f.conditions("p.last_seen", "")
+	conds = append(conds, "p.merged_into IS NULL")
+	if len(f.GameIDs) > 0 {
+		conds = append(conds, `EXISTS (SELECT 1 FROM goal_events e
+                 WHERE e.game_id IN (`+strings.TrimRight(strings.Repeat("?,", len(f.GameIDs)), ",")+`)
+                   AND p.id IN (e.red_forward_id, e.red_goalkeeper_id, e.blue_forward_id, e.blue_goalkeeper_id))`)
+		args = append(args, anySlice(f.GameIDs)...)
+	}
+	rows, err := d.sql.QueryContext(ctx, `SELECT p.id, p.name, COALESCE(p.nickname, ''), COALESCE(p.preferred_role, ''), p.active,
+       p.wins, p.survives, p.full_rotation, p.created_at, p.last_seen
+  FROM players p
+ WHERE `+strings.Join(conds, " AND ")+`
+ ORDER BY p.id`, args...)
+	if err != nil {
+		return err
+	}
+	defer rows.Close()
+	for rows.Next() {
+		var p exportedPlayer
+		var lastSeen sql.NullTime
+		if err := rows.Scan(&p.ID, &p.Name, &p.Nickname, &p.PreferredRole, &p.Active,
+			&p.Wins, &p.Survives, &p.FullRotation, &p.CreatedAt, &lastSeen); err != nil {
+			return err
+		}
+		p.LastSeen = nullTimePtr(lastSeen)
+		if err := fn(p); err != nil {
+			return err
+		}
+	}
+	return rows.Err()
+}
@@ -0,0 +1,729 @@
+package main
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	mysql "github.com/go-sql-driver/mysql"
+)
+
+// playerColumns is the column list scanned by scanPlayer.
+const playerColumns = "id, name, wins, survives, full_rotation, avatar_url, nickname, preferred_role, active, merged_into"
+
+type rowScanner interface {
+	Scan(dest ...any) error
+}
+
+// scanPlayer reads a playerColumns row; mergedInto is non-zero for players
+// folded into another record.
+func scanPlayer(rs rowScanner) (p Player, mergedInto int64, err error) {
+	var merged sql.NullInt64
+	var avatar, nick, role sql.NullString
+	if err = rs.Scan(&p.ID, &p.Name, &p.Wins, &p.Survives, &p.FullRotation, &avatar, &nick, &role, &p.Active, &merged); err != nil {
+		return Player{}, 0, err
+	}
+	p.AvatarURL, p.Nickname, p.PreferredRole = avatar.String, nick.String, role.String
+	return p, merged.Int64, nil
+}
+
+// EnsurePlayer inserts the (already normalized) name if missing and returns
+// the record, following merges. created reports a fresh insert.
+func (d *DB) EnsurePlayer(ctx context.Context, name string) (Player, bool, error) {
+	if d == nil || d.sql == nil {
+		return Player{}, false, errors.New("database disabled")
+	}
+	res, err := d.sql.ExecContext(ctx,
+		"INSERT INTO players (name, last_seen) VALUES (?, ?) ON DUPLICATE KEY UPDATE last_seen=VALUES(last_seen)",
+		name, time.Now())
+	if err != nil {
+		return Player{}, false, err
+	}
+	// 1 = inserted, 2 = existing row updated, 0 = unchanged
+	n, _ := res.RowsAffected()
+	p, err := d.GetPlayerByName(ctx, name)
+	if err != nil {
+		return Player{}, false, err
+	}
+	return p, n == 1, nil
+}
+
+// GetPlayer returns a player by ID, following merges to the surviving record.
+func (d *DB) GetPlayer(ctx context.Context, id int64) (Player, error) {
+	if d == nil || d.sql == nil {
+		return Player{}, errors.New("database disabled")
+	}
+	for i := 0; i < 8; i++ {
+		p, into, err := scanPlayer(d.sql.QueryRowContext(ctx, "SELECT "+playerColumns+" FROM players WHERE id = ?", id))
+		if err != nil {
+			if err == sql.ErrNoRows {
+				return Player{}, errPlayerNotFound
+			}
+			return Player{}, err
+		}
+		if into == 0 {
+			return p, nil
+		}
+		id = into
+	}
+	return Player{}, fmt.Errorf("player %d: merge chain too long", id)
+}
+
+// GetPlayerByName returns the player with the given name (collation-insensitive),
+// following merges so a merged-away name still resolves.
+func (d *DB) GetPlayerByName(ctx context.Context, name string) (Player, error) {
+	if d == nil || d.sql == nil {
+		return Player{}, errors.New("database disabled")
+	}
+	p, into, err := scanPlayer(d.sql.QueryRowContext(ctx, "SELECT "+playerColumns+" FROM players WHERE name = ?", name))
+	if err != nil {
+		if err == sql.ErrNoRows {
+			return Player{}, errPlayerNotFound
+		}
+		return Player{}, err
+	}
+	if into != 0 {
+		return d.GetPlayer(ctx, into)
+	}
+	return p, nil
+}
+
+// GetPlayersByIDs returns player rows keyed by ID.
+func (d *DB) GetPlayersByIDs(ctx context.Context, ids []int64) (map[int64]Player, error) {
+	if d == nil || d.sql == nil {
+		return map[int64]Player{}, nil
+	}
+	ids = uniqIDs(append([]int64(nil), ids...))
+	if len(ids) == 0 {
+		return map[int64]Player{}, nil
+	}
+	placeholders := strings.TrimRight(strings.Repeat("?,", len(ids)), ",")
+	rows, err := d.sql.QueryContext(ctx,
+		fmt.Sprintf("SELECT %s FROM players WHERE id IN (%s)", playerColumns, placeholders), anySliceInt64(ids)...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	out := make(map[int64]Player, len(ids))
+	for rows.Next() {
+		p, _, err := scanPlayer(rows)
+		if err != nil {
+			return nil, err
+		}
+		out[p.ID] = p
+	}
+	return out, rows.Err()
+}
+
+// RenamePlayer changes the display name of a player.
+func (d *DB) RenamePlayer(ctx context.Context, id int64, name string) (Player, error) {
+	if d == nil || d.sql == nil {
+		return Player{}, errors.New("database disabled")
+	}
+	p, err := d.GetPlayer(ctx, id)
+	if err != nil {
+		return Player{}, err
+	}
+	if _, err := d.sql.ExecContext(ctx, "UPDATE players SET name = ? WHERE id = ?", name, p.ID); err != nil {
+		var me *mysql.MySQLError
+		if errors.As(err, &me) && me.Number == 1062 {
+			return Player{}, errPlayerNameTaken
+		}
+		return Player{}, err
+	}
+	p.Name = name
+	return p, nil
+}
+
+// playerProfile holds optional profile fields; nil pointers are left unchanged.
+type playerProfile struct {
+	AvatarURL     *string
+	Nickname      *string
+	PreferredRole *string
+}
+
+func (pp playerProfile) empty() bool {
+	return pp.AvatarURL == nil && pp.Nickname == nil && pp.PreferredRole == nil
+}
+
+// UpdatePlayerProfile sets the provided profile fields (empty strings clear them).
+func (d *DB) UpdatePlayerProfile(ctx context.Context, id int64, pp playerProfile) (Player, error) {
+	if d == nil || d.sql == nil {
+		return Player{}, errors.New("database disabled")
+	}
+	var sets []string
+	var args []any
+	add := func(col string, v *string) {
+		if v == nil {
+			return
+		}
+		sets = append(sets, col+" = ?")
+		if *v == "" {
+			args = append(args, nil)
+		} else {
+			args = append(args, *v)
+		}
+	}
+	add("avatar_url", pp.AvatarURL)
+	add("nickname", pp.Nickname)
+	add("preferred_role", pp.PreferredRole)
+	if len(sets) > 0 {
+		args = append(args, id)
+		if _, err := d.sql.ExecContext(ctx, "UPDATE players SET "+strings.Join(sets, ", ")+" WHERE id = ?", args...); err != nil {
+			return Player{}, err
+		}
+	}
+	return d.GetPlayer(ctx, id)
+}
+
+// goalEventPlayerColumns lists every goal_events column referencing players.
+var goalEventPlayerColumns = []string{
+	"red_forward_id", "red_goalkeeper_id", "blue_forward_id", "blue_goalkeeper_id",
+	"benched_player_id", "moved_to_goalkeeper_id", "new_forward_id",
+}
+
+// lineupEventPlayerColumns lists every lineup_events column referencing players.
+var lineupEventPlayerColumns = []string{"forward_id", "goalkeeper_id", "player_out_id", "player_in_id"}
+
+// seasonTeamPlayerColumns lists every season_teams column referencing players.
+var seasonTeamPlayerColumns = []string{"forward_id", "goalkeeper_id"}
+
+// MergePlayers folds player from into player into: goal events are
+// re-pointed, counters are added up, and from is kept as a zeroed row with
+// merged_into set so its name (and queued writes using its ID) still
+// resolve to into.
+func (d *DB) MergePlayers(ctx context.Context, from, into int64) (Player, error) {
+	if d == nil || d.sql == nil {
+		return Player{}, errors.New("database disabled")
+	}
+	src, err := d.GetPlayer(ctx, from)
+	if err != nil {
+		return Player{}, err
+	}
+	dst, err := d.GetPlayer(ctx, into)
+	if err != nil {
+		return Player{}, err
+	}
+	if src.ID == dst.ID {
+		return Player{}, errors.New("cannot merge a player into itself")
+	}
+	tx, err := d.sql.BeginTx(ctx, nil)
+	if err != nil {
+		return Player{}, err
+	}
+	defer func() { _ = tx.Rollback() }()
+
+	for _, col := range goalEventPlayerColumns {
+		if _, err := tx.ExecContext(ctx, fmt.Sprintf("UPDATE goal_events SET %s = ? WHERE %s = ?", col, col), dst.ID, src.ID); err != nil {
+			return Player{}, err
+		}
+	}
+	for _, col := range lineupEventPlayerColumns {
+		if _, err := tx.ExecContext(ctx, fmt.Sprintf("UPDATE lineup_events SET %s = ? WHERE %s = ?", col, col), dst.ID, src.ID); err != nil {
+			return Player{}, err
+		}
+	}
+	for _, col := range seasonTeamPlayerColumns {
+		if _, err := tx.ExecContext(ctx, fmt.Sprintf("UPDATE season_teams SET %s = ? WHERE %s = ?", col, col), dst.ID, src.ID); err != nil {
+			return Player{}, err
+		}
+	}
+	if _, err := tx.ExecContext(ctx,
+		`UPDATE players dst JOIN players src ON src.id = ?
+            SET dst.wins = dst.wins + src.wins,
+                dst.survives = dst.survives + src.survives,
+                dst.full_rotation = dst.full_rotation + src.full_rotation,
+                dst.last_seen = GREATEST(COALESCE(dst.last_seen, src.last_seen), COALESCE(src.last_seen, dst.last_seen))
+          WHERE dst.id = ?`, src.ID, dst.ID); err != nil {
+		return Player{}, err
+	}
+	if _, err := tx.ExecContext(ctx,
+		"UPDATE players SET wins = 0, survives = 0, full_rotation = 0, merged_into = ? WHERE id = ? OR merged_into = ?",
+		dst.ID, src.ID, src.ID); err != nil {
+		return Player{}, err
+	}
+	if err := tx.Commit(); err != nil {
+		return Player{}, err
+	}
+	return d.GetPlayer(ctx, dst.ID)
+}
+
+// canonicalIDs maps each ID to the record it was merged into (or itself).
+func (d *DB) canonicalIDs(ctx context.Context, ids []int64) (map[int64]int64, error) {
+	out := make(map[int64]int64, len(ids))
+	for _, id := range ids {
+		out[id] = id
+	}
+	if len(ids) == 0 {
+		return out, nil
+	}
+	placeholders := strings.TrimRight(strings.Repeat("?,", len(ids)), ",")
+	rows, err := d.sql.QueryContext(ctx,
+		fmt.Sprintf("SELECT id, merged_into FROM players WHERE id IN (%s) AND merged_into IS NOT NULL", placeholders), anySliceInt64(ids)...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	for rows.Next() {
+		var id, into int64
+		if err := rows.Scan(&id, &into); err != nil {
+			return nil, err
+		}
+		out[id] = into
+	}
+	return out, rows.Err()
+}
+
+// playerIDs maps the player references stored in a queued op to IDs. Ops
+// carry stable IDs; ops queued before IDs existed carry names, which are
+// upserted as before.
+func (d *DB) playerIDs(ctx context.Context, refs []string) (map[string]int64, error) {
+	out := make(map[string]int64, len(refs))
+	var ids []int64
+	var names []string
+	for _, ref := range refs {
+		if strings.TrimSpace(ref) == "" {
+			continue
+		}
+		if id, ok := playerRefID(ref); ok {
+			ids = append(ids, id)
+		} else {
+			names = append(names, ref)
+		}
+	}
+	canon, err := d.canonicalIDs(ctx, ids)
+	if err != nil {
+		return nil, err
+	}
+	for _, ref := range refs {
+		if id, ok := playerRefID(ref); ok {
+			out[ref] = canon[id]
+		}
+	}
+	if len(names) > 0 {
+		byName, err := d.EnsurePlayers(ctx, names)
+		if err != nil {
+			return nil, err
+		}
+		for n, id := range byName {
+			out[n] = id
+		}
+	}
+	return out, nil
+}
+
+// SetPlayerActive deactivates or reactivates a player.
+func (d *DB) SetPlayerActive(ctx context.Context, id int64, active bool) (Player, error) {
+	if d == nil || d.sql == nil {
+		return Player{}, errors.New("database disabled")
+	}
+	p, err := d.GetPlayer(ctx, id)
+	if err != nil {
+		return Player{}, err
+	}
+	if active {
+		_, err = d.sql.ExecContext(ctx, "UPDATE players SET active = 1, deactivated_at = NULL WHERE id = ? AND anonymized_at IS NULL", p.ID)
+	} else {
+		_, err = d.sql.ExecContext(ctx, "UPDATE players SET active = 0, deactivated_at = COALESCE(deactivated_at, ?) WHERE id = ?", time.Now(), p.ID)
+	}
+	if err != nil {
+		return Player{}, err
+	}
+	return d.GetPlayer(ctx, p.ID)
+}
+
+// GetPlayerPIN returns the player's PIN hash ("" when none is set).
+func (d *DB) GetPlayerPIN(ctx context.Context, id int64) (string, error) {
+	if d == nil || d.sql == nil {
+		return "", errors.New("database disabled")
+	}
+	var h sql.NullString
+	err := d.sql.QueryRowContext(ctx, "SELECT pin_hash FROM players WHERE id = ?", id).Scan(&h)
+	if errors.Is(err, sql.ErrNoRows) {
+		return "", errPlayerNotFound
+	}
+	if err != nil {
+		return "", err
+	}
+	return h.String, nil
+}
+
+// SetPlayerPIN stores a PIN hash; an empty hash clears the PIN.
+func (d *DB) SetPlayerPIN(ctx context.Context, id int64, hash string) error {
+	if d == nil || d.sql == nil {
+		return errors.New("database disabled")
+	}
+	res, err := d.sql.ExecContext(ctx, "UPDATE players SET pin_hash = ? WHERE id = ?", sql.NullString{String: hash, Valid: hash != ""}, id)
+	if err != nil {
+		return err
+	}
+	if n, _ := res.RowsAffected(); n == 0 {
+		// RowsAffected is 0 for an unchanged value too; check the row exists
+		if _, err := d.GetPlayerPIN(ctx, id); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// AnonymizePlayer erases personal data while keeping the row (and thus goal
+// events and aggregate stats) intact: the name becomes a placeholder,
+// profile fields and the PIN are cleared, API tokens bound to the player
+// are revoked, Slack links removed and the player is deactivated. Rows merged into this player
+// are scrubbed too.
+func (d *DB) AnonymizePlayer(ctx context.Context, id int64) (Player, error) {
+	if d == nil || d.sql == nil {
+		return Player{}, errors.New("database disabled")
+	}
+	p, err := d.GetPlayer(ctx, id)
+	if err != nil {
+		return Player{}, err
+	}
+	now := time.Now()
+	tx, err := d.sql.BeginTx(ctx, nil)
+	if err != nil {
+		return Player{}, err
+	}
+	defer func() { _ = tx.Rollback() }()
+	if _, err := tx.ExecContext(ctx,
+		`UPDATE api_tokens SET revoked_at = ?
+          WHERE revoked_at IS NULL AND (player_id = ? OR player_id IN (SELECT id FROM players WHERE merged_into = ?))`,
+		now, p.ID, p.ID); err != nil {
+		return Player{}, err
+	}
+	if _, err := tx.ExecContext(ctx,
+		"DELETE FROM slack_links WHERE player_id = ? OR player_id IN (SELECT id FROM players WHERE merged_into = ?)", p.ID, p.ID); err != nil {
+		return Player{}, err
+	}
+	if _, err := tx.ExecContext(ctx,
+		`UPDATE players SET name = CONCAT('Former player #', id), avatar_url = NULL, nickname = NULL, preferred_role = NULL, pin_hash = NULL,
+                            active = 0, deactivated_at = COALESCE(deactivated_at, ?), anonymized_at = ?, last_seen = NULL
+          WHERE id = ? OR merged_into = ?`, now, now, p.ID, p.ID); err != nil {
+		return Player{}, err
+	}
+	if err := tx.Commit(); err != nil {
+		return Player{}, err
+	}
+	return d.GetPlayer(ctx, p.ID)
+}
+
+// playerRecord is the full players row, as returned by the data export.
+type playerRecord struct {
+	Player
+	CreatedAt     time.Time  `json:"created_at"`
+	LastSeen      *time.Time `json:"last_seen"`
+	DeactivatedAt *time.Time `json:"deactivated_at"`
+	AnonymizedAt  *time.Time `json:"anonymized_at"`
+}
+
+// playerGoalEvent is a goal event seen from one player's perspective.
+type playerGoalEvent struct {
+	ID          int64     `json:"id"`
+	GameID      string    `json:"game_id"`
+	Seq         *int64    `json:"seq,omitempty"`
+	ScoringTeam string    `json:"scoring_team"`
+	Roles       []string  `json:"roles"`
+	Won         bool      `json:"won"`
+	CreatedAt   time.Time `json:"created_at"`
+}
+
+// playerLineupEvent is a lineup change seen from one player's perspective.
+type playerLineupEvent struct {
+	ID        int64     `json:"id"`
+	GameID    string    `json:"game_id"`
+	Seq       *int64    `json:"seq,omitempty"`
+	Kind      string    `json:"kind"`
+	Team      string    `json:"team"`
+	Roles     []string  `json:"roles"`
+	CreatedAt time.Time `json:"created_at"`
+}
+
+// playerSeasonTeam is a season team the player is registered in.
+type playerSeasonTeam struct {
+	ID       int64  `json:"id"`
+	SeasonID int64  `json:"season_id"`
+	Season   string `json:"season"`
+	Name     string `json:"name"`
+	Position string `json:"position"`
+}
+
+// playerToken is an API token bound to the player; the secret hash is left out.
+type playerToken struct {
+	ID        string     `json:"id"`
+	Role      string     `json:"role"`
+	Label     string     `json:"label"`
+	CreatedAt time.Time  `json:"created_at"`
+	RevokedAt *time.Time `json:"revoked_at"`
+}
+
+// playerExport is everything stored about a player.
+type playerExport struct {
+	Player       playerRecord        `json:"player"`
+	Aliases      []string            `json:"aliases"`
+	GoalEvents   []playerGoalEvent   `json:"goal_events"`
+	LineupEvents []playerLineupEvent `json:"lineup_events"`
+	SeasonTeams  []playerSeasonTeam  `json:"season_teams"`
+	// Tokens issued to the player or to a player merged into them
+	APITokens []playerToken `json:"api_tokens"`
+	// Slack users acting as the player
+	SlackUserIDs []string `json:"slack_user_ids"`
+	// Whether a PIN is set; the hash itself is not exported
+	PINSet bool `json:"pin_set"`
+	// In-memory games the player currently takes part in
+	CurrentGames []string `json:"current_games"`
+}
+
+// ExportPlayer collects the player's row, names merged into it, every goal
+// and lineup event they took part in, their season teams, API tokens, Slack
+// links and whether a PIN is set. Secret hashes are never included.
+func (d *DB) ExportPlayer(ctx context.Context, id int64) (playerExport, error) {
+	var out playerExport
+	if d == nil || d.sql == nil {
+		return out, errors.New("database disabled")
+	}
+	p, err := d.GetPlayer(ctx, id)
+	if err != nil {
+		return out, err
+	}
+	out.Player.Player = p
+	var lastSeen, deactivated, anonymized sql.NullTime
+	if err := d.sql.QueryRowContext(ctx,
+		"SELECT created_at, last_seen, deactivated_at, anonymized_at, pin_hash IS NOT NULL AND pin_hash <> '' FROM players WHERE id = ?", p.ID,
+	).Scan(&out.Player.CreatedAt, &lastSeen, &deactivated, &anonymized, &out.PINSet); err != nil {
+		return out, err
+	}
+	out.Player.LastSeen = nullTimePtr(lastSeen)
+	out.Player.DeactivatedAt = nullTimePtr(deactivated)
+	out.Player.AnonymizedAt = nullTimePtr(anonymized)
+
+	out.Aliases = []string{}
+	rows, err := d.sql.QueryContext(ctx, "SELECT name FROM players WHERE merged_into = ? ORDER BY id", p.ID)
+	if err != nil {
+		return out, err
+	}
+	for rows.Next() {
+		var n string
+		if err := rows.Scan(&n); err != nil {
+			rows.Close()
+			return out, err
+		}
+		out.Aliases = append(out.Aliases, n)
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return out, err
+	}
+
+	out.GoalEvents = []playerGoalEvent{}
+	cond := make([]string, len(goalEventPlayerColumns))
+	args := make([]any, len(goalEventPlayerColumns))
+	for i, col := range goalEventPlayerColumns {
+		cond[i] = col + " = ?"
+		args[i] = p.ID
+	}
+	rows, err = d.sql.QueryContext(ctx,
+		fmt.Sprintf(`SELECT id, game_id, seq, scoring_team, %s, created_at FROM goal_events WHERE %s ORDER BY id`,
+			strings.Join(goalEventPlayerColumns, ", "), strings.Join(cond, " OR ")), args...)
+	if err != nil {
+		return out, err
+	}
+	for rows.Next() {
+		var ev playerGoalEvent
+		var seq sql.NullInt64
+		ids := make([]int64, len(goalEventPlayerColumns))
+		dest := []any{&ev.ID, &ev.GameID, &seq, &ev.ScoringTeam}
+		for i := range ids {
+			dest = append(dest, &ids[i])
+		}
+		dest = append(dest, &ev.CreatedAt)
+		if err := rows.Scan(dest...); err != nil {
+			rows.Close()
+			return out, err
+		}
+		if seq.Valid {
+			ev.Seq = &seq.Int64
+		}
+		for i, col := range goalEventPlayerColumns {
+			if ids[i] == p.ID {
+				ev.Roles = append(ev.Roles, strings.TrimSuffix(col, "_id"))
+			}
+		}
+		// Columns 0-1 are red (pre-rotation), 2-3 blue
+		ev.Won = (ev.ScoringTeam == "red" && (ids[0] == p.ID || ids[1] == p.ID)) ||
+			(ev.ScoringTeam == "blue" && (ids[2] == p.ID || ids[3] == p.ID))
+		out.GoalEvents = append(out.GoalEvents, ev)
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return out, err
+	}
+
+	if out.LineupEvents, err = d.playerLineupEvents(ctx, p.ID); err != nil {
+		return out, err
+	}
+	if out.SeasonTeams, err = d.playerSeasonTeams(ctx, p.ID); err != nil {
+		return out, err
+	}
+	if out.APITokens, err = d.playerTokens(ctx, p.ID); err != nil {
+		return out, err
+	}
+	out.SlackUserIDs, err = d.playerSlackLinks(ctx, p.ID)
+	return out, err
+}
+
+// playerLineupEvents lists the lineup changes involving the player.
+func (d *DB) playerLineupEvents(ctx context.Context, id int64) ([]playerLineupEvent, error) {
+	cond := make([]string, len(lineupEventPlayerColumns))
+	args := make([]any, len(lineupEventPlayerColumns))
+	for i, col := range lineupEventPlayerColumns {
+		cond[i] = col + " = ?"
+		args[i] = id
+	}
+	rows, err := d.sql.QueryContext(ctx,
+		fmt.Sprintf(`SELECT id, game_id, seq, kind, team, %s, created_at FROM lineup_events WHERE %s ORDER BY id`,
+			strings.Join(lineupEventPlayerColumns, ", "), strings.Join(cond, " OR ")), args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	out := []playerLineupEvent{}
+	for rows.Next() {
+		var ev playerLineupEvent
+		var seq sql.NullInt64
+		ids := make([]sql.NullInt64, len(lineupEventPlayerColumns))
+		dest := []any{&ev.ID, &ev.GameID, &seq, &ev.Kind, &ev.Team}
+		for i := range ids {
+			dest = append(dest, &ids[i])
+		}
+		dest = append(dest, &ev.CreatedAt)
+		if err := rows.Scan(dest...); err != nil {
+			return nil, err
+		}
+		if seq.Valid {
+			ev.Seq = &seq.Int64
+		}
+		for i, col := range lineupEventPlayerColumns {
+			if ids[i].Valid && ids[i].Int64 == id {
+				ev.Roles = append(ev.Roles, strings.TrimSuffix(col, "_id"))
+			}
+		}
+		out = append(out, ev)
+	}
+	return out, rows.Err()
+}
+
+// playerSeasonTeams lists the season teams the player is registered in.
+func (d *DB) playerSeasonTeams(ctx context.Context, id int64) ([]playerSeasonTeam, error) {
+	rows, err := d.sql.QueryContext(ctx, `SELECT t.id, t.season_id, s.name, t.name, IF(t.forward_id = ?, 'forward', 'goalkeeper')
+  FROM season_teams t JOIN seasons s ON s.id = t.season_id
+ WHERE t.forward_id = ? OR t.goalkeeper_id = ?
+ ORDER BY t.id`, id, id, id)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	out := []playerSeasonTeam{}
+	for rows.Next() {
+		var t playerSeasonTeam
+		if err := rows.Scan(&t.ID, &t.SeasonID, &t.Season, &t.Name, &t.Position); err != nil {
+			return nil, err
+		}
+		out = append(out, t)
+	}
+	return out, rows.Err()
+}
+
+// playerSlackLinks lists the Slack user IDs linked to the player.
+func (d *DB) playerSlackLinks(ctx context.Context, id int64) ([]string, error) {
+	rows, err := d.sql.QueryContext(ctx, "SELECT slack_user_id FROM slack_links WHERE player_id = ? ORDER BY created_at", id)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	out := []string{}
+	for rows.Next() {
+		var u string
+		if err := rows.Scan(&u); err != nil {
+			return nil, err
+		}
+		out = append(out, u)
+	}
+	return out, rows.Err()
+}
+
+// playerTokens lists the API tokens bound to the player or to a player
+// merged into them, without their hashes.
+func (d *DB) playerTokens(ctx context.Context, id int64) ([]playerToken, error) {
+	rows, err := d.sql.QueryContext(ctx, `SELECT id, role, label, created_at, revoked_at FROM api_tokens
+ WHERE player_id = ? OR player_id IN (SELECT id FROM players WHERE merged_into = ?)
+ ORDER BY created_at`, id, id)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	out := []playerToken{}
+	for rows.Next() {
+		var t playerToken
+		var revoked sql.NullTime
+		if err := rows.Scan(&t.ID, &t.Role, &t.Label, &t.CreatedAt, &revoked); err != nil {
+			return nil, err
+		}
+		t.RevokedAt = nullTimePtr(revoked)
+		out = append(out, t)
+	}
+	return out, rows.Err()
+}
+
+func nullTimePtr(t sql.NullTime) *time.Time {
+	if !t.Valid {
+		return nil
+	}
+	return &t.Time
+}
+
+// goalRecord counts the goal events a player took part in and how many
+// their side scored.
+type goalRecord struct {
+	Played int64
+	Won    int64
+}
+
+// GoalRecords returns the goal record of each player from goal_events.
+func (d *DB) GoalRecords(ctx context.Context, ids []int64) (map[int64]goalRecord, error) {
+	out := map[int64]goalRecord{}
+	if d == nil || d.sql == nil {
+		return out, nil
+	}
+	ids = uniqIDs(append([]int64(nil), ids...))
+	if len(ids) == 0 {
+		return out, nil
+	}
+	placeholders := strings.TrimRight(strings.Repeat("?,", len(ids)), ",")
+	var parts []string
+	var args []any
+	for _, side := range []string{"red", "blue"} {
+		for _, pos := range []string{"forward", "goalkeeper"} {
+			col := side + "_" + pos + "_id"
+			parts = append(parts, fmt.Sprintf("SELECT %s AS player_id, scoring_team = '%s' AS won FROM goal_events WHERE %s IN (%s)", col, side, col, placeholders))
+			args = append(args, anySliceInt64(ids)...)
+		}
+	}
+	rows, err := d.sql.QueryContext(ctx,
+		"SELECT player_id, COUNT(*), SUM(won) FROM ("+strings.Join(parts, " UNION ALL ")+") x GROUP BY player_id", args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	for rows.Next() {
+		var id int64
+		var r goalRecord
+		if err := rows.Scan(&id, &r.Played, &r.Won); err != nil {
+			return nil, err
+		}
+		out[id] = r
+	}
+	return out, rows.Err()
+}
@@ -0,0 +1,378 @@
+package main
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	mysql "github.com/go-sql-driver/mysql"
+)
+
+var (
+	errSeasonNotFound  = errors.New("season not found")
+	errFixtureNotFound = errors.New("fixture not found")
+	errSeasonNameTaken = errors.New("season name already taken")
+)
+
+// League points per result
+const (
+	pointsWin  = 3
+	pointsDraw = 1
+	pointsLoss = 0
+)
+
+// seasonDateLayout is how season dates are sent and stored (DATE columns).
+const seasonDateLayout = "2006-01-02"
+
+type season struct {
+	ID       int64        `json:"id"`
+	Name     string       `json:"name"`
+	StartsOn string       `json:"starts_on"`
+	EndsOn   string       `json:"ends_on"`
+	Legs     int          `json:"legs"`
+	Teams    []seasonTeam `json:"teams"`
+	// Fixture counts
+	Fixtures  int       `json:"fixtures"`
+	Played    int       `json:"played"`
+	CreatedAt time.Time `json:"created_at"`
+}
+
+// seasonTeam is a participant: a fixed pair of players.
+type seasonTeam struct {
+	ID         int64  `json:"id"`
+	Name       string `json:"name"`
+	Forward    string `json:"forward"`
+	Goalkeeper string `json:"goalkeeper"`
+}
+
+type seasonFixture struct {
+	ID          int64      `json:"id"`
+	Round       int        `json:"round"`
+	ScheduledOn string     `json:"scheduled_on"`
+	HomeTeamID  int64      `json:"home_team_id"`
+	AwayTeamID  int64      `json:"away_team_id"`
+	HomeScore   *int       `json:"home_score"`
+	AwayScore   *int       `json:"away_score"`
+	PlayedAt    *time.Time `json:"played_at"`
+}
+
+type seasonStanding struct {
+	Position       int    `json:"position"`
+	TeamID         int64  `json:"team_id"`
+	Name           string `json:"name"`
+	Played         int    `json:"played"`
+	Won            int    `json:"won"`
+	Drawn          int    `json:"drawn"`
+	Lost           int    `json:"lost"`
+	GoalsFor       int    `json:"goals_for"`
+	GoalsAgainst   int    `json:"goals_against"`
+	GoalDifference int    `json:"goal_difference"`
+	Points         int    `json:"points"`
+}
+
+// seasonFixtures schedules a round robin between n teams (by index), legs
+// times with home and away swapped on the second leg, spreading the rounds
+// evenly over the season's dates.
+func seasonFixtures(n, legs int, start, end time.Time) []seasonFixture {
+	rounds := roundRobinRounds(n)
+	total := len(rounds) * legs
+	days := int(end.Sub(start).Hours() / 24)
+	var out []seasonFixture
+	for leg := 0; leg < legs; leg++ {
+		for r, round := range rounds {
+			num := leg*len(rounds) + r + 1
+			on := start
+			if total > 1 {
+				on = start.AddDate(0, 0, (num-1)*days/(total-1))
+			}
+			for _, p := range round {
+				home, away := p[0], p[1]
+				if leg%2 == 1 {
+					home, away = away, home
+				}
+				out = append(out, seasonFixture{
+					Round:       num,
+					ScheduledOn: on.Format(seasonDateLayout),
+					HomeTeamID:  int64(home),
+					AwayTeamID:  int64(away),
+				})
+			}
+		}
+	}
+	return out
+}
+
+// CreateSeason stores a season with its teams and fixtures (team IDs in
+// fixtures are indexes into s.Teams) and an empty standings table.
+func (d *DB) CreateSeason(ctx context.Context, s season, fixtures []seasonFixture) (season, error) {
+	if d == nil || d.sql == nil {
+		return season{}, errors.New("database disabled")
+	}
+	tx, err := d.sql.BeginTx(ctx, nil)
+	if err != nil {
+		return season{}, err
+	}
+	defer func() { _ = tx.Rollback() }()
+
+	res, err := tx.ExecContext(ctx, "INSERT INTO seasons (name, starts_on, ends_on, legs) VALUES (?, ?, ?, ?)",
+		s.Name, s.StartsOn, s.EndsOn, s.Legs)
+	if err != nil {
+		var me *mysql.MySQLError
+		if errors.As(err, &me) && me.Number == 1062 {
+			return season{}, errSeasonNameTaken
+		}
+		return season{}, err
+	}
+	if s.ID, err = res.LastInsertId(); err != nil {
+		return season{}, err
+	}
+	teamIDs := make([]int64, len(s.Teams))
+	for i, t := range s.Teams {
+		fid, _ := playerRefID(t.Forward)
+		gid, _ := playerRefID(t.Goalkeeper)
+		res, err := tx.ExecContext(ctx, "INSERT INTO season_teams (season_id, name, forward_id, goalkeeper_id) VALUES (?, ?, ?, ?)",
+			s.ID, t.Name, fid, gid)
+		if err != nil {
+			return season{}, err
+		}
+		if teamIDs[i], err = res.LastInsertId(); err != nil {
+			return season{}, err
+		}
+		if _, err := tx.ExecContext(ctx, "INSERT INTO season_standings (season_id, team_id) VALUES (?, ?)", s.ID, teamIDs[i]); err != nil {
+			return season{}, err
+		}
+	}
+	for _, f := range fixtures {
+		if _, err := tx.ExecContext(ctx,
+			"INSERT INTO season_fixtures (season_id, round, scheduled_on, home_team_id, away_team_id) VALUES (?, ?, ?, ?, ?)",
+			s.ID, f.Round, f.ScheduledOn, teamIDs[f.HomeTeamID], teamIDs[f.AwayTeamID]); err != nil {
+			return season{}, err
+		}
+	}
+	if err := tx.Commit(); err != nil {
+		return season{}, err
+	}
+	return d.GetSeason(ctx, s.ID)
+}
+
+const seasonColumns = `s.id, s.name, s.starts_on, s.ends_on, s.legs, s.created_at,
+	(SELECT COUNT(*) FROM season_fixtures f WHERE f.season_id = s.id),
+	(SELECT COUNT(*) FROM season_fixtures f WHERE f.season_id = s.id AND f.played_at IS NOT NULL)`
+
+func scanSeason(rs rowScanner) (season, error) {
+	var s season
+	var starts, ends time.Time
+	if err := rs.Scan(&s.ID, &s.Name, &starts, &ends, &s.Legs, &s.CreatedAt, &s.Fixtures, &s.Played); err != nil {
+		return season{}, err
+	}
+	s.StartsOn, s.EndsOn = starts.Format(seasonDateLayout), ends.Format(seasonDateLayout)
+	s.Teams = []seasonTeam{}
+	return s, nil
+}
+
+// ListSeasons returns all seasons, latest first (without teams).
+func (d *DB) ListSeasons(ctx context.Context) ([]season, error) {
+	if d == nil || d.sql == nil {
+		return nil, errors.New("database disabled")
+	}
+	rows, err := d.sql.QueryContext(ctx, "SELECT "+seasonColumns+" FROM seasons s ORDER BY s.starts_on DESC, s.id DESC")
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	out := []season{}
+	for rows.Next() {
+		s, err := scanSeason(rows)
+		if err != nil {
+			return nil, err
+		}
+		out = append(out, s)
+	}
+	return out, rows.Err()
+}
+
+// GetSeason returns a season with its teams.
+func (d *DB) GetSeason(ctx context.Context, id int64) (season, error) {
+	if d == nil || d.sql == nil {
+		return season{}, errors.New("database disabled")
+	}
+	s, err := scanSeason(d.sql.QueryRowContext(ctx, "SELECT "+seasonColumns+" FROM seasons s WHERE s.id = ?", id))
+	if err != nil {
+		if err == sql.ErrNoRows {
+			return season{}, errSeasonNotFound
+		}
+		return season{}, err
+	}
+	rows, err := d.sql.QueryContext(ctx,
+		"SELECT id, name, forward_id, goalkeeper_id FROM season_teams WHERE season_id = ? ORDER BY id", id)
+	if err != nil {
+		return season{}, err
+	}
+	defer rows.Close()
+	for rows.Next() {
+		var t seasonTeam
+		var fid, gid int64
+		if err := rows.Scan(&t.ID, &t.Name, &fid, &gid); err != nil {
+			return season{}, err
+		}
+		t.Forward, t.Goalkeeper = formatPlayerID(fid), formatPlayerID(gid)
+		s.Teams = append(s.Teams, t)
+	}
+	return s, rows.Err()
+}
+
+const fixtureColumns = "id, round, scheduled_on, home_team_id, away_team_id, home_score, away_score, played_at"
+
+func scanFixture(rs rowScanner) (seasonFixture, error) {
+	var f seasonFixture
+	var on time.Time
+	var home, away sql.NullInt64
+	var played sql.NullTime
+	if err := rs.Scan(&f.ID, &f.Round, &on, &f.HomeTeamID, &f.AwayTeamID, &home, &away, &played); err != nil {
+		return seasonFixture{}, err
+	}
+	f.ScheduledOn = on.Format(seasonDateLayout)
+	if home.Valid && away.Valid {
+		h, a := int(home.Int64), int(away.Int64)
+		f.HomeScore, f.AwayScore = &h, &a
+	}
+	f.PlayedAt = nullTimePtr(played)
+	return f, nil
+}
+
+// ListFixtures returns a season's fixtures in schedule order, optionally
+// only one round (round > 0) or one team's (teamID > 0).
+func (d *DB) ListFixtures(ctx context.Context, seasonID int64, round int, teamID int64) ([]seasonFixture, error) {
+	if d == nil || d.sql == nil {
+		return nil, errors.New("database disabled")
+	}
+	where := []string{"season_id = ?"}
+	args := []any{seasonID}
+	if round > 0 {
+		where = append(where, "round = ?")
+		args = append(args, round)
+	}
+	if teamID > 0 {
+		where = append(where, "(home_team_id = ? OR away_team_id = ?)")
+		args = append(args, teamID, teamID)
+	}
+	rows, err := d.sql.QueryContext(ctx,
+		fmt.Sprintf("SELECT %s FROM season_fixtures WHERE %s ORDER BY round, id", fixtureColumns, strings.Join(where, " AND ")), args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	out := []seasonFixture{}
+	for rows.Next() {
+		f, err := scanFixture(rows)
+		if err != nil {
+			return nil, err
+		}
+		out = append(out, f)
+	}
+	return out, rows.Err()
+}
+
+// RecordFixtureResult sets (or corrects) a fixture's score and recomputes
+// the season's standings in the same transaction.
+func (d *DB) RecordFixtureResult(ctx context.Context, seasonID, fixtureID int64, home, away int) (seasonFixture, error) {
+	if d == nil || d.sql == nil {
+		return seasonFixture{}, errors.New("database disabled")
+	}
+	tx, err := d.sql.BeginTx(ctx, nil)
+	if err != nil {
+		return seasonFixture{}, err
+	}
+	defer func() { _ = tx.Rollback() }()
+
+	res, err := tx.ExecContext(ctx,
+		"UPDATE season_fixtures SET home_score = ?, away_score = ?, played_at = COALESCE(played_at, ?) WHERE id = ? AND season_id = ?",
+		home, away, time.Now(), fixtureID, seasonID)
+	if err != nil {
+		return seasonFixture{}, err
+	}
+	if n, _ := res.RowsAffected(); n == 0 {
+		// Same score again leaves the row unchanged; tell that apart from a missing one
+		var one int
+		err := tx.QueryRowContext(ctx, "SELECT 1 FROM season_fixtures WHERE id = ? AND season_id = ?", fixtureID, seasonID).Scan(&one)
+		if err == sql.ErrNoRows {
+			return seasonFixture{}, errFixtureNotFound
+		}
+		if err != nil {
+			return seasonFixture{}, err
+		}
+	}
+	if err := recomputeStandings(ctx, tx, seasonID); err != nil {
+		return seasonFixture{}, err
+	}
+	f, err := scanFixture(tx.QueryRowContext(ctx, "SELECT "+fixtureColumns+" FROM season_fixtures WHERE id = ?", fixtureID))
+	if err != nil {
+		return seasonFixture{}, err
+	}
+	return f, tx.Commit()
+}
+
+// recomputeStandings rebuilds season_standings from the played fixtures,
+// counting each fixture once from either side.
+func recomputeStandings(ctx context.Context, tx *sql.Tx, seasonID int64) error {
+	_, err := tx.ExecContext(ctx, fmt.Sprintf(`
+		UPDATE season_standings st
+		LEFT JOIN (
+			SELECT team_id,
+			       COUNT(*) AS played,
+			       SUM(gf > ga) AS won,
+			       SUM(gf = ga) AS drawn,
+			       SUM(gf < ga) AS lost,
+			       SUM(gf) AS goals_for,
+			       SUM(ga) AS goals_against
+			  FROM (
+				SELECT home_team_id AS team_id, home_score AS gf, away_score AS ga
+				  FROM season_fixtures WHERE season_id = ? AND home_score IS NOT NULL
+				UNION ALL
+				SELECT away_team_id, away_score, home_score
+				  FROM season_fixtures WHERE season_id = ? AND home_score IS NOT NULL
+			  ) sides
+			 GROUP BY team_id
+		) agg ON agg.team_id = st.team_id
+		   SET st.played = COALESCE(agg.played, 0),
+		       st.won = COALESCE(agg.won, 0),
+		       st.drawn = COALESCE(agg.drawn, 0),
+		       st.lost = COALESCE(agg.lost, 0),
+		       st.goals_for = COALESCE(agg.goals_for, 0),
+		       st.goals_against = COALESCE(agg.goals_against, 0),
+		       st.points = COALESCE(agg.won, 0) * %d + COALESCE(agg.drawn, 0) * %d + COALESCE(agg.lost, 0) * %d
+		 WHERE st.season_id = ?`, pointsWin, pointsDraw, pointsLoss), seasonID, seasonID, seasonID)
+	return err
+}
+
+// Standings returns the season's table: points, then goal difference,
+// then goals scored.
+func (d *DB) Standings(ctx context.Context, seasonID int64) ([]seasonStanding, error) {
+	if d == nil || d.sql == nil {
+		return nil, errors.New("database disabled")
+	}
+	rows, err := d.sql.QueryContext(ctx, `
+		SELECT st.team_id, t.name, st.played, st.won, st.drawn, st.lost, st.goals_for, st.goals_against, st.points
+		  FROM season_standings st
+		  JOIN season_teams t ON t.id = st.team_id
+		 WHERE st.season_id = ?
+		 ORDER BY st.points DESC, CAST(st.goals_for AS SIGNED) - CAST(st.goals_against AS SIGNED) DESC, st.goals_for DESC, t.name`, seasonID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	out := []seasonStanding{}
+	for rows.Next() {
+		var s seasonStanding
+		if err := rows.Scan(&s.TeamID, &s.Name, &s.Played, &s.Won, &s.Drawn, &s.Lost, &s.GoalsFor, &s.GoalsAgainst, &s.Points); err != nil {
+			return nil, err
+		}
+		s.GoalDifference = s.GoalsFor - s.GoalsAgainst
+		s.Position = len(out) + 1
+		out = append(out, s)
+	}
+	return out, rows.Err()
+}
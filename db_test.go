@@ -0,0 +1,347 @@
+package main
+
+import (
+	"context"
+	"database/sql"
+	"database/sql/driver"
+	"fmt"
+	"io"
+	"slices"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+// fakeSQL is a database/sql driver that records statements and answers them
+// from a script, for testing the SQL a DB method issues without MySQL.
+type fakeSQL struct {
+	mu      sync.Mutex
+	calls   []fakeCall
+	respond func(query string, args []driver.Value) fakeResult
+}
+
+type fakeCall struct {
+	Query string
+	Args  []driver.Value
+}
+
+// fakeResult answers one statement: Cols/Rows for queries, Affected for execs.
+type fakeResult struct {
+	Cols     []string
+	Rows     [][]driver.Value
+	Affected int64
+	Err      error
+}
+
+var (
+	fakeDriverOnce sync.Once
+	fakeDBs        sync.Map // DSN -> *fakeSQL
+)
+
+type fakeDriver struct{}
+
+func (fakeDriver) Open(dsn string) (driver.Conn, error) {
+	f, ok := fakeDBs.Load(dsn)
+	if !ok {
+		return nil, fmt.Errorf("no fake database %q", dsn)
+	}
+	return &fakeConn{f.(*fakeSQL)}, nil
+}
+
+// newFakeDB returns a DB whose statements go to respond.
+func newFakeDB(t *testing.T, respond func(query string, args []driver.Value) fakeResult) (*DB, *fakeSQL) {
+	t.Helper()
+	fakeDriverOnce.Do(func() { sql.Register("kottfake", fakeDriver{}) })
+	f := &fakeSQL{respond: respond}
+	fakeDBs.Store(t.Name(), f)
+	t.Cleanup(func() { fakeDBs.Delete(t.Name()) })
+	sqldb, err := sql.Open("kottfake", t.Name())
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { _ = sqldb.Close() })
+	return &DB{sql: sqldb}, f
+}
+
+// Queries returns the recorded statements, whitespace collapsed.
+func (f *fakeSQL) Queries() []string {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	out := make([]string, len(f.calls))
+	for i, c := range f.calls {
+		out[i] = c.Query
+	}
+	return out
+}
+
+// Find returns the first recorded call containing substr.
+func (f *fakeSQL) Find(substr string) (fakeCall, bool) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	for _, c := range f.calls {
+		if strings.Contains(c.Query, substr) {
+			return c, true
+		}
+	}
+	return fakeCall{}, false
+}
+
+func (f *fakeSQL) run(query string, args []driver.Value) fakeResult {
+	query = strings.Join(strings.Fields(query), " ")
+	f.mu.Lock()
+	f.calls = append(f.calls, fakeCall{query, args})
+	f.mu.Unlock()
+	if f.respond == nil {
+		return fakeResult{}
+	}
+	return f.respond(query, args)
+}
+
+type fakeConn struct{ f *fakeSQL }
+
+func (c *fakeConn) Prepare(query string) (driver.Stmt, error) { return &fakeStmt{c.f, query}, nil }
+func (c *fakeConn) Close() error                              { return nil }
+func (c *fakeConn) Begin() (driver.Tx, error) {
+	c.f.run("BEGIN", nil)
+	return fakeTx{c.f}, nil
+}
+
+type fakeTx struct{ f *fakeSQL }
+
+func (tx fakeTx) Commit() error   { tx.f.run("COMMIT", nil); return nil }
+func (tx fakeTx) Rollback() error { tx.f.run("ROLLBACK", nil); return nil }
+
+type fakeStmt struct {
+	f     *fakeSQL
+	query string
+}
+
+func (s *fakeStmt) Close() error  { return nil }
+func (s *fakeStmt) NumInput() int { return -1 }
+func (s *fakeStmt) Exec(args []driver.Value) (driver.Result, error) {
+	r := s.f.run(s.query, args)
+	if r.Err != nil {
+		return nil, r.Err
+	}
+	return driver.RowsAffected(r.Affected), nil
+}
+func (s *fakeStmt) Query(args []driver.Value) (driver.Rows, error) {
+	r := s.f.run(s.query, args)
+	if r.Err != nil {
+		return nil, r.Err
+	}
+	return &fakeRows{cols: r.Cols, rows: r.Rows}, nil
+}
+
+type fakeRows struct {
+	cols []string
+	rows [][]driver.Value
+}
+
+func (r *fakeRows) Columns() []string { return r.cols }
+func (r *fakeRows) Close() error      { return nil }
+func (r *fakeRows) Next(dest []driver.Value) error {
+	if len(r.rows) == 0 {
+		return io.EOF
+	}
+	copy(dest, r.rows[0])
+	r.rows = r.rows[1:]
+	return nil
+}
+
+var goalEventCols = []string{"id", "scoring_team", "red_forward_id", "red_goalkeeper_id", "blue_forward_id", "blue_goalkeeper_id", "moved_to_goalkeeper_id", "full_rotation"}
+
+func TestUndoLastEvent(t *testing.T) {
+	// Event 42: red (1, 2) scored on blue (3, 4); 3 moved to goal
+	event := []driver.Value{int64(42), "red", int64(1), int64(2), int64(3), int64(4), int64(3), true}
+	tests := []struct {
+		name        string
+		seq         int64
+		lineupRows  int64 // rows the lineup_events delete removes
+		noEvent     bool
+		wantSelect  string // goal_events lookup, "" if none
+		wantReverse bool
+	}{
+		{name: "unsequenced undoes the newest event", seq: 0, wantSelect: "ORDER BY id DESC LIMIT 1", wantReverse: true},
+		{name: "sequenced undoes that goal", seq: 7, wantSelect: "AND seq = ?", wantReverse: true},
+		{name: "sequenced lineup change", seq: 7, lineupRows: 1},
+		{name: "sequenced goal already gone", seq: 7, noEvent: true, wantSelect: "AND seq = ?"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			d, f := newFakeDB(t, func(q string, args []driver.Value) fakeResult {
+				switch {
+				case strings.HasPrefix(q, "DELETE FROM lineup_events"):
+					return fakeResult{Affected: tt.lineupRows}
+				case strings.HasPrefix(q, "SELECT id, scoring_team"):
+					if tt.noEvent {
+						return fakeResult{Cols: goalEventCols}
+					}
+					return fakeResult{Cols: goalEventCols, Rows: [][]driver.Value{event}}
+				}
+				return fakeResult{Affected: 1}
+			})
+			if err := d.UndoLastEvent(context.Background(), "g1", tt.seq); err != nil {
+				t.Fatalf("UndoLastEvent: %v", err)
+			}
+
+			_, deletedLineup := f.Find("DELETE FROM lineup_events")
+			if deletedLineup != (tt.seq > 0) {
+				t.Errorf("lineup_events delete issued = %v, want %v", deletedLineup, tt.seq > 0)
+			}
+			sel, selected := f.Find("FROM goal_events WHERE game_id")
+			if tt.wantSelect == "" {
+				if selected {
+					t.Errorf("unexpected goal_events lookup: %s", sel.Query)
+				}
+			} else {
+				if !selected || !strings.Contains(sel.Query, tt.wantSelect) {
+					t.Fatalf("goal_events lookup = %q, want it to contain %q", sel.Query, tt.wantSelect)
+				}
+				if tt.seq > 0 && (len(sel.Args) != 2 || sel.Args[1] != tt.seq) {
+					t.Errorf("lookup args = %v, want seq %d", sel.Args, tt.seq)
+				}
+			}
+
+			wins, okWins := f.Find("SET wins")
+			survives, okSurvives := f.Find("SET survives")
+			fullRot, okFullRot := f.Find("SET full_rotation")
+			del, okDel := f.Find("DELETE FROM goal_events")
+			if !tt.wantReverse {
+				if okWins || okSurvives || okFullRot || okDel {
+					t.Errorf("counters or goal_events touched: %v", f.Queries())
+				}
+				return
+			}
+			if !okWins || fmt.Sprint(wins.Args) != "[1 2]" {
+				t.Errorf("wins reversed for %v, want [1 2]", wins.Args)
+			}
+			if !okSurvives || fmt.Sprint(survives.Args) != "[1 2 3]" {
+				t.Errorf("survives reversed for %v, want [1 2 3]", survives.Args)
+			}
+			if !okFullRot || fmt.Sprint(fullRot.Args) != "[1 2]" {
+				t.Errorf("full_rotation reversed for %v, want [1 2]", fullRot.Args)
+			}
+			if !okDel || fmt.Sprint(del.Args) != "[42]" {
+				t.Errorf("deleted goal event %v, want [42]", del.Args)
+			}
+			if q := f.Queries(); q[len(q)-1] != "COMMIT" {
+				t.Errorf("last statement = %q, want COMMIT", q[len(q)-1])
+			}
+		})
+	}
+}
+
+var playerCols = []string{"id", "name", "wins", "survives", "full_rotation", "avatar_url", "nickname", "preferred_role", "active", "merged_into"}
+
+func playerRow(id int64, name string) []driver.Value {
+	return []driver.Value{id, name, int64(0), int64(0), int64(0), nil, nil, nil, true, nil}
+}
+
+func TestExportPlayerRedactsSecrets(t *testing.T) {
+	created := time.Date(2026, 1, 1, 0, 0, 0, 0, time.UTC)
+	d, f := newFakeDB(t, func(q string, args []driver.Value) fakeResult {
+		switch {
+		case strings.HasPrefix(q, "SELECT "+playerColumns):
+			return fakeResult{Cols: playerCols, Rows: [][]driver.Value{playerRow(5, "Alice")}}
+		case strings.HasPrefix(q, "SELECT created_at"):
+			return fakeResult{Cols: []string{"created_at", "last_seen", "deactivated_at", "anonymized_at", "pin_set"},
+				Rows: [][]driver.Value{{created, nil, nil, nil, true}}}
+		case strings.Contains(q, "FROM lineup_events"):
+			return fakeResult{Cols: []string{"id", "game_id", "seq", "kind", "team", "forward_id", "goalkeeper_id", "player_out_id", "player_in_id", "created_at"},
+				Rows: [][]driver.Value{{int64(9), "g1", int64(3), "substitute", "red", nil, nil, int64(2), int64(5), created}}}
+		case strings.Contains(q, "FROM season_teams"):
+			return fakeResult{Cols: []string{"id", "season_id", "season", "name", "position"},
+				Rows: [][]driver.Value{{int64(1), int64(2), "Spring", "Lefties", "goalkeeper"}}}
+		case strings.Contains(q, "FROM api_tokens"):
+			return fakeResult{Cols: []string{"id", "role", "label", "created_at", "revoked_at"},
+				Rows: [][]driver.Value{{"abcd", "player", "phone", created, nil}}}
+		}
+		return fakeResult{}
+	})
+	out, err := d.ExportPlayer(context.Background(), 5)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !out.PINSet {
+		t.Error("pin_set = false, want true")
+	}
+	if len(out.LineupEvents) != 1 || fmt.Sprint(out.LineupEvents[0].Roles) != "[player_in]" {
+		t.Errorf("lineup events = %+v", out.LineupEvents)
+	}
+	if len(out.SeasonTeams) != 1 || out.SeasonTeams[0].Season != "Spring" || out.SeasonTeams[0].Position != "goalkeeper" {
+		t.Errorf("season teams = %+v", out.SeasonTeams)
+	}
+	if len(out.APITokens) != 1 || out.APITokens[0].ID != "abcd" {
+		t.Errorf("api tokens = %+v", out.APITokens)
+	}
+	for _, q := range f.Queries() {
+		if strings.Contains(q, "token_hash") || strings.Contains(q, "SELECT pin_hash") {
+			t.Errorf("export reads a secret: %s", q)
+		}
+	}
+}
+
+func TestAnonymizePlayerRevokesTokens(t *testing.T) {
+	d, f := newFakeDB(t, func(q string, args []driver.Value) fakeResult {
+		if strings.HasPrefix(q, "SELECT "+playerColumns) {
+			return fakeResult{Cols: playerCols, Rows: [][]driver.Value{playerRow(5, "Former player #5")}}
+		}
+		return fakeResult{Affected: 1}
+	})
+	if _, err := d.AnonymizePlayer(context.Background(), 5); err != nil {
+		t.Fatal(err)
+	}
+	revoke, ok := f.Find("UPDATE api_tokens SET revoked_at")
+	if !ok || len(revoke.Args) != 3 || revoke.Args[1] != int64(5) || revoke.Args[2] != int64(5) {
+		t.Errorf("token revocation = %+v, %v", revoke, ok)
+	}
+	if scrub, ok := f.Find("UPDATE players SET"); !ok || !strings.Contains(scrub.Query, "pin_hash = NULL") {
+		t.Errorf("players update = %q, want the PIN cleared", scrub.Query)
+	}
+	q := f.Queries()
+	if i := slices.Index(q, "COMMIT"); i < 0 || !strings.HasPrefix(q[i-1], "UPDATE players") {
+		t.Errorf("statements = %v, want both updates in one transaction", q)
+	}
+}
+
+func TestImportHistoryCreatesPlayersInTransaction(t *testing.T) {
+	at := time.Date(2024, 5, 1, 12, 0, 0, 0, time.UTC)
+	goal := historicalGoal{Line: 2, At: at, Team: "red", RedForward: "Alice", RedGoalkeeper: "Bob",
+		BlueForward: "Carol", BlueGoalkeeper: "Dave", Benched: "Dave", Moved: "Carol", NewForward: "Dave"}
+	d, f := newFakeDB(t, func(q string, args []driver.Value) fakeResult {
+		switch {
+		case strings.HasPrefix(q, "SELECT id, name, merged_into FROM players"):
+			// Bob was merged into Alice
+			return fakeResult{Cols: []string{"id", "name", "merged_into"}, Rows: [][]driver.Value{
+				{int64(1), "alice", nil}, {int64(2), "Bob", int64(1)}, {int64(3), "Carol", nil}, {int64(4), "Dave", nil},
+			}}
+		case strings.HasPrefix(q, "SELECT merged_into FROM players"):
+			if args[0] == int64(1) {
+				return fakeResult{Cols: []string{"merged_into"}, Rows: [][]driver.Value{{nil}}}
+			}
+		}
+		return fakeResult{Affected: 1}
+	})
+	if err := d.ImportHistory(context.Background(), []historicalGame{{ID: "g1", Goals: []historicalGoal{goal}}}); err != nil {
+		t.Fatal(err)
+	}
+	q := f.Queries()
+	if q[0] != "BEGIN" || q[len(q)-1] != "COMMIT" {
+		t.Errorf("statements = %v, want one transaction", q)
+	}
+	ins, ok := f.Find("INSERT IGNORE INTO players")
+	if !ok || fmt.Sprint(ins.Args) != "[Alice Bob Carol Dave]" {
+		t.Errorf("players insert = %+v", ins)
+	}
+	ev, _ := f.Find("INSERT INTO goal_events")
+	if fmt.Sprint(ev.Args[2:6]) != "[1 1 3 4]" {
+		t.Errorf("goal players = %v, want Bob as Alice", ev.Args[2:6])
+	}
+	for _, c := range f.calls {
+		if strings.HasPrefix(c.Query, "UPDATE players") && !strings.Contains(c.Query, "GREATEST(COALESCE(last_seen, ?), ?)") {
+			t.Errorf("last_seen overwritten: %s", c.Query)
+		}
+	}
+}
@@ -0,0 +1,216 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"log"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+
+	mysql "github.com/go-sql-driver/mysql"
+)
+
+// permanentError marks a DB op failure that retrying cannot fix.
+type permanentError struct{ err error }
+
+func (e *permanentError) Error() string { return e.err.Error() }
+func (e *permanentError) Unwrap() error { return e.err }
+
+func permanent(err error) error {
+	if err == nil {
+		return nil
+	}
+	return &permanentError{err: err}
+}
+
+// isPermanent classifies an op error. Explicitly marked errors and MySQL
+// errors about the data itself (constraints, bad values, schema) are
+// permanent; everything else (timeouts, dropped connections) is transient.
+func isPermanent(err error) bool {
+	var pe *permanentError
+	if errors.As(err, &pe) {
+		return true
+	}
+	var me *mysql.MySQLError
+	if errors.As(err, &me) {
+		switch me.Number {
+		case 1048, // column cannot be null
+			1054, // unknown column
+			1062, // duplicate entry
+			1064, // syntax error
+			1146, // table doesn't exist
+			1264, // out of range value
+			1292, // incorrect value
+			1366, // incorrect string value
+			1406, // data too long
+			1451, // FK: row is referenced
+			1452: // FK: referenced row missing
+			return true
+		}
+	}
+	return false
+}
+
+// deadLetter is a queued op the worker gave up on.
+type deadLetter struct {
+	ID        uint64       `json:"id"`
+	Op        outboxRecord `json:"op"`
+	Error     string       `json:"error"`
+	Attempts  int          `json:"attempts"`
+	Permanent bool         `json:"permanent"`
+	FailedAt  time.Time    `json:"failed_at"`
+}
+
+// deadLetterStore keeps dead-lettered ops, mirrored to a JSON file when a
+// path is configured.
+type deadLetterStore struct {
+	mu     sync.Mutex
+	path   string
+	items  []deadLetter
+	nextID uint64
+}
+
+// deadLetterPath returns the store path from DB_DEADLETTER_PATH ("off" keeps it in memory).
+func deadLetterPath() string {
+	p := strings.TrimSpace(os.Getenv("DB_DEADLETTER_PATH"))
+	switch strings.ToLower(p) {
+	case "":
+		return "kott-deadletter.json"
+	case "off", "none", "-":
+		return ""
+	}
+	return p
+}
+
+func openDeadLetterStore(path string) (*deadLetterStore, error) {
+	s := &deadLetterStore{path: path, nextID: 1}
+	if path == "" {
+		return s, nil
+	}
+	b, err := os.ReadFile(path)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return s, nil
+		}
+		return nil, err
+	}
+	if len(strings.TrimSpace(string(b))) > 0 {
+		if err := json.Unmarshal(b, &s.items); err != nil {
+			return nil, err
+		}
+	}
+	for _, it := range s.items {
+		if it.ID >= s.nextID {
+			s.nextID = it.ID + 1
+		}
+	}
+	if len(s.items) > 0 {
+		log.Printf("[deadletter] %d op(s) awaiting attention in %s", len(s.items), path)
+	}
+	return s, nil
+}
+
+func (s *deadLetterStore) Add(dl deadLetter) (deadLetter, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	dl.ID = s.nextID
+	s.nextID++
+	s.items = append(s.items, dl)
+	return dl, s.saveLocked()
+}
+
+func (s *deadLetterStore) List() []deadLetter {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	out := make([]deadLetter, len(s.items))
+	copy(out, s.items)
+	return out
+}
+
+// Take removes and returns the entry with the given id.
+func (s *deadLetterStore) Take(id uint64) (deadLetter, bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for i, it := range s.items {
+		if it.ID == id {
+			s.items = append(s.items[:i], s.items[i+1:]...)
+			if err := s.saveLocked(); err != nil {
+				log.Printf("[deadletter] persist failed: %v", err)
+			}
+			return it, true
+		}
+	}
+	return deadLetter{}, false
+}
+
+func (s *deadLetterStore) saveLocked() error {
+	if s.path == "" {
+		return nil
+	}
+	if dir := filepath.Dir(s.path); dir != "" {
+		if err := os.MkdirAll(dir, 0o755); err != nil {
+			return err
+		}
+	}
+	b, err := json.MarshalIndent(s.items, "", "  ")
+	if err != nil {
+		return err
+	}
+	tmp := s.path + ".tmp"
+	if err := os.WriteFile(tmp, b, 0o600); err != nil {
+		return err
+	}
+	return os.Rename(tmp, s.path)
+}
+
+// deadLetter parks op in the dead-letter store and releases it from the outbox.
+func (d *DB) deadLetter(op dbOp, cause error, attempts int, perm bool) {
+	dl := deadLetter{
+		Op:        op.record(),
+		Error:     cause.Error(),
+		Attempts:  attempts,
+		Permanent: perm,
+		FailedAt:  time.Now().UTC(),
+	}
+	if _, err := d.dead.Add(dl); err != nil {
+		// Keep it in the outbox so it is at least replayed on restart
+		log.Printf("[deadletter] persist failed: %v; op %d left in outbox", err, op.seq)
+		return
+	}
+	d.ack(op)
+}
+
+// DeadLetters lists ops the worker gave up on.
+func (d *DB) DeadLetters() []deadLetter {
+	if d == nil || d.dead == nil {
+		return nil
+	}
+	return d.dead.List()
+}
+
+// RetryDeadLetter removes the entry and queues its op again.
+func (d *DB) RetryDeadLetter(id uint64) bool {
+	if d == nil || d.dead == nil {
+		return false
+	}
+	dl, ok := d.dead.Take(id)
+	if !ok {
+		return false
+	}
+	op := dl.Op.op()
+	op.seq = 0
+	d.enqueue(op)
+	return true
+}
+
+// DiscardDeadLetter drops the entry for good.
+func (d *DB) DiscardDeadLetter(id uint64) bool {
+	if d == nil || d.dead == nil {
+		return false
+	}
+	_, ok := d.dead.Take(id)
+	return ok
+}
@@ -0,0 +1,77 @@
+package main
+
+import (
+	"context"
+	"database/sql/driver"
+	"errors"
+	"fmt"
+	"path/filepath"
+	"testing"
+
+	mysql "github.com/go-sql-driver/mysql"
+)
+
+func TestIsPermanent(t *testing.T) {
+	tests := []struct {
+		name string
+		err  error
+		want bool
+	}{
+		{"marked", permanent(errors.New("unknown op")), true},
+		{"marked and wrapped", fmt.Errorf("apply: %w", permanent(errors.New("bad"))), true},
+		{"duplicate entry", &mysql.MySQLError{Number: 1062}, true},
+		{"missing foreign key", &mysql.MySQLError{Number: 1452}, true},
+		{"data too long", &mysql.MySQLError{Number: 1406}, true},
+		{"wrapped mysql error", fmt.Errorf("record goal: %w", &mysql.MySQLError{Number: 1048}), true},
+		{"lock wait timeout", &mysql.MySQLError{Number: 1205}, false},
+		{"deadlock", &mysql.MySQLError{Number: 1213}, false},
+		{"too many connections", &mysql.MySQLError{Number: 1040}, false},
+		{"bad connection", driver.ErrBadConn, false},
+		{"timeout", context.DeadlineExceeded, false},
+		{"plain", errors.New("connection reset by peer"), false},
+		{"nil", nil, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := isPermanent(tt.err); got != tt.want {
+				t.Errorf("isPermanent(%v) = %v, want %v", tt.err, got, tt.want)
+			}
+		})
+	}
+	if permanent(nil) != nil {
+		t.Errorf("permanent(nil) != nil")
+	}
+}
+
+func TestDeadLetterStorePersists(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "deadletter.json")
+	s, err := openDeadLetterStore(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, game := range []string{"g1", "g2"} {
+		if _, err := s.Add(deadLetter{Op: dbOp{typ: opUndoLast, gameID: game}.record(), Error: "boom"}); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if _, ok := s.Take(1); !ok {
+		t.Fatal("Take(1) found nothing")
+	}
+
+	s2, err := openDeadLetterStore(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	items := s2.List()
+	if len(items) != 1 || items[0].ID != 2 || items[0].Op.GameID != "g2" {
+		t.Fatalf("reloaded items = %+v", items)
+	}
+	// IDs keep increasing across restarts
+	dl, err := s2.Add(deadLetter{Error: "again"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if dl.ID != 3 {
+		t.Errorf("next ID = %d, want 3", dl.ID)
+	}
+}
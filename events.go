@@ -0,0 +1,214 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/gorilla/mux"
+)
+
+// gameEvent is a notable change broadcast to listeners (SSE clients and
+// webhooks).
+type gameEvent struct {
+	Type     string    `json:"type"`
+	GameID   string    `json:"game_id"`
+	PlayerID string    `json:"player_id,omitempty"`
+	At       time.Time `json:"at"`
+	// Event-specific details
+	Data map[string]any `json:"data,omitempty"`
+}
+
+// eventBus fans events out to subscribers. Slow subscribers miss events
+// rather than blocking publishers.
+type eventBus struct {
+	mu     sync.Mutex
+	subs   map[chan gameEvent]subscription
+	closed bool
+}
+
+type subscription struct {
+	filter string // game filter ("" = all)
+	// Called with each event the subscriber missed, or nil
+	dropped func(gameEvent)
+}
+
+var events = &eventBus{subs: map[chan gameEvent]subscription{}}
+
+// Subscribe returns a channel receiving events for gameID (all games when
+// empty) and a function to unsubscribe. The channel is closed when the bus
+// shuts down.
+func (b *eventBus) Subscribe(gameID string) (<-chan gameEvent, func()) {
+	return b.SubscribeBuffered(gameID, 32, nil)
+}
+
+// SubscribeBuffered is Subscribe with room for size events. Events that do
+// not fit are passed to dropped (when not nil) after the bus lock is
+// released.
+func (b *eventBus) SubscribeBuffered(gameID string, size int, dropped func(gameEvent)) (<-chan gameEvent, func()) {
+	ch := make(chan gameEvent, size)
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if b.closed {
+		close(ch)
+		return ch, func() {}
+	}
+	b.subs[ch] = subscription{filter: gameID, dropped: dropped}
+	return ch, func() {
+		b.mu.Lock()
+		defer b.mu.Unlock()
+		if _, ok := b.subs[ch]; ok {
+			delete(b.subs, ch)
+			close(ch)
+		}
+	}
+}
+
+func (b *eventBus) Publish(ev gameEvent) {
+	if ev.At.IsZero() {
+		ev.At = time.Now()
+	}
+	var missed []func(gameEvent)
+	b.mu.Lock()
+	for ch, sub := range b.subs {
+		if sub.filter != "" && sub.filter != ev.GameID {
+			continue
+		}
+		select {
+		case ch <- ev:
+		default:
+			if sub.dropped != nil {
+				missed = append(missed, sub.dropped)
+			}
+		}
+	}
+	b.mu.Unlock()
+	for _, f := range missed {
+		f(ev)
+	}
+}
+
+// Close ends every subscription (on shutdown, so streams return).
+func (b *eventBus) Close() {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.closed = true
+	for ch := range b.subs {
+		delete(b.subs, ch)
+		close(ch)
+	}
+}
+
+// GET /games/{gameId}/events
+// Server-sent events stream of the game's events.
+func getGameEvents(w http.ResponseWriter, r *http.Request) {
+	gameID := mux.Vars(r)["gameId"]
+	gamesMu.RLock()
+	_, ok := games[gameID]
+	gamesMu.RUnlock()
+	if !ok {
+		writeError(w, http.StatusNotFound, "game not found")
+		return
+	}
+	streamEvents(w, r, gameID)
+}
+
+// GET /venues/{venueId}/events
+// Server-sent events stream of the venue queue's events (published with
+// the venue ID as game_id).
+func getVenueEvents(w http.ResponseWriter, r *http.Request) {
+	venueID := mux.Vars(r)["venueId"]
+	gamesMu.RLock()
+	_, ok := venues[venueID]
+	gamesMu.RUnlock()
+	if !ok {
+		writeError(w, http.StatusNotFound, "venue not found")
+		return
+	}
+	streamEvents(w, r, venueID)
+}
+
+// streamEvents writes the events published for id as server-sent events
+// until the client goes away or the bus shuts down.
+func streamEvents(w http.ResponseWriter, r *http.Request, id string) {
+	flusher, ok := w.(http.Flusher)
+	if !ok {
+		writeError(w, http.StatusInternalServerError, "streaming not supported")
+		return
+	}
+	ch, cancel := events.Subscribe(id)
+	defer cancel()
+
+	w.Header().Set("Content-Type", "text/event-stream")
+	w.Header().Set("Cache-Control", "no-cache")
+	w.WriteHeader(http.StatusOK)
+	flusher.Flush()
+	keepAlive := time.NewTicker(25 * time.Second)
+	defer keepAlive.Stop()
+	for {
+		select {
+		case <-r.Context().Done():
+			return
+		case <-keepAlive.C:
+			fmt.Fprint(w, ": keep-alive\n\n")
+			flusher.Flush()
+		case ev, ok := <-ch:
+			if !ok {
+				return
+			}
+			b, _ := json.Marshal(ev)
+			fmt.Fprintf(w, "event: %s\ndata: %s\n\n", ev.Type, b)
+			flusher.Flush()
+		}
+	}
+}
+
+// gameStartedEvent describes a new game's lineup; caller holds gamesMu.
+func gameStartedEvent(gameID string, gs *GameState) gameEvent {
+	return gameEvent{Type: "game_started", GameID: gameID, Data: map[string]any{
+		"red": gs.Red, "blue": gs.Blue, "waiting": gs.Waiting.Snapshot(),
+	}}
+}
+
+// queueJoinedEvent reports id joining the game's queue; caller holds gamesMu.
+func queueJoinedEvent(gameID string, gs *GameState, id string) gameEvent {
+	return gameEvent{Type: "player_joined_queue", GameID: gameID, PlayerID: id, Data: map[string]any{
+		"position": gs.waitingPosition(id),
+	}}
+}
+
+// matchEndedEvent reports the final score of a tournament match game;
+// caller holds gamesMu.
+func matchEndedEvent(gameID string, gs *GameState) gameEvent {
+	winner := "red"
+	if gs.Score.Blue > gs.Score.Red {
+		winner = "blue"
+	}
+	return gameEvent{Type: "game_ended", GameID: gameID, Data: map[string]any{
+		"tournament_id": gs.Match.TournamentID, "match_id": gs.Match.MatchID,
+		"red_score": gs.Score.Red, "blue_score": gs.Score.Blue, "winner": winner,
+	}}
+}
+
+// publishGoal announces a rotating goal: the goal, the losing team's
+// rotation and, when it happened, the full-rotation celebration.
+func publishGoal(gameID, team string, after GameState, rot rotationSummary, cel *celebrationResponse) {
+	now := time.Now()
+	loser := "red"
+	if team == "red" {
+		loser = "blue"
+	}
+	events.Publish(gameEvent{Type: "goal", GameID: gameID, At: now, Data: map[string]any{
+		"team": team, "red": after.Red, "blue": after.Blue,
+	}})
+	events.Publish(gameEvent{Type: "rotation", GameID: gameID, PlayerID: rot.Benched, At: now, Data: map[string]any{
+		"team": loser, "benched": rot.Benched, "moved_to_goalkeeper": rot.MovedToGoalkeeper, "new_forward": rot.NewForward,
+	}})
+	if cel != nil {
+		events.Publish(gameEvent{Type: cel.Type, GameID: gameID, At: now, Data: map[string]any{
+			"team": cel.Team, "players": cel.Players,
+		}})
+	}
+}
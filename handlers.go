@@ -1,10 +1,13 @@
 package main
 
 import (
+	"context"
 	"encoding/json"
 	"errors"
+	"fmt"
 	"net/http"
 	"strings"
+	"time"
 
 	"github.com/gorilla/mux"
 )
@@ -20,16 +23,37 @@ func writeError(w http.ResponseWriter, status int, msg string) {
 	writeJSON(w, status, map[string]string{"error": msg})
 }
 
+// decodeJSON reads the request body into v, capped at KOTT_MAX_BODY_BYTES.
+// On failure it writes the error response (413 or 400) and returns false.
+func decodeJSON(w http.ResponseWriter, r *http.Request, v any) bool {
+	err := json.NewDecoder(http.MaxBytesReader(w, r.Body, limitConfig.maxBodyBytes)).Decode(v)
+	if err == nil {
+		return true
+	}
+	var tooLarge *http.MaxBytesError
+	if errors.As(err, &tooLarge) {
+		writeError(w, http.StatusRequestEntityTooLarge, "request body too large")
+		return false
+	}
+	writeError(w, http.StatusBadRequest, "invalid JSON body")
+	return false
+}
+
 // Core rotation logic
 func rotateLoser(gs *GameState, loser *TeamState) (rotationSummary, error) {
-	if gs.Waiting.Len() == 0 {
+	if !gs.canRotate() {
 		return rotationSummary{}, errors.New("waiting queue empty; cannot rotate losing team")
 	}
+	now := time.Now()
 	benched := loser.Goalkeeper
-	gs.Waiting.Enqueue(benched)
+	newForward, mv := gs.nextForward(now)
+	gs.bench(benched, now, &mv)
+	if n := len(gs.History); n > 0 {
+		// Undo of this rotation (snapshotted just before) reverses the venue moves too
+		gs.History[n-1].Venue = mv
+	}
 	moved := loser.Forward
 	loser.Goalkeeper = moved
-	newForward, _ := gs.Waiting.Dequeue()
 	loser.Forward = newForward
 	return rotationSummary{Benched: benched, MovedToGoalkeeper: moved, NewForward: newForward}, nil
 }
@@ -38,8 +62,11 @@ func rotateLoser(gs *GameState, loser *TeamState) (rotationSummary, error) {
 // Start a new game and let the server allocate an ID.
 func postStartNewGame(w http.ResponseWriter, r *http.Request) {
 	var req resetRequest
-	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
-		writeError(w, http.StatusBadRequest, "invalid JSON body")
+	if !decodeJSON(w, r, &req) {
+		return
+	}
+	if len(req.Players) > 0 {
+		startGeneratedGame(w, r, req)
 		return
 	}
 	if containsEmptyIDs(req.Red.Forward, req.Red.Goalkeeper, req.Blue.Forward, req.Blue.Goalkeeper) {
@@ -53,34 +80,96 @@ func postStartNewGame(w http.ResponseWriter, r *http.Request) {
 		}
 	}
 
+	// Resolve names/IDs to stable player IDs (creating new players)
+	refs := append([]string{req.Red.Forward, req.Red.Goalkeeper, req.Blue.Forward, req.Blue.Goalkeeper}, req.Waiting...)
+	ids, err := resolvePlayers(r.Context(), refs...)
+	if err != nil {
+		writePlayerError(w, err)
+		return
+	}
+
 	gs := &GameState{
-		Red:     req.Red,
-		Blue:    req.Blue,
+		Red:     TeamState{Forward: ids[0], Goalkeeper: ids[1]},
+		Blue:    TeamState{Forward: ids[2], Goalkeeper: ids[3]},
 		Waiting: NewRingQueue(max(8, len(req.Waiting))),
 		Started: true,
 		History: nil,
 	}
-	for _, id := range req.Waiting {
-		gs.Waiting.Enqueue(id)
+	now := time.Now()
+	for _, id := range ids[4:] {
+		gs.enqueueWaiting(id, now)
 	}
 	if dup, ok := hasDuplicate(collectAllIDs(gs)); ok {
-		writeError(w, http.StatusConflict, "duplicate player_id: "+dup)
+		writeError(w, http.StatusConflict, "duplicate player_id: "+dup+" ("+directory.Name(dup)+")")
 		return
 	}
 
-	// Queue creation of all players (active + waiting)
-	if db != nil {
-		names := []string{gs.Red.Forward, gs.Red.Goalkeeper, gs.Blue.Forward, gs.Blue.Goalkeeper}
-		names = append(names, gs.Waiting.Snapshot()...)
-		db.EnqueueEnsurePlayers(names)
+	gamesMu.Lock()
+	id := newGameIDLocked()
+	games[id] = gs
+	ev := gameStartedEvent(id, gs)
+	resp := toGameResponse(gs, nil)
+	gamesMu.Unlock()
+
+	events.Publish(ev)
+	writeJSON(w, http.StatusOK, startNewGameResponse{ID: id, State: resp})
+}
+
+// startGeneratedGame starts a game from a list of present players, letting
+// the server pick the teams and queue order.
+func startGeneratedGame(w http.ResponseWriter, r *http.Request, req resetRequest) {
+	if req.Red != (TeamState{}) || req.Blue != (TeamState{}) || len(req.Waiting) > 0 {
+		writeError(w, http.StatusBadRequest, "give either players or red/blue/waiting, not both")
+		return
+	}
+	mode := strings.ToLower(strings.TrimSpace(req.Mode))
+	switch mode {
+	case "":
+		mode = teamsBalanced
+	case teamsBalanced, teamsRandom:
+	default:
+		writeError(w, http.StatusBadRequest, "mode must be 'balanced' or 'random'")
+		return
+	}
+	if len(req.Players) < 4 {
+		writeError(w, http.StatusBadRequest, "at least 4 players are needed")
+		return
+	}
+	if containsEmptyIDs(req.Players...) {
+		writeError(w, http.StatusBadRequest, "empty player_id in players")
+		return
+	}
+	ids, err := resolvePlayers(r.Context(), req.Players...)
+	if err != nil {
+		writePlayerError(w, err)
+		return
+	}
+	if dup, ok := hasDuplicate(ids); ok {
+		writeError(w, http.StatusConflict, "duplicate player_id: "+dup+" ("+directory.Name(dup)+")")
+		return
+	}
+
+	red, blue, waiting, gen := generateTeams(mode, ids, playerStrengths(r.Context(), ids))
+	gs := &GameState{
+		Red:     red,
+		Blue:    blue,
+		Waiting: NewRingQueue(max(8, len(waiting))),
+		Started: true,
+	}
+	now := time.Now()
+	for _, id := range waiting {
+		gs.enqueueWaiting(id, now)
 	}
 
 	gamesMu.Lock()
 	id := newGameIDLocked()
 	games[id] = gs
+	ev := gameStartedEvent(id, gs)
+	resp := toGameResponse(gs, nil)
 	gamesMu.Unlock()
 
-	writeJSON(w, http.StatusOK, startNewGameResponse{ID: id, State: toGameResponse(gs, nil)})
+	events.Publish(ev)
+	writeJSON(w, http.StatusOK, startNewGameResponse{ID: id, State: resp, Teams: &gen})
 }
 
 func postQueue(w http.ResponseWriter, r *http.Request) {
@@ -88,15 +177,34 @@ func postQueue(w http.ResponseWriter, r *http.Request) {
 	gameID := vars["gameId"]
 
 	var req queueRequest
-	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
-		writeError(w, http.StatusBadRequest, "invalid JSON body")
+	if !decodeJSON(w, r, &req) {
 		return
 	}
+	caller := identityFrom(r)
 	req.PlayerID = strings.TrimSpace(req.PlayerID)
+	if req.PlayerID == "" && caller.Role < roleReferee {
+		// Players queue themselves by default
+		req.PlayerID = caller.PlayerID
+	}
 	if req.PlayerID == "" {
 		writeError(w, http.StatusBadRequest, "player_id is required")
 		return
 	}
+	resolve := resolvePlayers
+	if caller.Role < roleReferee {
+		// Only referees may create players by typing a new name
+		resolve = findPlayers
+	}
+	ids, err := resolve(r.Context(), req.PlayerID)
+	if err != nil {
+		writePlayerError(w, err)
+		return
+	}
+	req.PlayerID = ids[0]
+	if !caller.actsFor(req.PlayerID) {
+		writeError(w, http.StatusForbidden, "players can only queue themselves")
+		return
+	}
 
 	gamesMu.Lock()
 	gs, ok := games[gameID]
@@ -105,22 +213,30 @@ func postQueue(w http.ResponseWriter, r *http.Request) {
 		writeError(w, http.StatusNotFound, "game not found")
 		return
 	}
+	if gs.Match != nil {
+		gamesMu.Unlock()
+		writeError(w, http.StatusConflict, "tournament matches have no waiting queue")
+		return
+	}
 	if playerExistsInGame(gs, req.PlayerID) {
 		gamesMu.Unlock()
 		writeError(w, http.StatusConflict, "player_id already exists in game")
 		return
 	}
+	if _, ok := venueConflict(gs, gameID, req.PlayerID); ok {
+		gamesMu.Unlock()
+		writeError(w, http.StatusConflict, "player is already at another table or in the venue queue")
+		return
+	}
 	// Snapshot before mutation for undo
-	gs.History = append(gs.History, snapshotGame(gs))
-	gs.Waiting.Enqueue(req.PlayerID)
+	pushHistory(gs)
+	gs.enqueueWaiting(req.PlayerID, time.Now())
+	ev := queueJoinedEvent(gameID, gs, req.PlayerID)
+	resp := toGameResponse(gs, nil)
 	gamesMu.Unlock()
 
-	// Enqueue upsert for the queued player
-	if db != nil {
-		db.EnqueueEnsurePlayers([]string{req.PlayerID})
-	}
-
-	writeJSON(w, http.StatusOK, toGameResponse(gs, nil))
+	events.Publish(ev)
+	writeJSON(w, http.StatusOK, resp)
 }
 
 func postGoal(w http.ResponseWriter, r *http.Request) {
@@ -128,8 +244,7 @@ func postGoal(w http.ResponseWriter, r *http.Request) {
 	gameID := vars["gameId"]
 
 	var req goalRequest
-	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
-		writeError(w, http.StatusBadRequest, "invalid JSON body")
+	if !decodeJSON(w, r, &req) {
 		return
 	}
 	team := strings.ToLower(strings.TrimSpace(req.Team))
@@ -146,9 +261,47 @@ func postGoal(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
+	// Reject implausibly fast goals so stats cannot be inflated by spamming
+	if !gs.LastGoalAt.IsZero() {
+		if wait := limitConfig.minGoalInterval - time.Since(gs.LastGoalAt); wait > 0 {
+			gamesMu.Unlock()
+			writeRetryAfter(w, wait)
+			writeError(w, http.StatusTooManyRequests, "goal recorded too soon after the previous one")
+			return
+		}
+	}
+
+	if gs.Match != nil {
+		// Tournament match: count the goal, no rotation
+		if !gs.Started {
+			gamesMu.Unlock()
+			writeError(w, http.StatusConflict, "match is over")
+			return
+		}
+		pushHistory(gs)
+		gs.LastGoalAt = time.Now()
+		gs.recordGoalTime(gs.LastGoalAt)
+		gs.scoreMatchGoal(team)
+		evs := []gameEvent{{Type: "goal", GameID: gameID, Data: map[string]any{
+			"team": team, "red_score": gs.Score.Red, "blue_score": gs.Score.Blue,
+		}}}
+		if !gs.Started {
+			evs = append(evs, matchEndedEvent(gameID, gs))
+		}
+		resp := toGameResponse(gs, nil)
+		gamesMu.Unlock()
+
+		for _, ev := range evs {
+			events.Publish(ev)
+		}
+		writeJSON(w, http.StatusOK, resp)
+		return
+	}
+
 	var summary rotationSummary
 	var err error
 	var celebration *celebrationResponse
+	var seq int64
 	if team == "red" {
 		// Red scores, Blue loses
 		if !gs.Started {
@@ -156,13 +309,13 @@ func postGoal(w http.ResponseWriter, r *http.Request) {
 			writeError(w, http.StatusConflict, "game not started")
 			return
 		}
-		if gs.Waiting.Len() == 0 {
+		if !gs.canRotate() {
 			gamesMu.Unlock()
 			writeError(w, http.StatusConflict, "waiting queue empty; cannot rotate losing team")
 			return
 		}
 		// Snapshot before mutation for undo
-		gs.History = append(gs.History, snapshotGame(gs))
+		seq = pushHistory(gs)
 		// Achievement: start/reset streak if winners pair or team changed.
 		if gs.StreakTeam != "red" || gs.StreakForward != gs.Red.Forward || gs.StreakGoalkeeper != gs.Red.Goalkeeper {
 			gs.StreakTeam = "red"
@@ -186,13 +339,13 @@ func postGoal(w http.ResponseWriter, r *http.Request) {
 			writeError(w, http.StatusConflict, "game not started")
 			return
 		}
-		if gs.Waiting.Len() == 0 {
+		if !gs.canRotate() {
 			gamesMu.Unlock()
 			writeError(w, http.StatusConflict, "waiting queue empty; cannot rotate losing team")
 			return
 		}
 		// Snapshot before mutation for undo
-		gs.History = append(gs.History, snapshotGame(gs))
+		seq = pushHistory(gs)
 		if gs.StreakTeam != "blue" || gs.StreakForward != gs.Blue.Forward || gs.StreakGoalkeeper != gs.Blue.Goalkeeper {
 			gs.StreakTeam = "blue"
 			gs.StreakForward = gs.Blue.Forward
@@ -208,6 +361,8 @@ func postGoal(w http.ResponseWriter, r *http.Request) {
 			return
 		}
 	}
+	gs.LastGoalAt = time.Now()
+	gs.recordGoalTime(gs.LastGoalAt)
 	// Check full rotation: opponent pair returned to the original pair from streak start
 	if gs.StreakOppStartF != "" && gs.StreakOppStartG != "" {
 		// Identify current opponent after rotation
@@ -230,14 +385,16 @@ func postGoal(w http.ResponseWriter, r *http.Request) {
 	}
 	// Copy minimal state for DB logging, then release lock
 	stateCopy := GameState{Red: gs.Red, Blue: gs.Blue}
+	resp := toGameResponseWithCelebration(gs, &summary, celebration)
 	gamesMu.Unlock()
 
 	// Record goal event and stats via DB queue
 	if db != nil {
-		db.EnqueueRecordGoal(gameID, team, stateCopy, summary, celebration != nil && celebration.Type == "full_rotation")
+		db.EnqueueRecordGoal(gameID, seq, team, stateCopy, summary, celebration != nil && celebration.Type == "full_rotation")
 	}
+	publishGoal(gameID, team, stateCopy, summary, celebration)
 
-	writeJSON(w, http.StatusOK, toGameResponseWithCelebration(gs, &summary, celebration))
+	writeJSON(w, http.StatusOK, resp)
 }
 
 func getGame(w http.ResponseWriter, r *http.Request) {
@@ -246,12 +403,14 @@ func getGame(w http.ResponseWriter, r *http.Request) {
 
 	gamesMu.RLock()
 	gs, ok := games[gameID]
-	gamesMu.RUnlock()
 	if !ok {
+		gamesMu.RUnlock()
 		writeError(w, http.StatusNotFound, "game not found")
 		return
 	}
-	writeJSON(w, http.StatusOK, toGameResponse(gs, nil))
+	resp := toGameResponse(gs, nil)
+	gamesMu.RUnlock()
+	writeJSON(w, http.StatusOK, resp)
 }
 
 func getGames(w http.ResponseWriter, r *http.Request) {
@@ -282,29 +441,110 @@ func postUndo(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 	last := gs.History[len(gs.History)-1]
+	if id, ok := gs.venueUndoBlocked(last.Venue); ok {
+		gamesMu.Unlock()
+		writeError(w, http.StatusConflict, "cannot undo: "+id+" ("+directory.Name(id)+") has since come on at another table")
+		return
+	}
+	if gs.matchUndoBlocked(last) {
+		gamesMu.Unlock()
+		writeError(w, http.StatusConflict, "cannot undo: the match result has been carried into later matches")
+		return
+	}
+	gs.matchUndo(last)
 	gs.History = gs.History[:len(gs.History)-1]
 	applySnapshot(gs, last)
+	gs.undoVenueMove(last.Venue)
+	resp := toGameResponse(gs, nil)
 	gamesMu.Unlock()
 
-	// Persist undo to DB (reverse last event and counters)
+	// Persist undo to DB (reverse the matching goal event and counters, if any)
 	if db != nil {
-		db.EnqueueUndoLastEvent(gameID)
+		db.EnqueueUndoLastEvent(gameID, last.Seq)
 	}
+	events.Publish(gameEvent{Type: "undo", GameID: gameID})
 
-	writeJSON(w, http.StatusOK, toGameResponse(gs, nil))
+	writeJSON(w, http.StatusOK, resp)
 }
 
+// toGameResponse renders a game's state; caller holds gamesMu, since the
+// queue metadata it reads is also written by the ready-check sweeper.
 func toGameResponse(gs *GameState, rotation *rotationSummary) gameResponse {
 	resp := gameResponse{
 		Red:      gs.Red,
 		Blue:     gs.Blue,
 		Waiting:  gs.Waiting.Snapshot(),
+		Queue:    gs.queueEntries(time.Now()),
 		Rotation: rotation,
 		Started:  gs.Started,
+		VenueID:  gs.VenueID,
+	}
+	if gs.Match != nil {
+		resp.Match = &matchStatus{
+			TournamentID: gs.Match.TournamentID,
+			MatchID:      gs.Match.MatchID,
+			GoalsToWin:   gs.Match.GoalsToWin,
+			RedScore:     gs.Score.Red,
+			BlueScore:    gs.Score.Blue,
+		}
 	}
+	ids := append([]string{gs.Red.Forward, gs.Red.Goalkeeper, gs.Blue.Forward, gs.Blue.Goalkeeper}, resp.Waiting...)
+	if rotation != nil {
+		ids = append(ids, rotation.Benched, rotation.MovedToGoalkeeper, rotation.NewForward)
+	}
+	resp.Players = playerNames(ids...)
 	return resp
 }
 
+// resolvePlayers maps API player references (stable ID or name) to stable
+// player IDs, creating players for names not seen before.
+func resolvePlayers(ctx context.Context, refs ...string) ([]string, error) {
+	out := make([]string, len(refs))
+	for i, ref := range refs {
+		p, err := directory.Resolve(ctx, ref)
+		if err != nil {
+			return nil, err
+		}
+		if !p.Active {
+			return nil, fmt.Errorf("%w: %s", errPlayerInactive, p.Name)
+		}
+		out[i] = formatPlayerID(p.ID)
+	}
+	return out, nil
+}
+
+// findPlayers is resolvePlayers without creating unknown names.
+func findPlayers(ctx context.Context, refs ...string) ([]string, error) {
+	out := make([]string, len(refs))
+	for i, ref := range refs {
+		p, err := directory.Find(ctx, ref)
+		if err != nil {
+			return nil, err
+		}
+		if !p.Active {
+			return nil, fmt.Errorf("%w: %s", errPlayerInactive, p.Name)
+		}
+		out[i] = formatPlayerID(p.ID)
+	}
+	return out, nil
+}
+
+// writePlayerError maps player directory errors to HTTP responses.
+func writePlayerError(w http.ResponseWriter, err error) {
+	switch {
+	case errors.Is(err, errPlayerNotFound):
+		writeError(w, http.StatusNotFound, "player not found")
+	case errors.Is(err, errPlayerNameInvalid):
+		writeError(w, http.StatusBadRequest, err.Error())
+	case errors.Is(err, errPlayerNameTaken):
+		writeError(w, http.StatusConflict, "player name already taken")
+	case errors.Is(err, errPlayerInactive):
+		writeError(w, http.StatusConflict, err.Error())
+	default:
+		writeError(w, http.StatusServiceUnavailable, "player lookup failed: "+err.Error())
+	}
+}
+
 func toGameResponseWithCelebration(gs *GameState, rotation *rotationSummary, cel *celebrationResponse) gameResponse {
 	resp := toGameResponse(gs, rotation)
 	if cel != nil {
@@ -342,15 +582,32 @@ func postRemovePlayer(w http.ResponseWriter, r *http.Request) {
 	vars := mux.Vars(r)
 	gameID := vars["gameId"]
 	var req queueRequest
-	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
-		writeError(w, http.StatusBadRequest, "invalid JSON body")
+	if !decodeJSON(w, r, &req) {
 		return
 	}
+	caller := identityFrom(r)
 	req.PlayerID = strings.TrimSpace(req.PlayerID)
+	if req.PlayerID == "" && caller.Role < roleReferee {
+		req.PlayerID = caller.PlayerID
+	}
 	if req.PlayerID == "" {
 		writeError(w, http.StatusBadRequest, "player_id is required")
 		return
 	}
+	p, err := directory.Find(r.Context(), req.PlayerID)
+	if err != nil {
+		if errors.Is(err, errPlayerNotFound) {
+			writeError(w, http.StatusNotFound, "player not found in game")
+			return
+		}
+		writePlayerError(w, err)
+		return
+	}
+	req.PlayerID = formatPlayerID(p.ID)
+	if !caller.actsFor(req.PlayerID) {
+		writeError(w, http.StatusForbidden, "players can only remove themselves")
+		return
+	}
 
 	gamesMu.Lock()
 	gs, ok := games[gameID]
@@ -360,10 +617,10 @@ func postRemovePlayer(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 	// Snapshot before mutation for undo
-	gs.History = append(gs.History, snapshotGame(gs))
+	pushHistory(gs)
 
 	// Remove from waiting if present
-	removed := gs.Waiting.RemoveValue(req.PlayerID)
+	removed := gs.removeWaiting(req.PlayerID)
 	// Remove from active slots if matched
 	if !removed {
 		if gs.Red.Forward == req.PlayerID {
@@ -390,11 +647,13 @@ func postRemovePlayer(w http.ResponseWriter, r *http.Request) {
 		}
 	}
 
+	resp := toGameResponse(gs, nil)
 	gamesMu.Unlock()
 
 	if !removed {
 		writeError(w, http.StatusNotFound, "player not found in game")
 		return
 	}
-	writeJSON(w, http.StatusOK, toGameResponse(gs, nil))
+	events.Publish(gameEvent{Type: "player_left", GameID: gameID, PlayerID: req.PlayerID})
+	writeJSON(w, http.StatusOK, resp)
 }
@@ -0,0 +1,122 @@
+package main
+
+import (
+	"net/http"
+	"strconv"
+	"strings"
+
+	"github.com/gorilla/mux"
+)
+
+// GET /admin/dead-letters
+func getDeadLetters(w http.ResponseWriter, r *http.Request) {
+	if db == nil {
+		writeError(w, http.StatusNotImplemented, "database not configured")
+		return
+	}
+	res := db.DeadLetters()
+	if res == nil {
+		res = []deadLetter{}
+	}
+	writeJSON(w, http.StatusOK, res)
+}
+
+// POST /admin/dead-letters/{id}/retry
+// Moves the op back onto the write queue.
+func postRetryDeadLetter(w http.ResponseWriter, r *http.Request) {
+	if db == nil {
+		writeError(w, http.StatusNotImplemented, "database not configured")
+		return
+	}
+	id, err := strconv.ParseUint(mux.Vars(r)["id"], 10, 64)
+	if err != nil {
+		writeError(w, http.StatusBadRequest, "invalid dead-letter id")
+		return
+	}
+	if !db.RetryDeadLetter(id) {
+		writeError(w, http.StatusNotFound, "dead letter not found")
+		return
+	}
+	writeJSON(w, http.StatusOK, map[string]any{"id": id, "status": "requeued"})
+}
+
+// DELETE /admin/dead-letters/{id}
+func deleteDeadLetter(w http.ResponseWriter, r *http.Request) {
+	if db == nil {
+		writeError(w, http.StatusNotImplemented, "database not configured")
+		return
+	}
+	id, err := strconv.ParseUint(mux.Vars(r)["id"], 10, 64)
+	if err != nil {
+		writeError(w, http.StatusBadRequest, "invalid dead-letter id")
+		return
+	}
+	if !db.DiscardDeadLetter(id) {
+		writeError(w, http.StatusNotFound, "dead letter not found")
+		return
+	}
+	writeJSON(w, http.StatusOK, map[string]any{"id": id, "status": "discarded"})
+}
+
+// GET /admin/tokens
+func getTokens(w http.ResponseWriter, r *http.Request) {
+	writeJSON(w, http.StatusOK, tokens.List())
+}
+
+type issueTokenRequest struct {
+	Role     string `json:"role"`
+	Label    string `json:"label"`
+	PlayerID string `json:"player_id"`
+}
+
+type issueTokenResponse struct {
+	apiToken
+	// The secret is only ever returned here
+	Token string `json:"token"`
+}
+
+// POST /admin/tokens {"role": "referee", "label": "tablet", "player_id": ""}
+func postToken(w http.ResponseWriter, r *http.Request) {
+	var req issueTokenRequest
+	if !decodeJSON(w, r, &req) {
+		return
+	}
+	rl, ok := parseRole(req.Role)
+	if !ok {
+		writeError(w, http.StatusBadRequest, "role must be admin, referee, player or spectator")
+		return
+	}
+	playerID := ""
+	if strings.TrimSpace(req.PlayerID) != "" {
+		p, err := directory.Find(r.Context(), req.PlayerID)
+		if err != nil {
+			writePlayerError(w, err)
+			return
+		}
+		playerID = formatPlayerID(p.ID)
+	}
+	if rl == rolePlayer && playerID == "" {
+		writeError(w, http.StatusBadRequest, "player tokens require player_id")
+		return
+	}
+	t, secret, err := tokens.Issue(r.Context(), rl, playerID, strings.TrimSpace(req.Label))
+	if err != nil {
+		writeError(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+	writeJSON(w, http.StatusCreated, issueTokenResponse{apiToken: *t, Token: secret})
+}
+
+// DELETE /admin/tokens/{id}
+func deleteToken(w http.ResponseWriter, r *http.Request) {
+	ok, err := tokens.Revoke(r.Context(), mux.Vars(r)["id"])
+	if !ok {
+		writeError(w, http.StatusNotFound, "token not found")
+		return
+	}
+	if err != nil {
+		writeError(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
@@ -0,0 +1,123 @@
+package main
+
+import (
+	"errors"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/gorilla/mux"
+)
+
+type sessionRequest struct {
+	Token string `json:"token"`
+}
+
+type pinSessionRequest struct {
+	// Stable ID or name
+	PlayerID string `json:"player_id"`
+	PIN      string `json:"pin"`
+}
+
+type setPINRequest struct {
+	// Empty clears the PIN
+	PIN string `json:"pin"`
+}
+
+type sessionResponse struct {
+	identity
+	Expires time.Time `json:"expires"`
+}
+
+// POST /auth/session {"token": "kott_..."}
+// Exchanges an API token for a signed session cookie (used by the web UI).
+func postSession(w http.ResponseWriter, r *http.Request) {
+	var req sessionRequest
+	if !decodeJSON(w, r, &req) {
+		return
+	}
+	id, ok := credentialIdentity(strings.TrimSpace(req.Token))
+	if !ok {
+		writeError(w, http.StatusUnauthorized, "invalid or revoked token")
+		return
+	}
+	id.Via = "session"
+	exp := setSessionCookie(w, r, id, "")
+	writeJSON(w, http.StatusOK, sessionResponse{identity: id, Expires: exp})
+}
+
+// POST /auth/pin {"player_id": "12", "pin": "1234"}
+// Opens a player session so players can queue or leave as themselves.
+func postPINSession(w http.ResponseWriter, r *http.Request) {
+	var req pinSessionRequest
+	if !decodeJSON(w, r, &req) {
+		return
+	}
+	p, err := directory.Find(r.Context(), req.PlayerID)
+	if err != nil {
+		if errors.Is(err, errPlayerNotFound) {
+			writeError(w, http.StatusUnauthorized, "invalid player or PIN")
+			return
+		}
+		writePlayerError(w, err)
+		return
+	}
+	ok, err := pins.Verify(r.Context(), p.ID, strings.TrimSpace(req.PIN))
+	switch {
+	case errors.Is(err, errPINLocked):
+		writeError(w, http.StatusTooManyRequests, err.Error())
+		return
+	case err != nil:
+		writeError(w, http.StatusServiceUnavailable, "pin check failed: "+err.Error())
+		return
+	case !ok || !p.Active:
+		writeError(w, http.StatusUnauthorized, "invalid player or PIN")
+		return
+	}
+	id := identity{Role: rolePlayer, PlayerID: formatPlayerID(p.ID), Via: "session"}
+	exp := setSessionCookie(w, r, id, pins.Fingerprint(r.Context(), p.ID))
+	writeJSON(w, http.StatusOK, sessionResponse{identity: id, Expires: exp})
+}
+
+// POST /players/{id}/pin {"pin": "1234"}
+// Players set their own PIN; referees and admins set anyone's.
+func postPlayerPIN(w http.ResponseWriter, r *http.Request) {
+	ref, ok := playerRefID(mux.Vars(r)["id"])
+	if !ok {
+		writeError(w, http.StatusBadRequest, "invalid player id")
+		return
+	}
+	var req setPINRequest
+	if !decodeJSON(w, r, &req) {
+		return
+	}
+	p, err := directory.Get(r.Context(), ref)
+	if err != nil {
+		writePlayerError(w, err)
+		return
+	}
+	if !identityFrom(r).actsFor(formatPlayerID(p.ID)) {
+		writeError(w, http.StatusForbidden, "players can only set their own PIN")
+		return
+	}
+	if err := pins.Set(r.Context(), p.ID, strings.TrimSpace(req.PIN)); err != nil {
+		if errors.Is(err, errPINInvalid) {
+			writeError(w, http.StatusBadRequest, err.Error())
+			return
+		}
+		writePlayerError(w, err)
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// DELETE /auth/session
+func deleteSession(w http.ResponseWriter, r *http.Request) {
+	http.SetCookie(w, &http.Cookie{Name: sessionCookie, Value: "", Path: "/", MaxAge: -1, HttpOnly: true})
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// GET /auth/whoami
+func getWhoami(w http.ResponseWriter, r *http.Request) {
+	writeJSON(w, http.StatusOK, identityFrom(r))
+}
@@ -0,0 +1,212 @@
+package main
+
+import (
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+	"strings"
+	"time"
+)
+
+// Export formats and their content types.
+var exportFormats = map[string]string{
+	"json":   "application/json",
+	"ndjson": "application/x-ndjson",
+	"csv":    "text/csv; charset=utf-8",
+}
+
+// maxExportGames caps the game filter.
+const maxExportGames = 100
+
+// exportFlushEvery is how many rows are written between flushes.
+const exportFlushEvery = 500
+
+// exportStream writes rows as they are read. Nothing is sent until the first
+// row (or finish), so an error before that can still be a normal JSON error.
+type exportStream struct {
+	w       http.ResponseWriter
+	format  string
+	name    string
+	header  []string
+	started bool
+	rows    int
+	csv     *csv.Writer
+	enc     *json.Encoder
+}
+
+func newExportStream(w http.ResponseWriter, format, name string, header []string) *exportStream {
+	return &exportStream{w: w, format: format, name: name, header: header}
+}
+
+func (s *exportStream) start() error {
+	s.started = true
+	h := s.w.Header()
+	h.Set("Content-Type", exportFormats[s.format])
+	h.Set("Content-Disposition", fmt.Sprintf(`attachment; filename="%s.%s"`, s.name, s.format))
+	h.Set("Cache-Control", "no-store")
+	s.w.WriteHeader(http.StatusOK)
+	switch s.format {
+	case "csv":
+		s.csv = csv.NewWriter(s.w)
+		return s.csv.Write(s.header)
+	case "json":
+		_, err := s.w.Write([]byte("["))
+		s.enc = json.NewEncoder(s.w)
+		return err
+	default:
+		s.enc = json.NewEncoder(s.w)
+	}
+	return nil
+}
+
+// write sends one row: v for JSON formats, record for CSV.
+func (s *exportStream) write(v any, record []string) error {
+	if !s.started {
+		if err := s.start(); err != nil {
+			return err
+		}
+	}
+	var err error
+	switch s.format {
+	case "csv":
+		err = s.csv.Write(record)
+	case "json":
+		if s.rows > 0 {
+			if _, err = s.w.Write([]byte(",")); err != nil {
+				return err
+			}
+		}
+		err = s.enc.Encode(v)
+	default:
+		err = s.enc.Encode(v)
+	}
+	if err != nil {
+		return err
+	}
+	s.rows++
+	if s.rows%exportFlushEvery == 0 {
+		s.flush()
+	}
+	return nil
+}
+
+func (s *exportStream) flush() {
+	if s.csv != nil {
+		s.csv.Flush()
+	}
+	if f, ok := s.w.(http.Flusher); ok {
+		f.Flush()
+	}
+}
+
+// finish ends the stream. A failure before the first row becomes an error
+// response; after that the response is cut short (JSON output is left
+// unterminated so clients notice) and the error is logged.
+func (s *exportStream) finish(err error) {
+	if err != nil {
+		if !s.started {
+			writeError(s.w, http.StatusInternalServerError, err.Error())
+			return
+		}
+		s.flush()
+		log.Printf("[export] %s aborted after %d row(s): %v", s.name, s.rows, err)
+		return
+	}
+	if !s.started {
+		if err := s.start(); err != nil {
+			return
+		}
+	}
+	if s.format == "json" {
+		_, _ = s.w.Write([]byte("]\n"))
+	}
+	s.flush()
+}
+
+// parseExportQuery reads format, from, to and game. Dates are RFC 3339
+// timestamps or YYYY-MM-DD days; a day in "to" includes the whole day.
+func parseExportQuery(r *http.Request) (format string, f exportFilter, msg string) {
+	q := r.URL.Query()
+	format = strings.ToLower(strings.TrimSpace(q.Get("format")))
+	if format == "" {
+		format = "json"
+	}
+	if _, ok := exportFormats[format]; !ok {
+		return "", f, "format must be csv, json or ndjson"
+	}
+	parse := func(key string, endOfDay bool) (time.Time, bool) {
+		v := strings.TrimSpace(q.Get(key))
+		if v == "" {
+			return time.Time{}, true
+		}
+		if t, err := time.Parse(time.RFC3339, v); err == nil {
+			return t, true
+		}
+		t, err := time.Parse(time.DateOnly, v)
+		if err != nil {
+			return time.Time{}, false
+		}
+		if endOfDay {
+			t = t.AddDate(0, 0, 1)
+		}
+		return t, true
+	}
+	var ok bool
+	if f.From, ok = parse("from", false); !ok {
+		return "", f, "from must be YYYY-MM-DD or an RFC 3339 timestamp"
+	}
+	if f.To, ok = parse("to", true); !ok {
+		return "", f, "to must be YYYY-MM-DD or an RFC 3339 timestamp"
+	}
+	if !f.From.IsZero() && !f.To.IsZero() && !f.From.Before(f.To) {
+		return "", f, "from must be before to"
+	}
+	for _, v := range q["game"] {
+		for _, id := range strings.Split(v, ",") {
+			if id = strings.TrimSpace(id); id != "" {
+				f.GameIDs = append(f.GameIDs, id)
+			}
+		}
+	}
+	if len(f.GameIDs) > maxExportGames {
+		return "", f, fmt.Sprintf("at most %d games", maxExportGames)
+	}
+	return format, f, ""
+}
+
+// GET /export/goal_events?format=csv&from=2026-01-01&to=2026-01-31&game=abc,def
+func getExportGoalEvents(w http.ResponseWriter, r *http.Request) {
+	if db == nil {
+		writeError(w, http.StatusNotImplemented, "database not configured")
+		return
+	}
+	format, f, msg := parseExportQuery(r)
+	if msg != "" {
+		writeError(w, http.StatusBadRequest, msg)
+		return
+	}
+	s := newExportStream(w, format, "goal_events", goalEventCSVHeader)
+	s.finish(db.ExportGoalEvents(r.Context(), f, func(e exportedGoalEvent) error {
+		return s.write(e, e.csvRecord())
+	}))
+}
+
+// GET /export/players?format=ndjson&from=2026-01-01&game=abc
+// from/to filter on last_seen; game keeps players who played in those games.
+func getExportPlayers(w http.ResponseWriter, r *http.Request) {
+	if db == nil {
+		writeError(w, http.StatusNotImplemented, "database not configured")
+		return
+	}
+	format, f, msg := parseExportQuery(r)
+	if msg != "" {
+		writeError(w, http.StatusBadRequest, msg)
+		return
+	}
+	s := newExportStream(w, format, "players", playerCSVHeader)
+	s.finish(db.ExportPlayers(r.Context(), f, func(p exportedPlayer) error {
+		return s.write(p, p.csvRecord())
+	}))
+}
@@ -0,0 +1,158 @@
+package main
+
+import (
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/gorilla/mux"
+)
+
+// POST /games/{gameId} {"command": "swap" | "substitute", ...}
+// Mid-game lineup changes; see gameCommandRequest. Each is one undo step
+// and is recorded in lineup_events.
+func postGameCommand(w http.ResponseWriter, r *http.Request) {
+	gameID := mux.Vars(r)["gameId"]
+	var req gameCommandRequest
+	if !decodeJSON(w, r, &req) {
+		return
+	}
+	var lc lineupChange
+	switch strings.ToLower(strings.TrimSpace(req.Command)) {
+	case "swap":
+		lc.Kind = "swap"
+		lc.Team = strings.ToLower(strings.TrimSpace(req.Team))
+		if lc.Team != "red" && lc.Team != "blue" {
+			writeError(w, http.StatusBadRequest, "team must be 'red' or 'blue'")
+			return
+		}
+	case "substitute":
+		lc.Kind = "substitute"
+		if strings.TrimSpace(req.Out) == "" || strings.TrimSpace(req.In) == "" {
+			writeError(w, http.StatusBadRequest, "out and in are required")
+			return
+		}
+		ids, err := findPlayers(r.Context(), req.In)
+		if err != nil {
+			writePlayerError(w, err)
+			return
+		}
+		lc.In = ids[0]
+		out, err := directory.Find(r.Context(), req.Out)
+		if err != nil {
+			writePlayerError(w, err)
+			return
+		}
+		lc.Out = formatPlayerID(out.ID)
+	default:
+		writeError(w, http.StatusBadRequest, "command must be 'swap' or 'substitute'")
+		return
+	}
+
+	gamesMu.Lock()
+	gs, ok := games[gameID]
+	if !ok {
+		gamesMu.Unlock()
+		writeError(w, http.StatusNotFound, "game not found")
+		return
+	}
+	if !gs.Started {
+		gamesMu.Unlock()
+		writeError(w, http.StatusConflict, "game not started")
+		return
+	}
+	var seq int64
+	if lc.Kind == "swap" {
+		team := gs.team(lc.Team)
+		if team.Forward == "" || team.Goalkeeper == "" {
+			gamesMu.Unlock()
+			writeError(w, http.StatusConflict, "team has an empty slot")
+			return
+		}
+		seq = pushHistory(gs)
+		gs.swapPositions(lc.Team)
+	} else {
+		team, pos := gs.slotOf(lc.Out)
+		if team == "" {
+			gamesMu.Unlock()
+			writeError(w, http.StatusConflict, "out is not playing in this game")
+			return
+		}
+		queuePos := gs.waitingPosition(lc.In)
+		if queuePos == 0 {
+			gamesMu.Unlock()
+			writeError(w, http.StatusConflict, "in is not waiting in this game")
+			return
+		}
+		lc.Team, lc.Position = team, pos
+		seq = pushHistory(gs)
+		gs.substitute(lc, queuePos)
+	}
+	stateCopy := GameState{Red: gs.Red, Blue: gs.Blue}
+	resp := toGameResponse(gs, nil)
+	gamesMu.Unlock()
+
+	if db != nil {
+		db.EnqueueLineupChange(gameID, seq, lc, stateCopy)
+	}
+	events.Publish(gameEvent{Type: lc.Kind, GameID: gameID, PlayerID: lc.In, Data: map[string]any{
+		"team": lc.Team, "position": lc.Position, "out": lc.Out, "in": lc.In,
+		"forward": stateCopy.team(lc.Team).Forward, "goalkeeper": stateCopy.team(lc.Team).Goalkeeper,
+	}})
+
+	resp.Lineup = &lc
+	writeJSON(w, http.StatusOK, resp)
+}
+
+// team returns a pointer to the named team ("red" or "blue").
+func (gs *GameState) team(name string) *TeamState {
+	if name == "blue" {
+		return &gs.Blue
+	}
+	return &gs.Red
+}
+
+// slotOf finds where id is playing: team and position, or "" if benched.
+func (gs *GameState) slotOf(id string) (team, position string) {
+	switch id {
+	case gs.Red.Forward:
+		return "red", "forward"
+	case gs.Red.Goalkeeper:
+		return "red", "goalkeeper"
+	case gs.Blue.Forward:
+		return "blue", "forward"
+	case gs.Blue.Goalkeeper:
+		return "blue", "goalkeeper"
+	}
+	return "", ""
+}
+
+// swapPositions exchanges a team's forward and goalkeeper. The pair is
+// unchanged, so a running streak carries on with the positions swapped.
+func (gs *GameState) swapPositions(name string) {
+	t := gs.team(name)
+	if gs.StreakTeam == name && gs.StreakForward == t.Forward && gs.StreakGoalkeeper == t.Goalkeeper {
+		gs.StreakForward, gs.StreakGoalkeeper = gs.StreakGoalkeeper, gs.StreakForward
+	}
+	t.Forward, t.Goalkeeper = t.Goalkeeper, t.Forward
+}
+
+// substitute puts lc.In into lc.Out's slot and lc.Out into the queue at
+// lc.In's former position. Substituting into the streak team ends the
+// streak: it belongs to a pair that is no longer together.
+func (gs *GameState) substitute(lc lineupChange, queuePos int) {
+	t := gs.team(lc.Team)
+	if gs.StreakTeam == lc.Team && (gs.StreakForward == lc.Out || gs.StreakGoalkeeper == lc.Out) {
+		gs.StreakTeam, gs.StreakForward, gs.StreakGoalkeeper = "", "", ""
+		gs.StreakOppStartF, gs.StreakOppStartG = "", ""
+		gs.StreakAwarded = false
+	}
+	if lc.Position == "forward" {
+		t.Forward = lc.In
+	} else {
+		t.Goalkeeper = lc.In
+	}
+	gs.removeWaiting(lc.In)
+	gs.enqueueWaiting(lc.Out, time.Now())
+	gs.moveWaiting(lc.Out, queuePos)
+}
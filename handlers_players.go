@@ -1,10 +1,18 @@
 package main
 
 import (
-	"encoding/json"
+	"context"
+	"errors"
+	"fmt"
+	"log"
 	"net/http"
+	"net/url"
 	"strconv"
 	"strings"
+	"time"
+	"unicode/utf8"
+
+	"github.com/gorilla/mux"
 )
 
 // GET /players?query=foo&limit=20
@@ -31,36 +39,170 @@ func getPlayers(w http.ResponseWriter, r *http.Request) {
 
 type createPlayerRequest struct {
 	Name string `json:"name"`
+	// Optional profile, applied only when the player is created
+	AvatarURL     *string `json:"avatar_url"`
+	Nickname      *string `json:"nickname"`
+	PreferredRole *string `json:"preferred_role"`
 }
 
-// POST /players {"name": "alice"}
-// Upserts a player by name and returns the record.
+// playerCreateTimeout bounds the synchronous DB work of POST /players.
+const playerCreateTimeout = 5 * time.Second
+
+// POST /players {"name": "alice", "nickname": "Al", "preferred_role": "forward"}
+// Creates a player by name and returns the full record: 201 when created,
+// 200 when the name already existed. Profile fields for an existing name are
+// refused (409) rather than overwriting it; use PATCH /players/{id}.
+// Without a database the player is created in memory (no profile).
 func postPlayer(w http.ResponseWriter, r *http.Request) {
+	var req createPlayerRequest
+	if !decodeJSON(w, r, &req) {
+		return
+	}
+	name := normalizePlayerName(req.Name)
+	if name == "" {
+		writeError(w, http.StatusBadRequest, "name is required")
+		return
+	}
+	profile, msg := validatePlayerProfile(req.AvatarURL, req.Nickname, req.PreferredRole)
+	if msg != "" {
+		writeError(w, http.StatusBadRequest, msg)
+		return
+	}
+	if db == nil && !profile.empty() {
+		writeError(w, http.StatusNotImplemented, "database not configured; player profiles cannot be stored")
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(r.Context(), playerCreateTimeout)
+	defer cancel()
+	p, created, err := directory.Ensure(ctx, name)
+	if err == nil && !created && !profile.empty() {
+		writeError(w, http.StatusConflict, fmt.Sprintf("player already exists (id %d); update the profile with PATCH /players/%d", p.ID, p.ID))
+		return
+	}
+	if err == nil && !profile.empty() {
+		p, err = db.UpdatePlayerProfile(ctx, p.ID, profile)
+	}
+	if err != nil {
+		if errors.Is(err, context.DeadlineExceeded) {
+			writeError(w, http.StatusGatewayTimeout, "timed out creating player")
+			return
+		}
+		writePlayerError(w, err)
+		return
+	}
+	status := http.StatusOK
+	if created {
+		status = http.StatusCreated
+	}
+	writeJSON(w, status, p)
+}
+
+type updatePlayerRequest struct {
+	AvatarURL     *string `json:"avatar_url"`
+	Nickname      *string `json:"nickname"`
+	PreferredRole *string `json:"preferred_role"`
+}
+
+// PATCH /players/{id} {"nickname": "Al"}
+// Sets the provided profile fields; omitted fields are left unchanged and
+// empty strings clear them.
+func patchPlayer(w http.ResponseWriter, r *http.Request) {
 	if db == nil {
 		writeError(w, http.StatusNotImplemented, "database not configured")
 		return
 	}
-	var req createPlayerRequest
-	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
-		writeError(w, http.StatusBadRequest, "invalid JSON body")
+	id, ok := playerRefID(mux.Vars(r)["id"])
+	if !ok {
+		writeError(w, http.StatusBadRequest, "invalid player id")
 		return
 	}
-	name := strings.TrimSpace(req.Name)
-	if name == "" {
-		writeError(w, http.StatusBadRequest, "name is required")
+	var req updatePlayerRequest
+	if !decodeJSON(w, r, &req) {
+		return
+	}
+	profile, msg := validatePlayerProfile(req.AvatarURL, req.Nickname, req.PreferredRole)
+	if msg != "" {
+		writeError(w, http.StatusBadRequest, msg)
+		return
+	}
+	p, err := directory.Record(r.Context(), id)
+	if err == nil && !profile.empty() {
+		p, err = db.UpdatePlayerProfile(r.Context(), p.ID, profile)
+	}
+	if err != nil {
+		writePlayerError(w, err)
 		return
 	}
-	// Enqueue creation; return minimal response
-	db.EnqueueEnsurePlayers([]string{name})
-	writeJSON(w, http.StatusOK, Player{ID: 0, Name: name})
+	writeJSON(w, http.StatusOK, p)
+}
+
+// validatePlayerProfile checks optional profile fields, returning an error
+// message for the first invalid one.
+func validatePlayerProfile(avatarURL, nickname, role *string) (playerProfile, string) {
+	var pp playerProfile
+	if avatarURL != nil {
+		v := strings.TrimSpace(*avatarURL)
+		if v != "" {
+			u, err := url.Parse(v)
+			if err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" || len(v) > 255 {
+				return pp, "avatar_url must be an http(s) URL of at most 255 characters"
+			}
+		}
+		pp.AvatarURL = &v
+	}
+	if nickname != nil {
+		v := normalizePlayerName(*nickname)
+		if utf8.RuneCountInString(v) > 50 {
+			return pp, "nickname must be at most 50 characters"
+		}
+		pp.Nickname = &v
+	}
+	if role != nil {
+		v := strings.ToLower(strings.TrimSpace(*role))
+		switch v {
+		case "", "forward", "goalkeeper", "any":
+		default:
+			return pp, "preferred_role must be 'forward', 'goalkeeper' or 'any'"
+		}
+		pp.PreferredRole = &v
+	}
+	return pp, ""
 }
 
-// GET /players/stats?names=a,b,c
+// GET /players/stats?ids=1,2,3 (or legacy ?names=a,b,c)
 func getPlayersStats(w http.ResponseWriter, r *http.Request) {
 	if db == nil {
 		writeError(w, http.StatusNotImplemented, "database not configured")
 		return
 	}
+	if rawIDs := strings.TrimSpace(r.URL.Query().Get("ids")); rawIDs != "" {
+		var ids []int64
+		for _, part := range strings.Split(rawIDs, ",") {
+			if id, ok := playerRefID(part); ok {
+				ids = append(ids, id)
+			}
+		}
+		stats, err := db.GetPlayersByIDs(r.Context(), ids)
+		if err != nil {
+			writeError(w, http.StatusInternalServerError, err.Error())
+			return
+		}
+		// Return in the order of requested IDs
+		res := make([]Player, 0, len(ids))
+		seen := map[int64]struct{}{}
+		for _, id := range ids {
+			if _, ok := seen[id]; ok {
+				continue
+			}
+			seen[id] = struct{}{}
+			if p, ok := stats[id]; ok {
+				res = append(res, p)
+			}
+		}
+		writeJSON(w, http.StatusOK, res)
+		return
+	}
 	raw := strings.TrimSpace(r.URL.Query().Get("names"))
 	if raw == "" {
 		writeJSON(w, http.StatusOK, []Player{})
@@ -110,3 +252,168 @@ func getLeaderboardData(w http.ResponseWriter, r *http.Request) {
 	}
 	writeJSON(w, http.StatusOK, players)
 }
+
+// GET /players/{id}
+func getPlayer(w http.ResponseWriter, r *http.Request) {
+	id, ok := playerRefID(mux.Vars(r)["id"])
+	if !ok {
+		writeError(w, http.StatusBadRequest, "invalid player id")
+		return
+	}
+	p, err := directory.Record(r.Context(), id)
+	if err != nil {
+		writePlayerError(w, err)
+		return
+	}
+	writeJSON(w, http.StatusOK, p)
+}
+
+type renamePlayerRequest struct {
+	Name string `json:"name"`
+}
+
+// POST /players/{id}/rename {"name": "Alice B."}
+// Changes the display name; game state and stats are keyed by ID and unaffected.
+func postRenamePlayer(w http.ResponseWriter, r *http.Request) {
+	id, ok := playerRefID(mux.Vars(r)["id"])
+	if !ok {
+		writeError(w, http.StatusBadRequest, "invalid player id")
+		return
+	}
+	var req renamePlayerRequest
+	if !decodeJSON(w, r, &req) {
+		return
+	}
+	p, err := directory.Rename(r.Context(), id, req.Name)
+	if err != nil {
+		writePlayerError(w, err)
+		return
+	}
+	writeJSON(w, http.StatusOK, p)
+}
+
+type mergePlayersRequest struct {
+	From string `json:"from"`
+	Into string `json:"into"`
+}
+
+// POST /players/merge {"from": "12", "into": "7"}
+// Folds one player's goal events and counters into another. The merged
+// player's name keeps resolving to the surviving record.
+func postMergePlayers(w http.ResponseWriter, r *http.Request) {
+	var req mergePlayersRequest
+	if !decodeJSON(w, r, &req) {
+		return
+	}
+	from, err := directory.Find(r.Context(), req.From)
+	if err != nil {
+		writePlayerError(w, err)
+		return
+	}
+	into, err := directory.Find(r.Context(), req.Into)
+	if err != nil {
+		writePlayerError(w, err)
+		return
+	}
+	if from.ID == into.ID {
+		writeError(w, http.StatusBadRequest, "cannot merge a player into itself")
+		return
+	}
+	fromID, intoID := formatPlayerID(from.ID), formatPlayerID(into.ID)
+	if where, ok := playersShareGame(fromID, intoID); ok {
+		writeError(w, http.StatusConflict, "both players are in "+where)
+		return
+	}
+	p, err := directory.Merge(r.Context(), from.ID, into.ID)
+	if err != nil {
+		writePlayerError(w, err)
+		return
+	}
+	for _, gid := range replacePlayerInGames(fromID, intoID) {
+		log.Printf("[players] merged %s into %s, but both are on the table in game %s; left it unchanged", fromID, intoID, gid)
+	}
+	writeJSON(w, http.StatusOK, p)
+}
+
+// POST /players/{id}/deactivate
+// Hides the player from search and the leaderboard and keeps them out of new games.
+func postDeactivatePlayer(w http.ResponseWriter, r *http.Request) {
+	setPlayerActive(w, r, false)
+}
+
+// POST /players/{id}/reactivate
+func postReactivatePlayer(w http.ResponseWriter, r *http.Request) {
+	setPlayerActive(w, r, true)
+}
+
+func setPlayerActive(w http.ResponseWriter, r *http.Request, active bool) {
+	if db == nil {
+		writeError(w, http.StatusNotImplemented, "database not configured")
+		return
+	}
+	id, ok := playerRefID(mux.Vars(r)["id"])
+	if !ok {
+		writeError(w, http.StatusBadRequest, "invalid player id")
+		return
+	}
+	p, err := db.SetPlayerActive(r.Context(), id, active)
+	if err != nil {
+		writePlayerError(w, err)
+		return
+	}
+	directory.remember(p)
+	if active && !p.Active {
+		writeError(w, http.StatusConflict, "anonymized players cannot be reactivated")
+		return
+	}
+	writeJSON(w, http.StatusOK, p)
+}
+
+// POST /players/{id}/anonymize
+// Erases the player's personal data; goal events and aggregate stats stay.
+func postAnonymizePlayer(w http.ResponseWriter, r *http.Request) {
+	if db == nil {
+		writeError(w, http.StatusNotImplemented, "database not configured")
+		return
+	}
+	id, ok := playerRefID(mux.Vars(r)["id"])
+	if !ok {
+		writeError(w, http.StatusBadRequest, "invalid player id")
+		return
+	}
+	p, err := db.AnonymizePlayer(r.Context(), id)
+	if err != nil {
+		writePlayerError(w, err)
+		return
+	}
+	directory.remember(p)
+	pins.Forget(p.ID)
+	slackLinks.Forget(p.ID)
+	// The player's tokens were revoked in the database; drop them here too
+	if err := tokens.load(r.Context()); err != nil {
+		log.Printf("[auth] reload tokens after anonymizing player %d: %v", p.ID, err)
+	}
+	writeJSON(w, http.StatusOK, p)
+}
+
+// GET /players/{id}/export
+// Returns everything stored about the player.
+func getPlayerExport(w http.ResponseWriter, r *http.Request) {
+	if db == nil {
+		writeError(w, http.StatusNotImplemented, "database not configured")
+		return
+	}
+	id, ok := playerRefID(mux.Vars(r)["id"])
+	if !ok {
+		writeError(w, http.StatusBadRequest, "invalid player id")
+		return
+	}
+	exp, err := db.ExportPlayer(r.Context(), id)
+	if err != nil {
+		writePlayerError(w, err)
+		return
+	}
+	exp.CurrentGames = gamesWithPlayer(formatPlayerID(exp.Player.ID))
+	w.Header().Set("Content-Disposition", fmt.Sprintf(`attachment; filename="player-%d.json"`, exp.Player.ID))
+	writeJSON(w, http.StatusOK, exp)
+}
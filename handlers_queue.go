@@ -0,0 +1,388 @@
+package main
+
+import (
+	"log"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/gorilla/mux"
+)
+
+// maxStepAsideMinutes caps how long a place can be held.
+const maxStepAsideMinutes = 120
+
+// queueTarget resolves the player a queue command is about, defaulting to
+// the caller for player sessions, and checks the caller may act for them.
+func queueTarget(w http.ResponseWriter, r *http.Request, ref string) (string, bool) {
+	caller := identityFrom(r)
+	ref = strings.TrimSpace(ref)
+	if ref == "" && caller.Role < roleReferee {
+		ref = caller.PlayerID
+	}
+	if ref == "" {
+		writeError(w, http.StatusBadRequest, "player_id is required")
+		return "", false
+	}
+	p, err := directory.Find(r.Context(), ref)
+	if err != nil {
+		writePlayerError(w, err)
+		return "", false
+	}
+	id := formatPlayerID(p.ID)
+	if !caller.actsFor(id) {
+		writeError(w, http.StatusForbidden, "players can only manage their own place in the queue")
+		return "", false
+	}
+	return id, true
+}
+
+// POST /games/{gameId}/queue/step-aside {"player_id": "12", "minutes": 10}
+// Lets a waiting player skip their turn without losing their place: without
+// minutes the next rotation passes them over once, with minutes every
+// rotation does until the reservation ends. {"cancel": true} clears both.
+func postStepAside(w http.ResponseWriter, r *http.Request) {
+	gameID := mux.Vars(r)["gameId"]
+	var req stepAsideRequest
+	if !decodeJSON(w, r, &req) {
+		return
+	}
+	if req.Minutes < 0 || req.Minutes > maxStepAsideMinutes {
+		writeError(w, http.StatusBadRequest, "minutes must be between 0 and 120")
+		return
+	}
+	id, ok := queueTarget(w, r, req.PlayerID)
+	if !ok {
+		return
+	}
+
+	gamesMu.Lock()
+	gs, ok := games[gameID]
+	if !ok {
+		gamesMu.Unlock()
+		writeError(w, http.StatusNotFound, "game not found")
+		return
+	}
+	e, ok := gs.QueueMeta[id]
+	if !ok {
+		gamesMu.Unlock()
+		writeError(w, http.StatusNotFound, "player is not waiting in this game")
+		return
+	}
+	// Snapshot before mutation for undo
+	pushHistory(gs)
+	switch {
+	case req.Cancel:
+		e.SkipNext = false
+		e.ReservedUntil = nil
+	case req.Minutes > 0:
+		until := time.Now().Add(time.Duration(req.Minutes) * time.Minute)
+		e.ReservedUntil = &until
+	default:
+		e.SkipNext = true
+	}
+	gs.QueueMeta[id] = e
+	resp := toGameResponse(gs, nil)
+	gamesMu.Unlock()
+
+	writeJSON(w, http.StatusOK, resp)
+}
+
+// POST /games/{gameId}/queue/move {"player_id": "12", "position": 1}
+// Moves a waiting player to a 1-based position (clamped to the queue).
+func postMoveInQueue(w http.ResponseWriter, r *http.Request) {
+	gameID := mux.Vars(r)["gameId"]
+	var req moveRequest
+	if !decodeJSON(w, r, &req) {
+		return
+	}
+	if req.Position < 1 {
+		writeError(w, http.StatusBadRequest, "position must be 1 or more")
+		return
+	}
+	id, ok := queueTarget(w, r, req.PlayerID)
+	if !ok {
+		return
+	}
+
+	gamesMu.Lock()
+	gs, ok := games[gameID]
+	if !ok {
+		gamesMu.Unlock()
+		writeError(w, http.StatusNotFound, "game not found")
+		return
+	}
+	if _, ok := gs.QueueMeta[id]; !ok {
+		gamesMu.Unlock()
+		writeError(w, http.StatusNotFound, "player is not waiting in this game")
+		return
+	}
+	// Snapshot before mutation for undo
+	pushHistory(gs)
+	gs.moveWaiting(id, req.Position)
+	resp := toGameResponse(gs, nil)
+	gamesMu.Unlock()
+
+	writeJSON(w, http.StatusOK, resp)
+}
+
+// POST /games/{gameId}/queue/priority {"player_id": "12", "priority": 1}
+// Gives a player (e.g. a visitor) a priority bump for this game: they are
+// queued ahead of players with a lower priority now and whenever they
+// rejoin after being benched. Priority 0 removes the bump.
+func postQueuePriority(w http.ResponseWriter, r *http.Request) {
+	gameID := mux.Vars(r)["gameId"]
+	var req priorityRequest
+	if !decodeJSON(w, r, &req) {
+		return
+	}
+	if req.Priority < 0 || req.Priority > 100 {
+		writeError(w, http.StatusBadRequest, "priority must be between 0 and 100")
+		return
+	}
+	id, ok := queueTarget(w, r, req.PlayerID)
+	if !ok {
+		return
+	}
+
+	gamesMu.Lock()
+	gs, ok := games[gameID]
+	if !ok {
+		gamesMu.Unlock()
+		writeError(w, http.StatusNotFound, "game not found")
+		return
+	}
+	if !playerExistsInGame(gs, id) {
+		gamesMu.Unlock()
+		writeError(w, http.StatusNotFound, "player not found in game")
+		return
+	}
+	// Snapshot before mutation for undo
+	pushHistory(gs)
+	gs.setPriority(id, req.Priority)
+	resp := toGameResponse(gs, nil)
+	gamesMu.Unlock()
+
+	writeJSON(w, http.StatusOK, resp)
+}
+
+// POST /games/{gameId}/queue/ready {"player_id": "12"}
+// Confirms a pending ready check (the player up next is at the table).
+func postQueueReady(w http.ResponseWriter, r *http.Request) {
+	gameID := mux.Vars(r)["gameId"]
+	var req queueRequest
+	if !decodeJSON(w, r, &req) {
+		return
+	}
+	id, ok := queueTarget(w, r, req.PlayerID)
+	if !ok {
+		return
+	}
+
+	gamesMu.Lock()
+	gs, ok := games[gameID]
+	if !ok {
+		gamesMu.Unlock()
+		writeError(w, http.StatusNotFound, "game not found")
+		return
+	}
+	now := time.Now()
+	if !gs.confirmReady(id, now) {
+		gamesMu.Unlock()
+		writeError(w, http.StatusConflict, "no ready check pending for this player")
+		return
+	}
+	resp := toGameResponse(gs, nil)
+	gamesMu.Unlock()
+
+	log.Printf("[ready] game %s: %s (%s) confirmed", gameID, id, directory.Name(id))
+	events.Publish(gameEvent{Type: "ready_confirmed", GameID: gameID, PlayerID: id, At: now})
+	writeJSON(w, http.StatusOK, resp)
+}
+
+// maxBatchPlayers caps the players in one bulk queue request.
+const maxBatchPlayers = 64
+
+// decodeBatch reads a batch request and resolves its players: new names
+// are created when create is set, otherwise every player must exist.
+func decodeBatch(w http.ResponseWriter, r *http.Request, create bool) ([]string, bool) {
+	var req batchQueueRequest
+	if !decodeJSON(w, r, &req) {
+		return nil, false
+	}
+	if len(req.PlayerIDs) == 0 {
+		writeError(w, http.StatusBadRequest, "player_ids is required")
+		return nil, false
+	}
+	if len(req.PlayerIDs) > maxBatchPlayers {
+		writeError(w, http.StatusBadRequest, "too many player_ids")
+		return nil, false
+	}
+	if containsEmptyIDs(req.PlayerIDs...) {
+		writeError(w, http.StatusBadRequest, "empty player_id in player_ids")
+		return nil, false
+	}
+	resolve := findPlayers
+	if create {
+		resolve = resolvePlayers
+	}
+	ids, err := resolve(r.Context(), req.PlayerIDs...)
+	if err != nil {
+		writePlayerError(w, err)
+		return nil, false
+	}
+	if dup, ok := hasDuplicate(ids); ok {
+		writeError(w, http.StatusBadRequest, "duplicate player_id: "+dup+" ("+directory.Name(dup)+")")
+		return nil, false
+	}
+	return ids, true
+}
+
+// POST /games/{gameId}/queue/batch-add {"player_ids": ["alice", "12"]}
+// Appends several players in order as one undo step.
+func postQueueBatchAdd(w http.ResponseWriter, r *http.Request) {
+	gameID := mux.Vars(r)["gameId"]
+	ids, ok := decodeBatch(w, r, true)
+	if !ok {
+		return
+	}
+
+	gamesMu.Lock()
+	gs, ok := games[gameID]
+	if !ok {
+		gamesMu.Unlock()
+		writeError(w, http.StatusNotFound, "game not found")
+		return
+	}
+	if gs.Match != nil {
+		gamesMu.Unlock()
+		writeError(w, http.StatusConflict, "tournament matches have no waiting queue")
+		return
+	}
+	if dup, ok := hasDuplicate(append(collectAllIDs(gs), ids...)); ok {
+		gamesMu.Unlock()
+		writeError(w, http.StatusConflict, "player_id already exists in game: "+dup+" ("+directory.Name(dup)+")")
+		return
+	}
+	if id, ok := venueConflict(gs, gameID, ids...); ok {
+		gamesMu.Unlock()
+		writeError(w, http.StatusConflict, "player is already at another table or in the venue queue: "+id+" ("+directory.Name(id)+")")
+		return
+	}
+	// Snapshot before mutation for undo
+	pushHistory(gs)
+	now := time.Now()
+	evs := make([]gameEvent, 0, len(ids))
+	for _, id := range ids {
+		gs.enqueueWaiting(id, now)
+		evs = append(evs, queueJoinedEvent(gameID, gs, id))
+	}
+	resp := toGameResponse(gs, nil)
+	gamesMu.Unlock()
+
+	for _, ev := range evs {
+		events.Publish(ev)
+	}
+	writeJSON(w, http.StatusOK, resp)
+}
+
+// POST /games/{gameId}/queue/batch-remove {"player_ids": ["12", "13"]}
+// Removes several waiting players as one undo step; all must be waiting.
+func postQueueBatchRemove(w http.ResponseWriter, r *http.Request) {
+	gameID := mux.Vars(r)["gameId"]
+	ids, ok := decodeBatch(w, r, false)
+	if !ok {
+		return
+	}
+
+	gamesMu.Lock()
+	gs, ok := games[gameID]
+	if !ok {
+		gamesMu.Unlock()
+		writeError(w, http.StatusNotFound, "game not found")
+		return
+	}
+	for _, id := range ids {
+		if gs.waitingPosition(id) == 0 {
+			gamesMu.Unlock()
+			writeError(w, http.StatusNotFound, "player is not waiting in this game: "+id+" ("+directory.Name(id)+")")
+			return
+		}
+	}
+	// Snapshot before mutation for undo
+	pushHistory(gs)
+	for _, id := range ids {
+		gs.removeWaiting(id)
+	}
+	resp := toGameResponse(gs, nil)
+	gamesMu.Unlock()
+
+	for _, id := range ids {
+		events.Publish(gameEvent{Type: "player_left", GameID: gameID, PlayerID: id})
+	}
+	writeJSON(w, http.StatusOK, resp)
+}
+
+// POST /games/{gameId}/queue/reorder {"player_ids": ["13", "12", "14"]}
+// Sets the complete queue order; the list must hold exactly the players
+// currently waiting.
+func postQueueReorder(w http.ResponseWriter, r *http.Request) {
+	gameID := mux.Vars(r)["gameId"]
+	ids, ok := decodeBatch(w, r, false)
+	if !ok {
+		return
+	}
+
+	gamesMu.Lock()
+	gs, ok := games[gameID]
+	if !ok {
+		gamesMu.Unlock()
+		writeError(w, http.StatusNotFound, "game not found")
+		return
+	}
+	if len(ids) != gs.Waiting.Len() {
+		gamesMu.Unlock()
+		writeError(w, http.StatusConflict, "player_ids must list every waiting player exactly once")
+		return
+	}
+	for _, id := range ids {
+		if gs.waitingPosition(id) == 0 {
+			gamesMu.Unlock()
+			writeError(w, http.StatusConflict, "player is not waiting in this game: "+id+" ("+directory.Name(id)+")")
+			return
+		}
+	}
+	// Snapshot before mutation for undo
+	pushHistory(gs)
+	gs.reorderWaiting(ids)
+	resp := toGameResponse(gs, nil)
+	gamesMu.Unlock()
+
+	writeJSON(w, http.StatusOK, resp)
+}
+
+// POST /games/{gameId}/queue/shuffle
+// Randomizes the queue order (players with a priority bump stay ahead).
+func postQueueShuffle(w http.ResponseWriter, r *http.Request) {
+	gameID := mux.Vars(r)["gameId"]
+
+	gamesMu.Lock()
+	gs, ok := games[gameID]
+	if !ok {
+		gamesMu.Unlock()
+		writeError(w, http.StatusNotFound, "game not found")
+		return
+	}
+	if gs.Waiting.Len() < 2 {
+		gamesMu.Unlock()
+		writeError(w, http.StatusConflict, "nothing to shuffle")
+		return
+	}
+	// Snapshot before mutation for undo
+	pushHistory(gs)
+	gs.shuffleWaiting()
+	resp := toGameResponse(gs, nil)
+	gamesMu.Unlock()
+
+	writeJSON(w, http.StatusOK, resp)
+}
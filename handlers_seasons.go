@@ -0,0 +1,253 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+	"unicode/utf8"
+
+	"github.com/gorilla/mux"
+)
+
+const (
+	// maxSeasonTeams caps a season's participants
+	maxSeasonTeams = 32
+	// seasonWriteTimeout bounds the synchronous DB work of season writes
+	seasonWriteTimeout = 10 * time.Second
+	// maxSeasonTeamNameLen matches season_teams.name VARCHAR(100)
+	maxSeasonTeamNameLen = 100
+)
+
+// createSeasonRequest defines a season. Teams are fixed pairs (player IDs
+// or names); Name defaults to "Forward & Goalkeeper". Legs is 1 (each pair
+// of teams meets once) or 2 (home and away).
+type createSeasonRequest struct {
+	Name     string        `json:"name"`
+	StartsOn string        `json:"starts_on"`
+	EndsOn   string        `json:"ends_on"`
+	Legs     int           `json:"legs"`
+	Teams    []pairRequest `json:"teams"`
+}
+
+type fixtureResultRequest struct {
+	HomeScore *int `json:"home_score"`
+	AwayScore *int `json:"away_score"`
+}
+
+// writeSeasonError maps season DB errors to HTTP responses.
+func writeSeasonError(w http.ResponseWriter, err error) {
+	switch {
+	case errors.Is(err, errSeasonNotFound):
+		writeError(w, http.StatusNotFound, "season not found")
+	case errors.Is(err, errFixtureNotFound):
+		writeError(w, http.StatusNotFound, "fixture not found")
+	case errors.Is(err, errSeasonNameTaken):
+		writeError(w, http.StatusConflict, "season name already taken")
+	case errors.Is(err, context.DeadlineExceeded):
+		writeError(w, http.StatusGatewayTimeout, "timed out")
+	default:
+		writeError(w, http.StatusInternalServerError, err.Error())
+	}
+}
+
+// seasonID parses the {seasonId} route variable.
+func seasonID(w http.ResponseWriter, r *http.Request) (int64, bool) {
+	id, err := strconv.ParseInt(mux.Vars(r)["seasonId"], 10, 64)
+	if err != nil || id <= 0 {
+		writeError(w, http.StatusBadRequest, "invalid season id")
+		return 0, false
+	}
+	return id, true
+}
+
+// POST /seasons {"name": "Autumn 2026", "starts_on": "2026-09-01", "ends_on": "2026-12-15", "legs": 2, "teams": [...]}
+// Creates the season with its teams and a round-robin fixture list spread
+// over the date range.
+func postSeason(w http.ResponseWriter, r *http.Request) {
+	if db == nil {
+		writeError(w, http.StatusNotImplemented, "database not configured")
+		return
+	}
+	var req createSeasonRequest
+	if !decodeJSON(w, r, &req) {
+		return
+	}
+	req.Name = strings.TrimSpace(req.Name)
+	if req.Name == "" || len(req.Name) > 100 {
+		writeError(w, http.StatusBadRequest, "name is required (at most 100 characters)")
+		return
+	}
+	start, err1 := time.Parse(seasonDateLayout, strings.TrimSpace(req.StartsOn))
+	end, err2 := time.Parse(seasonDateLayout, strings.TrimSpace(req.EndsOn))
+	if err1 != nil || err2 != nil {
+		writeError(w, http.StatusBadRequest, "starts_on and ends_on must be dates (YYYY-MM-DD)")
+		return
+	}
+	if end.Before(start) {
+		writeError(w, http.StatusBadRequest, "ends_on is before starts_on")
+		return
+	}
+	if req.Legs == 0 {
+		req.Legs = 1
+	}
+	if req.Legs != 1 && req.Legs != 2 {
+		writeError(w, http.StatusBadRequest, "legs must be 1 or 2")
+		return
+	}
+	if len(req.Teams) < 2 || len(req.Teams) > maxSeasonTeams {
+		writeError(w, http.StatusBadRequest, "a season needs between 2 and 32 teams")
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(r.Context(), seasonWriteTimeout)
+	defer cancel()
+	s := season{Name: req.Name, StartsOn: start.Format(seasonDateLayout), EndsOn: end.Format(seasonDateLayout), Legs: req.Legs}
+	// Same rules as tournament pairs: two different players, one team each
+	teams := make([]tournamentPair, 0, len(req.Teams))
+	names := map[string]bool{}
+	for _, pr := range req.Teams {
+		p, ok := resolvePair(ctx, w, pr)
+		if !ok {
+			return
+		}
+		if utf8.RuneCountInString(p.Name) > maxSeasonTeamNameLen {
+			writeError(w, http.StatusBadRequest, "team name is longer than 100 characters: "+p.Name)
+			return
+		}
+		if q, id, ok := pairConflict(teams, p); ok {
+			writeError(w, http.StatusBadRequest, "player already in team "+q.Name+": "+id+" ("+directory.Name(id)+")")
+			return
+		}
+		key := strings.ToLower(p.Name)
+		if names[key] {
+			writeError(w, http.StatusBadRequest, "duplicate team name: "+p.Name)
+			return
+		}
+		names[key] = true
+		teams = append(teams, p)
+		s.Teams = append(s.Teams, seasonTeam{Name: p.Name, Forward: p.Forward, Goalkeeper: p.Goalkeeper})
+	}
+	s, err := db.CreateSeason(ctx, s, seasonFixtures(len(s.Teams), s.Legs, start, end))
+	if err != nil {
+		writeSeasonError(w, err)
+		return
+	}
+	writeJSON(w, http.StatusCreated, s)
+}
+
+// GET /seasons
+func getSeasons(w http.ResponseWriter, r *http.Request) {
+	if db == nil {
+		writeError(w, http.StatusNotImplemented, "database not configured")
+		return
+	}
+	res, err := db.ListSeasons(r.Context())
+	if err != nil {
+		writeSeasonError(w, err)
+		return
+	}
+	writeJSON(w, http.StatusOK, res)
+}
+
+// GET /seasons/{seasonId}
+func getSeason(w http.ResponseWriter, r *http.Request) {
+	if db == nil {
+		writeError(w, http.StatusNotImplemented, "database not configured")
+		return
+	}
+	id, ok := seasonID(w, r)
+	if !ok {
+		return
+	}
+	s, err := db.GetSeason(r.Context(), id)
+	if err != nil {
+		writeSeasonError(w, err)
+		return
+	}
+	writeJSON(w, http.StatusOK, s)
+}
+
+// GET /seasons/{seasonId}/fixtures?round=3&team=12
+func getSeasonFixtures(w http.ResponseWriter, r *http.Request) {
+	if db == nil {
+		writeError(w, http.StatusNotImplemented, "database not configured")
+		return
+	}
+	id, ok := seasonID(w, r)
+	if !ok {
+		return
+	}
+	q := r.URL.Query()
+	round, _ := strconv.Atoi(q.Get("round"))
+	team, _ := strconv.ParseInt(q.Get("team"), 10, 64)
+	if _, err := db.GetSeason(r.Context(), id); err != nil {
+		writeSeasonError(w, err)
+		return
+	}
+	res, err := db.ListFixtures(r.Context(), id, round, team)
+	if err != nil {
+		writeSeasonError(w, err)
+		return
+	}
+	writeJSON(w, http.StatusOK, res)
+}
+
+// POST /seasons/{seasonId}/fixtures/{fixtureId}/result {"home_score": 10, "away_score": 8}
+// Records or corrects a fixture result; the standings are recomputed.
+func postFixtureResult(w http.ResponseWriter, r *http.Request) {
+	if db == nil {
+		writeError(w, http.StatusNotImplemented, "database not configured")
+		return
+	}
+	id, ok := seasonID(w, r)
+	if !ok {
+		return
+	}
+	fixtureID, err := strconv.ParseInt(mux.Vars(r)["fixtureId"], 10, 64)
+	if err != nil {
+		writeError(w, http.StatusBadRequest, "invalid fixture id")
+		return
+	}
+	var req fixtureResultRequest
+	if !decodeJSON(w, r, &req) {
+		return
+	}
+	if req.HomeScore == nil || req.AwayScore == nil || *req.HomeScore < 0 || *req.AwayScore < 0 || *req.HomeScore > 99 || *req.AwayScore > 99 {
+		writeError(w, http.StatusBadRequest, "home_score and away_score are required (0-99)")
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(r.Context(), seasonWriteTimeout)
+	defer cancel()
+	f, err := db.RecordFixtureResult(ctx, id, fixtureID, *req.HomeScore, *req.AwayScore)
+	if err != nil {
+		writeSeasonError(w, err)
+		return
+	}
+	writeJSON(w, http.StatusOK, f)
+}
+
+// GET /seasons/{seasonId}/standings
+func getSeasonStandings(w http.ResponseWriter, r *http.Request) {
+	if db == nil {
+		writeError(w, http.StatusNotImplemented, "database not configured")
+		return
+	}
+	id, ok := seasonID(w, r)
+	if !ok {
+		return
+	}
+	if _, err := db.GetSeason(r.Context(), id); err != nil {
+		writeSeasonError(w, err)
+		return
+	}
+	res, err := db.Standings(r.Context(), id)
+	if err != nil {
+		writeSeasonError(w, err)
+		return
+	}
+	writeJSON(w, http.StatusOK, res)
+}
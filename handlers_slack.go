@@ -0,0 +1,466 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"net/url"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gorilla/mux"
+)
+
+// slackMaxSkew is how old a signed request may be before it is treated as
+// a replay.
+const slackMaxSkew = 5 * time.Minute
+
+// slackConfig is read once at startup by initSlack.
+var slackConfig struct {
+	signingSecret []byte
+	// Game used when a command names none and several games are running
+	defaultGame string
+	client      *http.Client
+}
+
+func initSlack() {
+	slackConfig.signingSecret = []byte(strings.TrimSpace(os.Getenv("KOTT_SLACK_SIGNING_SECRET")))
+	slackConfig.defaultGame = strings.TrimSpace(os.Getenv("KOTT_SLACK_GAME"))
+	slackConfig.client = &http.Client{Timeout: 5 * time.Second}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+	if err := slackLinks.load(ctx); err != nil {
+		log.Printf("[slack] loading slack links failed: %v", err)
+	}
+}
+
+// slackMessage is a reply in Slack's message format.
+type slackMessage struct {
+	ResponseType string `json:"response_type,omitempty"` // "ephemeral" (default) or "in_channel"
+	Text         string `json:"text"`
+	Blocks       []any  `json:"blocks,omitempty"`
+}
+
+// readSlackRequest reads the form-encoded body and verifies Slack's request
+// signature: v0=HMAC-SHA256(secret, "v0:" + timestamp + ":" + body).
+func readSlackRequest(w http.ResponseWriter, r *http.Request) (url.Values, bool) {
+	if len(slackConfig.signingSecret) == 0 {
+		writeError(w, http.StatusNotImplemented, "slack integration not configured")
+		return nil, false
+	}
+	body, err := io.ReadAll(http.MaxBytesReader(w, r.Body, limitConfig.maxBodyBytes))
+	if err != nil {
+		writeError(w, http.StatusRequestEntityTooLarge, "request body too large")
+		return nil, false
+	}
+	ts := r.Header.Get("X-Slack-Request-Timestamp")
+	sec, err := strconv.ParseInt(ts, 10, 64)
+	if err != nil || time.Since(time.Unix(sec, 0)).Abs() > slackMaxSkew {
+		writeError(w, http.StatusUnauthorized, "stale or missing request timestamp")
+		return nil, false
+	}
+	mac := hmac.New(sha256.New, slackConfig.signingSecret)
+	mac.Write([]byte("v0:" + ts + ":"))
+	mac.Write(body)
+	want := "v0=" + hex.EncodeToString(mac.Sum(nil))
+	if !hmac.Equal([]byte(want), []byte(r.Header.Get("X-Slack-Signature"))) {
+		writeError(w, http.StatusUnauthorized, "invalid request signature")
+		return nil, false
+	}
+	form, err := url.ParseQuery(string(body))
+	if err != nil {
+		writeError(w, http.StatusBadRequest, "invalid form body")
+		return nil, false
+	}
+	return form, true
+}
+
+// POST /integrations/slack/command (form-encoded slash command)
+// /kott join [game], /kott leave [game], /kott status [game], /kott leaderboard,
+// /kott link <player> <pin>, /kott unlink
+func postSlackCommand(w http.ResponseWriter, r *http.Request) {
+	form, ok := readSlackRequest(w, r)
+	if !ok {
+		return
+	}
+	user := form.Get("user_id")
+	args := strings.Fields(strings.ToLower(form.Get("text")))
+	sub, gameArg := "help", ""
+	if len(args) > 0 {
+		sub = args[0]
+	}
+	if len(args) > 1 {
+		gameArg = args[1]
+	}
+	var msg slackMessage
+	switch sub {
+	case "join":
+		msg = slackQueue(r.Context(), user, gameArg, true)
+	case "leave":
+		msg = slackQueue(r.Context(), user, gameArg, false)
+	case "status":
+		msg = slackStatus(r.Context(), gameArg)
+	case "leaderboard", "top":
+		msg = slackLeaderboard(r.Context())
+	case "link":
+		// Player names keep their case
+		msg = slackLinkPlayer(r.Context(), user, strings.Fields(form.Get("text"))[1:])
+	case "unlink":
+		msg = slackUnlinkPlayer(r.Context(), user)
+	default:
+		msg = slackMessage{Text: "Usage: `/kott join [game]`, `/kott leave [game]`, `/kott status [game]`, `/kott leaderboard`, `/kott link <player> <PIN>`, `/kott unlink`"}
+	}
+	writeJSON(w, http.StatusOK, msg)
+}
+
+// slackAction is the part of an interactive payload we use.
+type slackAction struct {
+	Type string `json:"type"`
+	User struct {
+		ID string `json:"id"`
+	} `json:"user"`
+	Actions []struct {
+		ActionID string `json:"action_id"`
+		Value    string `json:"value"`
+	} `json:"actions"`
+	ResponseURL string `json:"response_url"`
+}
+
+// POST /integrations/slack/interactive (form field "payload")
+// Handles the Join / Leave buttons attached to status replies. The result is
+// posted to the payload's response_url.
+func postSlackInteractive(w http.ResponseWriter, r *http.Request) {
+	form, ok := readSlackRequest(w, r)
+	if !ok {
+		return
+	}
+	var p slackAction
+	if err := json.Unmarshal([]byte(form.Get("payload")), &p); err != nil || p.Type != "block_actions" || len(p.Actions) == 0 {
+		writeError(w, http.StatusBadRequest, "unsupported interactive payload")
+		return
+	}
+	user := p.User.ID
+	a := p.Actions[0]
+	var msg slackMessage
+	switch a.ActionID {
+	case "kott_join":
+		msg = slackQueue(r.Context(), user, a.Value, true)
+	case "kott_leave":
+		msg = slackQueue(r.Context(), user, a.Value, false)
+	default:
+		writeError(w, http.StatusBadRequest, "unknown action: "+a.ActionID)
+		return
+	}
+	// Acknowledge now; Slack expects an answer within 3 seconds
+	w.WriteHeader(http.StatusOK)
+	if p.ResponseURL != "" {
+		go respondSlack(p.ResponseURL, msg)
+	}
+}
+
+// respondSlack posts a delayed reply to a response_url.
+func respondSlack(responseURL string, msg slackMessage) {
+	u, err := url.Parse(responseURL)
+	if err != nil || u.Scheme != "https" || u.Hostname() != "hooks.slack.com" {
+		log.Printf("[slack] refusing response_url %q", responseURL)
+		return
+	}
+	b, _ := json.Marshal(msg)
+	resp, err := slackConfig.client.Post(responseURL, "application/json", bytes.NewReader(b))
+	if err != nil {
+		log.Printf("[slack] reply failed: %v", err)
+		return
+	}
+	resp.Body.Close()
+}
+
+// slackPlayer finds the player linked to the Slack user ID. Unlinked users
+// are refused.
+func slackPlayer(ctx context.Context, userID string) (string, *slackMessage) {
+	if userID == "" {
+		return "", &slackMessage{Text: "Could not tell who you are."}
+	}
+	l, ok := slackLinks.Get(userID)
+	if !ok {
+		return "", &slackMessage{Text: "Your Slack account is not linked to a player. Use `/kott link <player> <PIN>` or ask an admin to link it."}
+	}
+	id, _ := playerRefID(l.PlayerID)
+	p, err := directory.Get(ctx, id)
+	if err != nil {
+		return "", &slackMessage{Text: "The player linked to your Slack account is unavailable. Link it again with `/kott link <player> <PIN>`."}
+	}
+	return formatPlayerID(p.ID), nil
+}
+
+// slackLinkPlayer links the Slack user to a player after checking the
+// player's PIN.
+func slackLinkPlayer(ctx context.Context, userID string, args []string) slackMessage {
+	if len(args) < 2 {
+		return slackMessage{Text: "Usage: `/kott link <player> <PIN>`"}
+	}
+	ref, pin := strings.Join(args[:len(args)-1], " "), args[len(args)-1]
+	p, err := directory.Find(ctx, ref)
+	if err != nil {
+		return slackMessage{Text: fmt.Sprintf("No player %q.", ref)}
+	}
+	ok, err := pins.Verify(ctx, p.ID, pin)
+	switch {
+	case errors.Is(err, errPINLocked):
+		return slackMessage{Text: "Too many wrong PINs; try again later."}
+	case err != nil:
+		log.Printf("[slack] PIN check for player %d failed: %v", p.ID, err)
+		return slackMessage{Text: "Could not check the PIN; try again later."}
+	case !ok:
+		return slackMessage{Text: "Wrong PIN, or no PIN set for " + p.Name + ". A referee can set one."}
+	}
+	if _, err := slackLinks.Link(ctx, userID, p.ID); err != nil {
+		log.Printf("[slack] linking %s to player %d failed: %v", userID, p.ID, err)
+		return slackMessage{Text: "Could not link your account; try again later."}
+	}
+	return slackMessage{Text: "Your Slack account now acts as " + p.Name + "."}
+}
+
+// slackUnlinkPlayer removes the Slack user's link.
+func slackUnlinkPlayer(ctx context.Context, userID string) slackMessage {
+	ok, err := slackLinks.Unlink(ctx, userID)
+	switch {
+	case !ok:
+		return slackMessage{Text: "Your Slack account is not linked."}
+	case err != nil:
+		log.Printf("[slack] unlinking %s failed: %v", userID, err)
+		return slackMessage{Text: "Could not unlink your account; try again later."}
+	}
+	return slackMessage{Text: "Your Slack account is no longer linked."}
+}
+
+// slackLinkRequest links a Slack user to a player (id or name).
+type slackLinkRequest struct {
+	PlayerID string `json:"player_id"`
+}
+
+// GET /admin/slack-links
+func getSlackLinks(w http.ResponseWriter, r *http.Request) {
+	writeJSON(w, http.StatusOK, slackLinks.List())
+}
+
+// PUT /admin/slack-links/{userId} {"player_id": "12"}
+// Links (or relinks) a Slack user ID to a player without a PIN.
+func putSlackLink(w http.ResponseWriter, r *http.Request) {
+	var req slackLinkRequest
+	if !decodeJSON(w, r, &req) {
+		return
+	}
+	userID := mux.Vars(r)["userId"]
+	if err := validateSlackUserID(userID); err != nil {
+		writeError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+	p, err := directory.Find(r.Context(), strings.TrimSpace(req.PlayerID))
+	if err != nil {
+		writePlayerError(w, err)
+		return
+	}
+	l, err := slackLinks.Link(r.Context(), userID, p.ID)
+	if err != nil {
+		writeError(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+	writeJSON(w, http.StatusOK, l)
+}
+
+// DELETE /admin/slack-links/{userId}
+func deleteSlackLink(w http.ResponseWriter, r *http.Request) {
+	ok, err := slackLinks.Unlink(r.Context(), mux.Vars(r)["userId"])
+	if !ok {
+		writeError(w, http.StatusNotFound, "slack link not found")
+		return
+	}
+	if err != nil {
+		writeError(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// slackGame picks the game a command is about: the one named, else
+// KOTT_SLACK_GAME, else the only game running.
+func slackGame(arg string) (string, *slackMessage) {
+	gamesMu.RLock()
+	defer gamesMu.RUnlock()
+	if arg != "" {
+		if _, ok := games[arg]; !ok {
+			return "", &slackMessage{Text: "No game " + arg + "."}
+		}
+		return arg, nil
+	}
+	if _, ok := games[slackConfig.defaultGame]; ok {
+		return slackConfig.defaultGame, nil
+	}
+	var running []string
+	for id, gs := range games {
+		if gs.Started && gs.Match == nil {
+			running = append(running, id)
+		}
+	}
+	switch len(running) {
+	case 0:
+		return "", &slackMessage{Text: "No game is running."}
+	case 1:
+		return running[0], nil
+	}
+	sort.Strings(running)
+	return "", &slackMessage{Text: "Several games are running; name one: " + strings.Join(running, ", ")}
+}
+
+// callHandler runs an API handler in-process as the given identity: a POST
+// of body, or a GET of target when body is nil. The JSON reply is decoded
+// into out; a non-2xx reply returns its error message.
+func callHandler(ctx context.Context, h http.HandlerFunc, target string, vars map[string]string, id identity, body, out any) string {
+	method, rd := http.MethodGet, io.Reader(http.NoBody)
+	if body != nil {
+		b, _ := json.Marshal(body)
+		method, rd = http.MethodPost, bytes.NewReader(b)
+	}
+	req, _ := http.NewRequestWithContext(context.WithValue(ctx, identityKey, id), method, target, rd)
+	req = mux.SetURLVars(req, vars)
+	rec := &bufferedResponse{header: http.Header{}, code: http.StatusOK}
+	h(rec, req)
+	if rec.code/100 != 2 {
+		var e struct {
+			Error string `json:"error"`
+		}
+		if json.Unmarshal(rec.body.Bytes(), &e) != nil || e.Error == "" {
+			e.Error = http.StatusText(rec.code)
+		}
+		return e.Error
+	}
+	if out != nil {
+		_ = json.Unmarshal(rec.body.Bytes(), out)
+	}
+	return ""
+}
+
+// bufferedResponse captures a handler's reply for callHandler.
+type bufferedResponse struct {
+	header http.Header
+	code   int
+	body   bytes.Buffer
+}
+
+func (b *bufferedResponse) Header() http.Header         { return b.header }
+func (b *bufferedResponse) Write(p []byte) (int, error) { return b.body.Write(p) }
+func (b *bufferedResponse) WriteHeader(code int)        { b.code = code }
+
+// slackQueue joins or leaves a game's queue through postQueue /
+// postRemovePlayer, acting as the player linked to the Slack user.
+func slackQueue(ctx context.Context, userID, gameArg string, join bool) slackMessage {
+	pid, msg := slackPlayer(ctx, userID)
+	if msg != nil {
+		return *msg
+	}
+	gameID, msg := slackGame(gameArg)
+	if msg != nil {
+		return *msg
+	}
+	caller := identity{Role: rolePlayer, PlayerID: pid, Via: "slack"}
+	h, verb := postRemovePlayer, "leave"
+	if join {
+		h, verb = postQueue, "join"
+	}
+	var gr gameResponse
+	if errMsg := callHandler(ctx, h, "/games/"+gameID+"/"+verb, map[string]string{"gameId": gameID}, caller, queueRequest{}, &gr); errMsg != "" {
+		return slackMessage{Text: "Could not " + verb + ": " + errMsg}
+	}
+	name := directory.Name(pid)
+	if !join {
+		return slackMessage{ResponseType: "in_channel", Text: name + " left game " + gameID + "."}
+	}
+	for _, e := range gr.Queue {
+		if e.PlayerID == pid {
+			return slackMessage{ResponseType: "in_channel", Text: fmt.Sprintf("%s joined game %s: #%d in the queue%s.", name, gameID, e.Position, slackWait(e))}
+		}
+	}
+	return slackMessage{ResponseType: "in_channel", Text: name + " joined game " + gameID + "."}
+}
+
+// slackStatus renders the game through getGame, with Join / Leave buttons.
+func slackStatus(ctx context.Context, gameArg string) slackMessage {
+	gameID, msg := slackGame(gameArg)
+	if msg != nil {
+		return *msg
+	}
+	var gr gameResponse
+	if errMsg := callHandler(ctx, getGame, "/games/"+gameID, map[string]string{"gameId": gameID}, identity{Role: roleSpectator, Via: "slack"}, nil, &gr); errMsg != "" {
+		return slackMessage{Text: errMsg}
+	}
+	name := func(id string) string {
+		if n := gr.Players[id]; n != "" {
+			return n
+		}
+		return id
+	}
+	var b strings.Builder
+	fmt.Fprintf(&b, "*Game %s*\n", gameID)
+	fmt.Fprintf(&b, "Red: %s (F) / %s (G)\n", name(gr.Red.Forward), name(gr.Red.Goalkeeper))
+	fmt.Fprintf(&b, "Blue: %s (F) / %s (G)\n", name(gr.Blue.Forward), name(gr.Blue.Goalkeeper))
+	if gr.Match != nil {
+		fmt.Fprintf(&b, "Score: %d - %d\n", gr.Match.RedScore, gr.Match.BlueScore)
+	}
+	if len(gr.Queue) == 0 {
+		b.WriteString("Queue: empty")
+	} else {
+		b.WriteString("Queue:")
+		for _, e := range gr.Queue {
+			fmt.Fprintf(&b, "\n%d. %s%s", e.Position, name(e.PlayerID), slackWait(e))
+		}
+	}
+	text := b.String()
+	out := slackMessage{Text: text}
+	if gr.Match == nil {
+		out.Blocks = []any{
+			map[string]any{"type": "section", "text": map[string]any{"type": "mrkdwn", "text": text}},
+			map[string]any{"type": "actions", "elements": []any{
+				map[string]any{"type": "button", "action_id": "kott_join", "value": gameID, "text": map[string]any{"type": "plain_text", "text": "Join"}},
+				map[string]any{"type": "button", "action_id": "kott_leave", "value": gameID, "text": map[string]any{"type": "plain_text", "text": "Leave"}},
+			}},
+		}
+	}
+	return out
+}
+
+// slackLeaderboard lists the top ten through getLeaderboardData.
+func slackLeaderboard(ctx context.Context) slackMessage {
+	var players []Player
+	if errMsg := callHandler(ctx, getLeaderboardData, "/leaderboard/data?limit=10", nil, identity{Role: roleSpectator, Via: "slack"}, nil, &players); errMsg != "" {
+		return slackMessage{Text: "Leaderboard unavailable: " + errMsg}
+	}
+	if len(players) == 0 {
+		return slackMessage{Text: "No results yet."}
+	}
+	var b strings.Builder
+	b.WriteString("*Leaderboard*")
+	for i, p := range players {
+		fmt.Fprintf(&b, "\n%d. %s: %d wins, %d survives, %d full rotations", i+1, p.Name, p.Wins, p.Survives, p.FullRotation)
+	}
+	return slackMessage{Text: b.String()}
+}
+
+// slackWait describes a queue entry's estimated wait.
+func slackWait(e QueueEntry) string {
+	if e.EstimatedWaitSeconds <= 0 {
+		return ""
+	}
+	return fmt.Sprintf(" (about %d min)", (e.EstimatedWaitSeconds+59)/60)
+}
@@ -0,0 +1,55 @@
+package main
+
+import (
+	"context"
+	"strings"
+	"testing"
+)
+
+func TestSlackPlayerRequiresLink(t *testing.T) {
+	t.Cleanup(func() { slackLinks = &slackLinkStore{byUser: map[string]slackLink{}} })
+	ctx := context.Background()
+	p, _, err := directory.Ensure(ctx, "Slacker")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := pins.Set(ctx, p.ID, "2468"); err != nil {
+		t.Fatal(err)
+	}
+
+	if _, msg := slackPlayer(ctx, "U123"); msg == nil || !strings.Contains(msg.Text, "not linked") {
+		t.Fatalf("unlinked user: %+v", msg)
+	}
+	// A Slack username matching a player's name is not enough
+	if _, msg := slackPlayer(ctx, "Slacker"); msg == nil {
+		t.Fatal("player name accepted as a Slack user ID")
+	}
+
+	if msg := slackLinkPlayer(ctx, "U123", []string{"Slacker", "0000"}); !strings.Contains(msg.Text, "Wrong PIN") {
+		t.Errorf("wrong PIN: %q", msg.Text)
+	}
+	if msg := slackLinkPlayer(ctx, "U123", []string{"slacker", "2468"}); !strings.Contains(msg.Text, "acts as Slacker") {
+		t.Fatalf("link: %q", msg.Text)
+	}
+	id, msg := slackPlayer(ctx, "U123")
+	if msg != nil || id != formatPlayerID(p.ID) {
+		t.Fatalf("linked user = %q, %+v; want %d", id, msg, p.ID)
+	}
+	// The link follows the player through a rename
+	if _, err := directory.Rename(ctx, p.ID, "Renamed Slacker"); err != nil {
+		t.Fatal(err)
+	}
+	if id, msg := slackPlayer(ctx, "U123"); msg != nil || id != formatPlayerID(p.ID) {
+		t.Errorf("after rename = %q, %+v", id, msg)
+	}
+
+	if msg := slackUnlinkPlayer(ctx, "U123"); !strings.Contains(msg.Text, "no longer linked") {
+		t.Errorf("unlink: %q", msg.Text)
+	}
+	if _, msg := slackPlayer(ctx, "U123"); msg == nil {
+		t.Error("user still acts as the player after unlinking")
+	}
+	if _, err := slackLinks.Link(ctx, "U-1", p.ID); err == nil {
+		t.Error("invalid Slack user ID accepted")
+	}
+}
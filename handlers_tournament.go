@@ -0,0 +1,302 @@
+package main
+
+import (
+	"context"
+	"math/rand/v2"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gorilla/mux"
+)
+
+const (
+	// maxTournamentPairs caps registrations (a 64-pair bracket)
+	maxTournamentPairs = 64
+	defaultGoalsToWin  = 10
+	maxGoalsToWin      = 99
+)
+
+// POST /tournaments {"name": "Q3 cup", "format": "double_elimination", "goals_to_win": 10, "pairs": [...]}
+func postTournament(w http.ResponseWriter, r *http.Request) {
+	var req tournamentRequest
+	if !decodeJSON(w, r, &req) {
+		return
+	}
+	req.Name = strings.TrimSpace(req.Name)
+	if req.Name == "" {
+		writeError(w, http.StatusBadRequest, "name is required")
+		return
+	}
+	format := strings.ToLower(strings.TrimSpace(req.Format))
+	switch format {
+	case "":
+		format = formatSingleElimination
+	case formatSingleElimination, formatDoubleElimination, formatRoundRobin:
+	default:
+		writeError(w, http.StatusBadRequest, "format must be 'single_elimination', 'double_elimination' or 'round_robin'")
+		return
+	}
+	if req.GoalsToWin == 0 {
+		req.GoalsToWin = defaultGoalsToWin
+	}
+	if req.GoalsToWin < 1 || req.GoalsToWin > maxGoalsToWin {
+		writeError(w, http.StatusBadRequest, "goals_to_win must be between 1 and 99")
+		return
+	}
+	if len(req.Pairs) > maxTournamentPairs {
+		writeError(w, http.StatusBadRequest, "too many pairs")
+		return
+	}
+	t := &Tournament{Name: req.Name, Format: format, GoalsToWin: req.GoalsToWin, CreatedAt: time.Now()}
+	for _, pr := range req.Pairs {
+		p, ok := resolvePair(r.Context(), w, pr)
+		if !ok {
+			return
+		}
+		if !addPair(w, t, p) {
+			return
+		}
+	}
+
+	gamesMu.Lock()
+	id := newIDLocked(tournaments)
+	tournaments[id] = t
+	resp := toTournamentResponse(id, t)
+	gamesMu.Unlock()
+
+	writeJSON(w, http.StatusCreated, resp)
+}
+
+// resolvePair validates a pair registration and resolves its players
+// (creating new names).
+func resolvePair(ctx context.Context, w http.ResponseWriter, pr pairRequest) (tournamentPair, bool) {
+	if containsEmptyIDs(pr.Forward, pr.Goalkeeper) {
+		writeError(w, http.StatusBadRequest, "forward and goalkeeper are required")
+		return tournamentPair{}, false
+	}
+	ids, err := resolvePlayers(ctx, pr.Forward, pr.Goalkeeper)
+	if err != nil {
+		writePlayerError(w, err)
+		return tournamentPair{}, false
+	}
+	if ids[0] == ids[1] {
+		writeError(w, http.StatusBadRequest, "a pair needs two different players")
+		return tournamentPair{}, false
+	}
+	name := strings.TrimSpace(pr.Name)
+	if name == "" {
+		name = directory.Name(ids[0]) + " & " + directory.Name(ids[1])
+	}
+	return tournamentPair{Name: name, Forward: ids[0], Goalkeeper: ids[1]}, true
+}
+
+// pairConflict finds the pair among pairs that already has one of p's
+// players, and that player. Tournaments and seasons both allow one pair
+// per player.
+func pairConflict(pairs []tournamentPair, p tournamentPair) (tournamentPair, string, bool) {
+	for _, q := range pairs {
+		for _, id := range []string{p.Forward, p.Goalkeeper} {
+			if id == q.Forward || id == q.Goalkeeper {
+				return q, id, true
+			}
+		}
+	}
+	return tournamentPair{}, "", false
+}
+
+// addPair registers p unless one of its players already has a pair.
+func addPair(w http.ResponseWriter, t *Tournament, p tournamentPair) bool {
+	if len(t.Pairs) >= maxTournamentPairs {
+		writeError(w, http.StatusConflict, "too many pairs")
+		return false
+	}
+	if q, id, ok := pairConflict(t.Pairs, p); ok {
+		writeError(w, http.StatusConflict, "player already registered in pair "+q.Name+": "+id+" ("+directory.Name(id)+")")
+		return false
+	}
+	p.ID = len(t.Pairs) + 1
+	t.Pairs = append(t.Pairs, p)
+	return true
+}
+
+// GET /tournaments
+func getTournaments(w http.ResponseWriter, r *http.Request) {
+	gamesMu.RLock()
+	out := make([]tournamentResponse, 0, len(tournaments))
+	for id, t := range tournaments {
+		out = append(out, toTournamentResponse(id, t))
+	}
+	gamesMu.RUnlock()
+	sort.Slice(out, func(i, j int) bool { return out[i].CreatedAt.After(out[j].CreatedAt) })
+	writeJSON(w, http.StatusOK, out)
+}
+
+// GET /tournaments/{tournamentId}
+// Bracket state: pairs, matches with status and scores, standings.
+func getTournament(w http.ResponseWriter, r *http.Request) {
+	tid := mux.Vars(r)["tournamentId"]
+	gamesMu.RLock()
+	t, ok := tournaments[tid]
+	if !ok {
+		gamesMu.RUnlock()
+		writeError(w, http.StatusNotFound, "tournament not found")
+		return
+	}
+	resp := toTournamentResponse(tid, t)
+	gamesMu.RUnlock()
+	writeJSON(w, http.StatusOK, resp)
+}
+
+// POST /tournaments/{tournamentId}/pairs {"name": "...", "forward": "alice", "goalkeeper": "bob"}
+func postTournamentPair(w http.ResponseWriter, r *http.Request) {
+	tid := mux.Vars(r)["tournamentId"]
+	var req pairRequest
+	if !decodeJSON(w, r, &req) {
+		return
+	}
+	p, ok := resolvePair(r.Context(), w, req)
+	if !ok {
+		return
+	}
+
+	gamesMu.Lock()
+	t, ok := tournaments[tid]
+	if !ok {
+		gamesMu.Unlock()
+		writeError(w, http.StatusNotFound, "tournament not found")
+		return
+	}
+	if t.Started {
+		gamesMu.Unlock()
+		writeError(w, http.StatusConflict, "tournament already started")
+		return
+	}
+	if !addPair(w, t, p) {
+		gamesMu.Unlock()
+		return
+	}
+	resp := toTournamentResponse(tid, t)
+	gamesMu.Unlock()
+
+	writeJSON(w, http.StatusOK, resp)
+}
+
+// POST /tournaments/{tournamentId}/start {"shuffle": false}
+// Closes registration and generates the bracket.
+func postTournamentStart(w http.ResponseWriter, r *http.Request) {
+	tid := mux.Vars(r)["tournamentId"]
+	var req tournamentStartRequest
+	if r.ContentLength != 0 && !decodeJSON(w, r, &req) {
+		return
+	}
+
+	gamesMu.Lock()
+	t, ok := tournaments[tid]
+	if !ok {
+		gamesMu.Unlock()
+		writeError(w, http.StatusNotFound, "tournament not found")
+		return
+	}
+	if t.Started {
+		gamesMu.Unlock()
+		writeError(w, http.StatusConflict, "tournament already started")
+		return
+	}
+	if len(t.Pairs) < 2 {
+		gamesMu.Unlock()
+		writeError(w, http.StatusConflict, "at least two pairs are needed")
+		return
+	}
+	if req.Shuffle {
+		rand.Shuffle(len(t.Pairs), func(i, j int) { t.Pairs[i], t.Pairs[j] = t.Pairs[j], t.Pairs[i] })
+		// Pair IDs are seeds
+		for i := range t.Pairs {
+			t.Pairs[i].ID = i + 1
+		}
+	}
+	t.generate()
+	resp := toTournamentResponse(tid, t)
+	gamesMu.Unlock()
+
+	writeJSON(w, http.StatusOK, resp)
+}
+
+// readyMatch looks up a match that can be played now. Caller holds
+// gamesMu; on failure the error response is written and gamesMu released.
+func readyMatch(w http.ResponseWriter, r *http.Request) (*Tournament, *tournamentMatch, bool) {
+	vars := mux.Vars(r)
+	t, ok := tournaments[vars["tournamentId"]]
+	if !ok {
+		gamesMu.Unlock()
+		writeError(w, http.StatusNotFound, "tournament not found")
+		return nil, nil, false
+	}
+	mid, err := strconv.Atoi(vars["matchId"])
+	m := t.match(mid)
+	if err != nil || m == nil {
+		gamesMu.Unlock()
+		writeError(w, http.StatusNotFound, "match not found")
+		return nil, nil, false
+	}
+	switch m.status() {
+	case "ready":
+		return t, m, true
+	case "playing":
+		gamesMu.Unlock()
+		writeError(w, http.StatusConflict, "match is being played in game "+m.GameID)
+	case "pending":
+		gamesMu.Unlock()
+		writeError(w, http.StatusConflict, "match opponents are not known yet")
+	default:
+		gamesMu.Unlock()
+		writeError(w, http.StatusConflict, "match already decided")
+	}
+	return nil, nil, false
+}
+
+// POST /tournaments/{tournamentId}/matches/{matchId}/game
+// Creates the game the match is played in; post goals to it as usual. The
+// goal reaching goals_to_win ends it and advances the bracket.
+func postMatchGame(w http.ResponseWriter, r *http.Request) {
+	gamesMu.Lock()
+	t, m, ok := readyMatch(w, r)
+	if !ok {
+		return
+	}
+	id := t.startMatchGame(mux.Vars(r)["tournamentId"], m)
+	gs := games[id]
+	ev := gameStartedEvent(id, gs)
+	resp := toGameResponse(gs, nil)
+	gamesMu.Unlock()
+
+	events.Publish(ev)
+	writeJSON(w, http.StatusOK, startNewGameResponse{ID: id, State: resp})
+}
+
+// POST /tournaments/{tournamentId}/matches/{matchId}/result {"red_score": 10, "blue_score": 7}
+// Records a match played without a game (e.g. on paper).
+func postMatchResult(w http.ResponseWriter, r *http.Request) {
+	var req matchResultRequest
+	if !decodeJSON(w, r, &req) {
+		return
+	}
+	if req.RedScore < 0 || req.BlueScore < 0 || req.RedScore == req.BlueScore {
+		writeError(w, http.StatusBadRequest, "scores must be non-negative and differ")
+		return
+	}
+	tid := mux.Vars(r)["tournamentId"]
+
+	gamesMu.Lock()
+	t, m, ok := readyMatch(w, r)
+	if !ok {
+		return
+	}
+	t.recordResult(m, req.RedScore, req.BlueScore)
+	resp := toTournamentResponse(tid, t)
+	gamesMu.Unlock()
+
+	writeJSON(w, http.StatusOK, resp)
+}
@@ -0,0 +1,214 @@
+package main
+
+import (
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gorilla/mux"
+)
+
+// POST /venues {"name": "3rd floor"}
+func postVenue(w http.ResponseWriter, r *http.Request) {
+	var req venueRequest
+	if !decodeJSON(w, r, &req) {
+		return
+	}
+	req.Name = strings.TrimSpace(req.Name)
+	if req.Name == "" {
+		writeError(w, http.StatusBadRequest, "name is required")
+		return
+	}
+
+	gamesMu.Lock()
+	id := newIDLocked(venues)
+	v := newVenue(req.Name)
+	venues[id] = v
+	resp := toVenueResponse(id, v)
+	gamesMu.Unlock()
+
+	writeJSON(w, http.StatusCreated, resp)
+}
+
+// GET /venues
+func getVenues(w http.ResponseWriter, r *http.Request) {
+	gamesMu.RLock()
+	out := make([]venueResponse, 0, len(venues))
+	for id, v := range venues {
+		out = append(out, toVenueResponse(id, v))
+	}
+	gamesMu.RUnlock()
+	sort.Slice(out, func(i, j int) bool { return out[i].Name < out[j].Name })
+	writeJSON(w, http.StatusOK, out)
+}
+
+// GET /venues/{venueId}
+func getVenue(w http.ResponseWriter, r *http.Request) {
+	venueID := mux.Vars(r)["venueId"]
+	gamesMu.RLock()
+	v, ok := venues[venueID]
+	if !ok {
+		gamesMu.RUnlock()
+		writeError(w, http.StatusNotFound, "venue not found")
+		return
+	}
+	resp := toVenueResponse(venueID, v)
+	gamesMu.RUnlock()
+	writeJSON(w, http.StatusOK, resp)
+}
+
+// POST /venues/{venueId}/tables {"name": "Table 2", "game_id": "..."}
+// Makes a running game a table of the venue. None of its players may
+// already be at another table or in the venue queue.
+func postVenueTable(w http.ResponseWriter, r *http.Request) {
+	venueID := mux.Vars(r)["venueId"]
+	var req venueTableRequest
+	if !decodeJSON(w, r, &req) {
+		return
+	}
+	req.Name = strings.TrimSpace(req.Name)
+	req.GameID = strings.TrimSpace(req.GameID)
+	if req.GameID == "" {
+		writeError(w, http.StatusBadRequest, "game_id is required")
+		return
+	}
+
+	gamesMu.Lock()
+	v, ok := venues[venueID]
+	if !ok {
+		gamesMu.Unlock()
+		writeError(w, http.StatusNotFound, "venue not found")
+		return
+	}
+	gs, ok := games[req.GameID]
+	if !ok {
+		gamesMu.Unlock()
+		writeError(w, http.StatusNotFound, "game not found")
+		return
+	}
+	if gs.VenueID != "" {
+		gamesMu.Unlock()
+		writeError(w, http.StatusConflict, "game is already a table of a venue")
+		return
+	}
+	if gs.Match != nil {
+		gamesMu.Unlock()
+		writeError(w, http.StatusConflict, "tournament match games cannot be venue tables")
+		return
+	}
+	if id, ok := v.conflict(req.GameID, collectAllIDs(gs)...); ok {
+		gamesMu.Unlock()
+		writeError(w, http.StatusConflict, "player is already at another table or in the venue queue: "+id+" ("+directory.Name(id)+")")
+		return
+	}
+	if req.Name == "" {
+		req.Name = "Table " + strconv.Itoa(len(v.Tables)+1)
+	}
+	v.Tables = append(v.Tables, venueTable{Name: req.Name, GameID: req.GameID})
+	gs.VenueID = venueID
+	resp := toVenueResponse(venueID, v)
+	gamesMu.Unlock()
+
+	writeJSON(w, http.StatusOK, resp)
+}
+
+// venuePlayer resolves the player a venue queue command is about,
+// defaulting to the caller for player sessions (see postQueue).
+func venuePlayer(w http.ResponseWriter, r *http.Request, ref string, create bool) (string, bool) {
+	caller := identityFrom(r)
+	ref = strings.TrimSpace(ref)
+	if ref == "" && caller.Role < roleReferee {
+		ref = caller.PlayerID
+	}
+	if ref == "" {
+		writeError(w, http.StatusBadRequest, "player_id is required")
+		return "", false
+	}
+	resolve := findPlayers
+	if create && caller.Role >= roleReferee {
+		resolve = resolvePlayers
+	}
+	ids, err := resolve(r.Context(), ref)
+	if err != nil {
+		writePlayerError(w, err)
+		return "", false
+	}
+	if !caller.actsFor(ids[0]) {
+		writeError(w, http.StatusForbidden, "players can only manage their own place in the queue")
+		return "", false
+	}
+	return ids[0], true
+}
+
+// POST /venues/{venueId}/queue {"player_id": "12"}
+// Joins the shared queue: the player comes on at whichever table rotates
+// first.
+func postVenueQueue(w http.ResponseWriter, r *http.Request) {
+	venueID := mux.Vars(r)["venueId"]
+	var req queueRequest
+	if !decodeJSON(w, r, &req) {
+		return
+	}
+	id, ok := venuePlayer(w, r, req.PlayerID, true)
+	if !ok {
+		return
+	}
+
+	gamesMu.Lock()
+	v, ok := venues[venueID]
+	if !ok {
+		gamesMu.Unlock()
+		writeError(w, http.StatusNotFound, "venue not found")
+		return
+	}
+	if _, ok := v.conflict("", id); ok {
+		gamesMu.Unlock()
+		writeError(w, http.StatusConflict, "player is already at a table or in the venue queue")
+		return
+	}
+	v.enqueue(id, time.Now())
+	resp := toVenueResponse(venueID, v)
+	pos := v.Waiting.Len()
+	gamesMu.Unlock()
+
+	events.Publish(gameEvent{Type: "player_joined_queue", GameID: venueID, PlayerID: id, Data: map[string]any{
+		"venue_id": venueID, "position": pos,
+	}})
+	writeJSON(w, http.StatusOK, resp)
+}
+
+// POST /venues/{venueId}/remove {"player_id": "12"}
+// Leaves the shared queue.
+func postVenueRemove(w http.ResponseWriter, r *http.Request) {
+	venueID := mux.Vars(r)["venueId"]
+	var req queueRequest
+	if !decodeJSON(w, r, &req) {
+		return
+	}
+	id, ok := venuePlayer(w, r, req.PlayerID, false)
+	if !ok {
+		return
+	}
+
+	gamesMu.Lock()
+	v, ok := venues[venueID]
+	if !ok {
+		gamesMu.Unlock()
+		writeError(w, http.StatusNotFound, "venue not found")
+		return
+	}
+	if !v.remove(id) {
+		gamesMu.Unlock()
+		writeError(w, http.StatusNotFound, "player is not in the venue queue")
+		return
+	}
+	resp := toVenueResponse(venueID, v)
+	gamesMu.Unlock()
+
+	events.Publish(gameEvent{Type: "player_left", GameID: venueID, PlayerID: id, Data: map[string]any{
+		"venue_id": venueID,
+	}})
+	writeJSON(w, http.StatusOK, resp)
+}
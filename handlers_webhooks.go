@@ -0,0 +1,106 @@
+package main
+
+import (
+	"net/http"
+	"net/url"
+	"slices"
+	"strings"
+
+	"github.com/gorilla/mux"
+)
+
+// Events empty (or ["*"]) subscribes to every event. Secret is generated
+// when empty.
+type webhookRequest struct {
+	URL    string   `json:"url"`
+	Events []string `json:"events"`
+	Label  string   `json:"label"`
+	Secret string   `json:"secret"`
+}
+
+type webhookResponse struct {
+	webhook
+	// The secret is only ever returned here
+	Secret string `json:"secret"`
+}
+
+// GET /admin/webhooks
+func getWebhooks(w http.ResponseWriter, r *http.Request) {
+	writeJSON(w, http.StatusOK, webhooks.List())
+}
+
+// POST /admin/webhooks {"url": "https://bot.example/kott", "events": ["goal", "full_rotation"], "label": "chat bot"}
+func postWebhook(w http.ResponseWriter, r *http.Request) {
+	var req webhookRequest
+	if !decodeJSON(w, r, &req) {
+		return
+	}
+	u, err := url.Parse(strings.TrimSpace(req.URL))
+	if err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+		writeError(w, http.StatusBadRequest, "url must be an absolute http(s) URL")
+		return
+	}
+	evs := []string{}
+	for _, e := range req.Events {
+		e = strings.ToLower(strings.TrimSpace(e))
+		if e == "*" {
+			evs = []string{}
+			break
+		}
+		if !slices.Contains(webhookEvents, e) {
+			writeError(w, http.StatusBadRequest, "unknown event: "+e+" (one of "+strings.Join(webhookEvents, ", ")+")")
+			return
+		}
+		if !slices.Contains(evs, e) {
+			evs = append(evs, e)
+		}
+	}
+	label := strings.TrimSpace(req.Label)
+	if len(label) > 100 || len(u.String()) > 2048 {
+		writeError(w, http.StatusBadRequest, "label or url too long")
+		return
+	}
+	h, secret, err := webhooks.Add(r.Context(), webhook{URL: u.String(), Events: evs, Label: label}, strings.TrimSpace(req.Secret))
+	if err != nil {
+		writeError(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+	writeJSON(w, http.StatusCreated, webhookResponse{webhook: *h, Secret: secret})
+}
+
+// DELETE /admin/webhooks/{id}
+func deleteWebhook(w http.ResponseWriter, r *http.Request) {
+	ok, err := webhooks.Remove(r.Context(), mux.Vars(r)["id"])
+	if !ok {
+		writeError(w, http.StatusNotFound, "webhook not found")
+		return
+	}
+	if err != nil {
+		writeError(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// GET /admin/webhooks/{id}/deliveries
+// Recent deliveries, newest first.
+func getWebhookDeliveries(w http.ResponseWriter, r *http.Request) {
+	id := mux.Vars(r)["id"]
+	if _, ok := webhooks.Get(id); !ok {
+		writeError(w, http.StatusNotFound, "webhook not found")
+		return
+	}
+	writeJSON(w, http.StatusOK, webhooks.Deliveries(id))
+}
+
+// POST /admin/webhooks/{id}/ping
+// Sends a "ping" event to check the receiver; see the deliveries for the
+// outcome.
+func postWebhookPing(w http.ResponseWriter, r *http.Request) {
+	d, ok := webhooks.ping(mux.Vars(r)["id"])
+	if !ok {
+		writeError(w, http.StatusNotFound, "webhook not found")
+		return
+	}
+	writeJSON(w, http.StatusAccepted, d)
+}
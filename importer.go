@@ -0,0 +1,331 @@
+package main
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/csv"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// historyRow is one line of a historical import, as written in the file.
+// Each row is one goal (or a whole match recorded as its deciding goal).
+type historyRow struct {
+	Timestamp      string `json:"timestamp"`
+	RedForward     string `json:"red_forward"`
+	RedGoalkeeper  string `json:"red_goalkeeper"`
+	BlueForward    string `json:"blue_forward"`
+	BlueGoalkeeper string `json:"blue_goalkeeper"`
+	ScoringTeam    string `json:"scoring_team"`
+	// Optional: rows sharing a game label form one game
+	Game string `json:"game"`
+	// Optional: who came on for the losing team; defaults to the benched goalkeeper
+	NewForward   string `json:"new_forward"`
+	FullRotation any    `json:"full_rotation"`
+}
+
+var historyRequiredColumns = []string{"timestamp", "red_forward", "red_goalkeeper", "blue_forward", "blue_goalkeeper", "scoring_team"}
+var historyOptionalColumns = []string{"game", "new_forward", "full_rotation"}
+
+// historicalGoal is a validated row.
+type historicalGoal struct {
+	Line                        int
+	At                          time.Time
+	Game                        string
+	RedForward, RedGoalkeeper   string
+	BlueForward, BlueGoalkeeper string
+	Team                        string
+	Benched, Moved, NewForward  string
+	FullRotation                bool
+}
+
+// historicalGame is a group of goals stored under one games row.
+type historicalGame struct {
+	ID    string
+	Label string
+	Goals []historicalGoal
+}
+
+// importError is a problem with one input line.
+type importError struct {
+	Line int    `json:"line"`
+	Msg  string `json:"error"`
+}
+
+func (e importError) Error() string { return fmt.Sprintf("line %d: %s", e.Line, e.Msg) }
+
+// historyTimeLayouts are tried in order; zone-less times are read in the
+// import's location.
+var historyTimeLayouts = []string{time.RFC3339, "2006-01-02 15:04:05", "2006-01-02T15:04:05", "2006-01-02 15:04", time.DateOnly}
+
+func parseHistoryTime(s string, loc *time.Location) (time.Time, bool) {
+	s = strings.TrimSpace(s)
+	for _, layout := range historyTimeLayouts {
+		if t, err := time.ParseInLocation(layout, s, loc); err == nil {
+			return t, true
+		}
+	}
+	return time.Time{}, false
+}
+
+// parseHistoryCSV reads a CSV file with a header row naming the columns.
+func parseHistoryCSV(r io.Reader) ([]historyRow, []int, []importError, error) {
+	cr := csv.NewReader(r)
+	cr.FieldsPerRecord = -1
+	cr.TrimLeadingSpace = true
+	header, err := cr.Read()
+	if err == io.EOF {
+		return nil, nil, nil, errors.New("empty file")
+	}
+	if err != nil {
+		return nil, nil, nil, fmt.Errorf("header: %w", err)
+	}
+	col := map[string]int{}
+	for i, h := range header {
+		h = strings.ToLower(strings.TrimSpace(strings.TrimPrefix(h, "\ufeff")))
+		if !slices.Contains(historyRequiredColumns, h) && !slices.Contains(historyOptionalColumns, h) {
+			return nil, nil, nil, fmt.Errorf("header: unknown column %q", h)
+		}
+		col[h] = i
+	}
+	for _, h := range historyRequiredColumns {
+		if _, ok := col[h]; !ok {
+			return nil, nil, nil, fmt.Errorf("header: missing column %q", h)
+		}
+	}
+	var rows []historyRow
+	var lines []int
+	var errs []importError
+	for {
+		rec, err := cr.Read()
+		if err == io.EOF {
+			break
+		}
+		var pe *csv.ParseError
+		if errors.As(err, &pe) {
+			errs = append(errs, importError{pe.StartLine, pe.Err.Error()})
+			continue
+		}
+		if err != nil {
+			return nil, nil, nil, err
+		}
+		if len(rec) == 1 && strings.TrimSpace(rec[0]) == "" {
+			continue
+		}
+		line, _ := cr.FieldPos(0)
+		if len(rec) != len(header) {
+			errs = append(errs, importError{line, fmt.Sprintf("%d fields, header has %d", len(rec), len(header))})
+			continue
+		}
+		get := func(name string) string {
+			if i, ok := col[name]; ok {
+				return rec[i]
+			}
+			return ""
+		}
+		row := historyRow{
+			Timestamp: get("timestamp"), RedForward: get("red_forward"), RedGoalkeeper: get("red_goalkeeper"),
+			BlueForward: get("blue_forward"), BlueGoalkeeper: get("blue_goalkeeper"), ScoringTeam: get("scoring_team"),
+			Game: get("game"), NewForward: get("new_forward"),
+		}
+		if v := strings.TrimSpace(get("full_rotation")); v != "" {
+			row.FullRotation = v
+		}
+		rows = append(rows, row)
+		lines = append(lines, line)
+	}
+	return rows, lines, errs, nil
+}
+
+// parseHistoryJSON reads a JSON array of row objects or one object per line.
+func parseHistoryJSON(r io.Reader) ([]historyRow, []int, []importError, error) {
+	data, err := io.ReadAll(r)
+	if err != nil {
+		return nil, nil, nil, err
+	}
+	lineAt := func(off int64) int {
+		for off < int64(len(data)) && strings.ContainsRune(" \t\r\n,", rune(data[off])) {
+			off++
+		}
+		return 1 + bytes.Count(data[:off], []byte("\n"))
+	}
+	dec := json.NewDecoder(bytes.NewReader(data))
+	if t := bytes.TrimSpace(data); len(t) > 0 && t[0] == '[' {
+		if _, err := dec.Token(); err != nil {
+			return nil, nil, nil, err
+		}
+	}
+	var rows []historyRow
+	var lines []int
+	var errs []importError
+	for dec.More() {
+		line := lineAt(dec.InputOffset())
+		var raw json.RawMessage
+		if err := dec.Decode(&raw); err != nil {
+			return nil, nil, nil, importError{line, "invalid JSON: " + err.Error()}
+		}
+		var row historyRow
+		strict := json.NewDecoder(bytes.NewReader(raw))
+		strict.DisallowUnknownFields()
+		if err := strict.Decode(&row); err != nil {
+			errs = append(errs, importError{line, err.Error()})
+			continue
+		}
+		rows = append(rows, row)
+		lines = append(lines, line)
+	}
+	return rows, lines, errs, nil
+}
+
+// validateHistoryRow checks one row and fills in the rotation: the losing
+// goalkeeper is benched, the losing forward moves to goal.
+func validateHistoryRow(row historyRow, line int, loc *time.Location, now time.Time) (historicalGoal, []string) {
+	var problems []string
+	g := historicalGoal{Line: line, Game: strings.TrimSpace(row.Game)}
+	at, ok := parseHistoryTime(row.Timestamp, loc)
+	switch {
+	case strings.TrimSpace(row.Timestamp) == "":
+		problems = append(problems, "timestamp is required")
+	case !ok:
+		problems = append(problems, fmt.Sprintf("timestamp %q is not YYYY-MM-DD[ HH:MM[:SS]] or RFC 3339", row.Timestamp))
+	case at.After(now):
+		problems = append(problems, "timestamp is in the future")
+	}
+	g.At = at.UTC()
+	name := func(field, v string) string {
+		n := normalizePlayerName(v)
+		if n == "" {
+			problems = append(problems, field+" is required")
+		} else if validatePlayerName(n) != nil {
+			problems = append(problems, field+" is not a valid player name")
+		}
+		return n
+	}
+	g.RedForward = name("red_forward", row.RedForward)
+	g.RedGoalkeeper = name("red_goalkeeper", row.RedGoalkeeper)
+	g.BlueForward = name("blue_forward", row.BlueForward)
+	g.BlueGoalkeeper = name("blue_goalkeeper", row.BlueGoalkeeper)
+	four := []string{g.RedForward, g.RedGoalkeeper, g.BlueForward, g.BlueGoalkeeper}
+	seen := map[string]bool{}
+	for _, n := range four {
+		if k := playerNameKey(n); k != "" && seen[k] {
+			problems = append(problems, n+" appears twice")
+		} else {
+			seen[k] = true
+		}
+	}
+	g.Team = strings.ToLower(strings.TrimSpace(row.ScoringTeam))
+	switch g.Team {
+	case "red":
+		g.Moved, g.Benched = g.BlueForward, g.BlueGoalkeeper
+	case "blue":
+		g.Moved, g.Benched = g.RedForward, g.RedGoalkeeper
+	default:
+		problems = append(problems, fmt.Sprintf("scoring_team %q must be red or blue", row.ScoringTeam))
+	}
+	g.NewForward = g.Benched
+	if strings.TrimSpace(row.NewForward) != "" {
+		g.NewForward = name("new_forward", row.NewForward)
+		if k := playerNameKey(g.NewForward); seen[k] && k != playerNameKey(g.Benched) {
+			problems = append(problems, "new_forward is already on the table")
+		}
+	}
+	switch v := row.FullRotation.(type) {
+	case nil:
+	case bool:
+		g.FullRotation = v
+	case string:
+		b, err := strconv.ParseBool(strings.TrimSpace(v))
+		if err != nil {
+			problems = append(problems, fmt.Sprintf("full_rotation %q must be true or false", v))
+		}
+		g.FullRotation = b
+	default:
+		problems = append(problems, "full_rotation must be true or false")
+	}
+	return g, problems
+}
+
+// groupHistory validates rows and groups them into games. Labelled rows
+// share a game and must be in time order; unlabelled rows are a game each.
+// Game IDs are derived from the first goal (and, for games starting alike,
+// their order in the file), so importing the same data twice yields the
+// same IDs and is refused.
+func groupHistory(rows []historyRow, lines []int, loc *time.Location) ([]historicalGame, []importError) {
+	var errs []importError
+	var games []historicalGame
+	byLabel := map[string]int{}
+	now := time.Now().Add(time.Minute)
+	for i, row := range rows {
+		g, problems := validateHistoryRow(row, lines[i], loc, now)
+		if g.Game != "" {
+			if gi, ok := byLabel[g.Game]; ok {
+				goals := games[gi].Goals
+				if len(problems) == 0 && g.At.Before(goals[len(goals)-1].At) {
+					problems = append(problems, fmt.Sprintf("earlier than the previous goal of game %q (line %d)", g.Game, goals[len(goals)-1].Line))
+				}
+				if len(problems) == 0 {
+					games[gi].Goals = append(goals, g)
+				}
+				errs = appendImportErrors(errs, g.Line, problems)
+				continue
+			}
+		}
+		errs = appendImportErrors(errs, g.Line, problems)
+		if len(problems) > 0 {
+			continue
+		}
+		if g.Game != "" {
+			byLabel[g.Game] = len(games)
+		}
+		games = append(games, historicalGame{Label: g.Game, Goals: []historicalGoal{g}})
+	}
+	// Games starting alike (e.g. two unlabelled goals with the same date and
+	// lineup) are told apart by their order in the file
+	occurrences := map[string]int{}
+	for i := range games {
+		first := games[i].Goals[0]
+		key := strings.Join([]string{"history", games[i].Label, first.At.Format(time.RFC3339),
+			playerNameKey(first.RedForward), playerNameKey(first.RedGoalkeeper),
+			playerNameKey(first.BlueForward), playerNameKey(first.BlueGoalkeeper)}, "\x00")
+		n := occurrences[key]
+		occurrences[key]++
+		if n > 0 {
+			key += "\x00" + strconv.Itoa(n)
+		}
+		sum := sha256.Sum256([]byte(key))
+		games[i].ID = hex.EncodeToString(sum[:12])
+	}
+	return games, errs
+}
+
+func appendImportErrors(errs []importError, line int, problems []string) []importError {
+	if len(problems) > 0 {
+		errs = append(errs, importError{line, strings.Join(problems, "; ")})
+	}
+	return errs
+}
+
+// historyPlayerNames lists every distinct name in the games, in first-seen order.
+func historyPlayerNames(games []historicalGame) []string {
+	var out []string
+	seen := map[string]bool{}
+	for _, gm := range games {
+		for _, g := range gm.Goals {
+			for _, n := range []string{g.RedForward, g.RedGoalkeeper, g.BlueForward, g.BlueGoalkeeper, g.NewForward} {
+				if k := playerNameKey(n); !seen[k] {
+					seen[k] = true
+					out = append(out, n)
+				}
+			}
+		}
+	}
+	return out
+}
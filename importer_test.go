@@ -0,0 +1,183 @@
+package main
+
+import (
+	"slices"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestParseHistoryCSV(t *testing.T) {
+	in := "\ufeffTimestamp,red_forward,red_goalkeeper,blue_forward,blue_goalkeeper,scoring_team,full_rotation\n" +
+		"2025-03-01 12:00,Alice,Bob,Carol,Dave,red,\n" +
+		"2025-03-01 12:05,Alice,Bob,Carol,Dave,blue,true,extra\n" +
+		"\n" +
+		"2025-03-01 12:10,Alice,Bob,Carol,Dave,blue,false\n"
+	rows, lines, errs, err := parseHistoryCSV(strings.NewReader(in))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(rows) != 2 || !slices.Equal(lines, []int{2, 5}) {
+		t.Fatalf("rows %d at lines %v, want 2 at [2 5]", len(rows), lines)
+	}
+	if rows[0].RedForward != "Alice" || rows[0].FullRotation != nil || rows[1].FullRotation != "false" {
+		t.Errorf("rows = %+v", rows)
+	}
+	if len(errs) != 1 || errs[0].Line != 3 || !strings.Contains(errs[0].Msg, "8 fields") {
+		t.Errorf("errs = %v, want the 8-field line 3", errs)
+	}
+
+	for _, header := range []string{
+		"timestamp,red_forward,red_goalkeeper,blue_forward,blue_goalkeeper\n",
+		"timestamp,red_forward,red_goalkeeper,blue_forward,blue_goalkeeper,scoring_team,score\n",
+		"",
+	} {
+		if _, _, _, err := parseHistoryCSV(strings.NewReader(header)); err == nil {
+			t.Errorf("header %q accepted", header)
+		}
+	}
+}
+
+func TestParseHistoryJSON(t *testing.T) {
+	array := `[
+  {"timestamp": "2025-03-01T12:00:00Z", "red_forward": "Alice", "red_goalkeeper": "Bob",
+   "blue_forward": "Carol", "blue_goalkeeper": "Dave", "scoring_team": "red", "full_rotation": true},
+  {"timestamp": "2025-03-01T12:05:00Z", "red_forward": "Alice", "score": 3}
+]`
+	rows, lines, errs, err := parseHistoryJSON(strings.NewReader(array))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(rows) != 1 || lines[0] != 2 || rows[0].FullRotation != true {
+		t.Fatalf("rows %+v at lines %v", rows, lines)
+	}
+	if len(errs) != 1 || errs[0].Line != 4 || !strings.Contains(errs[0].Msg, "score") {
+		t.Errorf("errs = %v, want unknown field on line 4", errs)
+	}
+
+	ndjson := `{"timestamp": "2025-03-01 12:00", "red_forward": "Alice", "red_goalkeeper": "Bob", "blue_forward": "Carol", "blue_goalkeeper": "Dave", "scoring_team": "red"}
+
+{"timestamp": "2025-03-01 12:05", "red_forward": "Alice", "red_goalkeeper": "Bob", "blue_forward": "Carol", "blue_goalkeeper": "Dave", "scoring_team": "blue"}
+`
+	rows, lines, errs, err = parseHistoryJSON(strings.NewReader(ndjson))
+	if err != nil || len(errs) != 0 {
+		t.Fatalf("err %v, errs %v", err, errs)
+	}
+	if len(rows) != 2 || !slices.Equal(lines, []int{1, 3}) {
+		t.Errorf("rows %d at lines %v, want 2 at [1 3]", len(rows), lines)
+	}
+
+	if _, _, _, err := parseHistoryJSON(strings.NewReader(`{"timestamp": `)); err == nil {
+		t.Error("truncated JSON accepted")
+	}
+}
+
+func TestValidateHistoryRow(t *testing.T) {
+	now := time.Date(2026, 1, 1, 0, 0, 0, 0, time.UTC)
+	base := historyRow{
+		Timestamp: "2025-03-01 12:00", RedForward: "Alice", RedGoalkeeper: "Bob",
+		BlueForward: "Carol", BlueGoalkeeper: "Dave", ScoringTeam: "Red",
+	}
+	tests := []struct {
+		name                       string
+		edit                       func(*historyRow)
+		benched, moved, newForward string
+		fullRotation               bool
+		problem                    string
+	}{
+		{name: "red scores", benched: "Dave", moved: "Carol", newForward: "Dave"},
+		{name: "blue scores", edit: func(r *historyRow) { r.ScoringTeam = " blue " }, benched: "Bob", moved: "Alice", newForward: "Bob"},
+		{name: "new forward from the bench", edit: func(r *historyRow) { r.NewForward = "Erin" }, benched: "Dave", moved: "Carol", newForward: "Erin"},
+		{name: "full rotation string", edit: func(r *historyRow) { r.FullRotation = "TRUE" }, benched: "Dave", moved: "Carol", newForward: "Dave", fullRotation: true},
+		{name: "full rotation bool", edit: func(r *historyRow) { r.FullRotation = true }, benched: "Dave", moved: "Carol", newForward: "Dave", fullRotation: true},
+		{name: "new forward already playing", edit: func(r *historyRow) { r.NewForward = "alice" }, problem: "already on the table"},
+		{name: "player twice", edit: func(r *historyRow) { r.BlueGoalkeeper = "ALICE" }, problem: "appears twice"},
+		{name: "missing player", edit: func(r *historyRow) { r.RedGoalkeeper = " " }, problem: "red_goalkeeper is required"},
+		{name: "bad team", edit: func(r *historyRow) { r.ScoringTeam = "green" }, problem: "must be red or blue"},
+		{name: "bad timestamp", edit: func(r *historyRow) { r.Timestamp = "01/03/2025" }, problem: "is not YYYY-MM-DD"},
+		{name: "future timestamp", edit: func(r *historyRow) { r.Timestamp = "2026-06-01" }, problem: "in the future"},
+		{name: "bad full rotation", edit: func(r *historyRow) { r.FullRotation = "maybe" }, problem: "full_rotation"},
+		{name: "full rotation number", edit: func(r *historyRow) { r.FullRotation = 1.0 }, problem: "full_rotation"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			row := base
+			if tt.edit != nil {
+				tt.edit(&row)
+			}
+			g, problems := validateHistoryRow(row, 7, time.UTC, now)
+			if tt.problem != "" {
+				if !strings.Contains(strings.Join(problems, "; "), tt.problem) {
+					t.Fatalf("problems = %v, want one about %q", problems, tt.problem)
+				}
+				return
+			}
+			if len(problems) > 0 {
+				t.Fatalf("problems = %v", problems)
+			}
+			if g.Benched != tt.benched || g.Moved != tt.moved || g.NewForward != tt.newForward {
+				t.Errorf("benched %q, moved %q, new forward %q; want %q, %q, %q",
+					g.Benched, g.Moved, g.NewForward, tt.benched, tt.moved, tt.newForward)
+			}
+			if g.FullRotation != tt.fullRotation || g.Line != 7 {
+				t.Errorf("full rotation %v, line %d", g.FullRotation, g.Line)
+			}
+		})
+	}
+}
+
+func TestValidateHistoryRowTimeZone(t *testing.T) {
+	paris, err := time.LoadLocation("Europe/Paris")
+	if err != nil {
+		t.Skip("no tzdata")
+	}
+	row := historyRow{Timestamp: "2025-03-01 12:00", RedForward: "A", RedGoalkeeper: "B",
+		BlueForward: "C", BlueGoalkeeper: "D", ScoringTeam: "red"}
+	g, _ := validateHistoryRow(row, 1, paris, time.Now())
+	if want := time.Date(2025, 3, 1, 11, 0, 0, 0, time.UTC); !g.At.Equal(want) || g.At.Location() != time.UTC {
+		t.Errorf("At = %v, want %v", g.At, want)
+	}
+}
+
+func TestGroupHistory(t *testing.T) {
+	row := func(ts, game, team string) historyRow {
+		return historyRow{Timestamp: ts, RedForward: "Alice", RedGoalkeeper: "Bob",
+			BlueForward: "Carol", BlueGoalkeeper: "Dave", ScoringTeam: team, Game: game}
+	}
+	rows := []historyRow{
+		row("2025-03-01 12:00", "m1", "red"),
+		row("2025-03-01 12:30", "", "blue"),
+		row("2025-03-01 12:05", "m1", "blue"),
+		row("2025-03-01 11:59", "m1", "red"), // before the previous m1 goal
+		row("2025-03-01 12:40", "", "green"),
+	}
+	lines := []int{2, 3, 4, 5, 6}
+	games, errs := groupHistory(rows, lines, time.UTC)
+	if len(games) != 2 {
+		t.Fatalf("%d games, want 2", len(games))
+	}
+	if games[0].Label != "m1" || len(games[0].Goals) != 2 || len(games[1].Goals) != 1 {
+		t.Errorf("games = %+v", games)
+	}
+	if len(errs) != 2 || errs[0].Line != 5 || errs[1].Line != 6 {
+		t.Errorf("errs = %v, want lines 5 and 6", errs)
+	}
+	if len(games[0].ID) != 24 || games[0].ID == games[1].ID {
+		t.Errorf("IDs %q and %q", games[0].ID, games[1].ID)
+	}
+	again, _ := groupHistory(rows, lines, time.UTC)
+	if again[0].ID != games[0].ID || again[1].ID != games[1].ID {
+		t.Error("game IDs differ between imports of the same rows")
+	}
+
+	// Unlabelled games starting alike still get distinct IDs
+	twins, _ := groupHistory([]historyRow{row("2025-03-04", "", "red"), row("2025-03-04", "", "blue")}, []int{2, 3}, time.UTC)
+	if len(twins) != 2 || twins[0].ID == twins[1].ID {
+		t.Errorf("games with the same first goal share ID %q", twins[0].ID)
+	}
+
+	names := historyPlayerNames(games)
+	if !slices.Equal(names, []string{"Alice", "Bob", "Carol", "Dave"}) {
+		t.Errorf("names = %v", names)
+	}
+}
@@ -1,23 +1,51 @@
 package main
 
 import (
+	"context"
+	"errors"
 	"io/ioutil"
 	"log"
 	"net/http"
 	"os"
+	"os/signal"
 	"strconv"
 	"strings"
+	"syscall"
+	"time"
 
 	"github.com/gorilla/mux"
 )
 
 func main() {
+	os.Exit(runCommand(os.Args[1:]))
+}
+
+// serve runs the HTTP server until SIGINT/SIGTERM.
+func serve(args []string) error {
+	fs := commandFlags("serve")
+	if err := parseFlags(fs, args); err != nil {
+		return err
+	}
+	if fs.NArg() != 0 {
+		return usageError("unexpected arguments")
+	}
 	// Initialize optional DB (no-op if MYSQL_DSN unset or unreachable)
 	initDB()
 
+	initAuth()
+	initLimits()
+	initReadyChecks()
+	initWebhooks()
+	initSlack()
+
 	r := mux.NewRouter()
+	// Every route is listed with the minimum role allowed to call it;
+	// unlisted routes require admin. Requests are throttled per client IP
+	// before authentication and per credential after it.
+	rr := routeRoles{}
+	r.Use(limitByIP, authenticate, limitByCaller, rr.authorize)
 	// Serve the interactive UI at /babyfoot
-	r.HandleFunc("/babyfoot", func(w http.ResponseWriter, r *http.Request) {
+	rr.allow(r.HandleFunc("/babyfoot", func(w http.ResponseWriter, r *http.Request) {
 		b, err := ioutil.ReadFile("babyfoot.html")
 		if err != nil {
 			http.Error(w, "UI not found", http.StatusNotFound)
@@ -26,9 +54,9 @@ func main() {
 		w.Header().Set("Content-Type", "text/html; charset=utf-8")
 		w.WriteHeader(http.StatusOK)
 		_, _ = w.Write(b)
-	}).Methods(http.MethodGet)
+	}).Methods(http.MethodGet), roleSpectator)
 	// Leaderboard page
-	r.HandleFunc("/leaderboard", func(w http.ResponseWriter, r *http.Request) {
+	rr.allow(r.HandleFunc("/leaderboard", func(w http.ResponseWriter, r *http.Request) {
 		b, err := ioutil.ReadFile("leaderboard.html")
 		if err != nil {
 			http.Error(w, "UI not found", http.StatusNotFound)
@@ -37,26 +65,98 @@ func main() {
 		w.Header().Set("Content-Type", "text/html; charset=utf-8")
 		w.WriteHeader(http.StatusOK)
 		_, _ = w.Write(b)
-	}).Methods(http.MethodGet)
-	r.HandleFunc("/games", getGames).Methods(http.MethodGet)
-	r.HandleFunc("/games/start", postStartNewGame).Methods(http.MethodPost)
-	r.HandleFunc("/games/{gameId}", getGame).Methods(http.MethodGet)
-	r.HandleFunc("/games/{gameId}/queue", postQueue).Methods(http.MethodPost)
-	r.HandleFunc("/games/{gameId}/goal", postGoal).Methods(http.MethodPost)
-	r.HandleFunc("/games/{gameId}/undo", postUndo).Methods(http.MethodPost)
-	r.HandleFunc("/games/{gameId}/remove", postRemovePlayer).Methods(http.MethodPost)
+	}).Methods(http.MethodGet), roleSpectator)
+	rr.allow(r.HandleFunc("/games", getGames).Methods(http.MethodGet), roleSpectator)
+	rr.allow(r.HandleFunc("/games/start", postStartNewGame).Methods(http.MethodPost), roleReferee)
+	rr.allow(r.HandleFunc("/games/{gameId}", getGame).Methods(http.MethodGet), roleSpectator)
+	rr.allow(r.HandleFunc("/games/{gameId}", postGameCommand).Methods(http.MethodPost), roleReferee)
+	rr.allow(r.HandleFunc("/games/{gameId}/events", getGameEvents).Methods(http.MethodGet), roleSpectator)
+	rr.allow(r.HandleFunc("/games/{gameId}/queue", postQueue).Methods(http.MethodPost), rolePlayer)
+	rr.allow(r.HandleFunc("/games/{gameId}/queue/step-aside", postStepAside).Methods(http.MethodPost), rolePlayer)
+	rr.allow(r.HandleFunc("/games/{gameId}/queue/ready", postQueueReady).Methods(http.MethodPost), rolePlayer)
+	rr.allow(r.HandleFunc("/games/{gameId}/queue/move", postMoveInQueue).Methods(http.MethodPost), roleReferee)
+	rr.allow(r.HandleFunc("/games/{gameId}/queue/batch-add", postQueueBatchAdd).Methods(http.MethodPost), roleReferee)
+	rr.allow(r.HandleFunc("/games/{gameId}/queue/batch-remove", postQueueBatchRemove).Methods(http.MethodPost), roleReferee)
+	rr.allow(r.HandleFunc("/games/{gameId}/queue/reorder", postQueueReorder).Methods(http.MethodPost), roleReferee)
+	rr.allow(r.HandleFunc("/games/{gameId}/queue/shuffle", postQueueShuffle).Methods(http.MethodPost), roleReferee)
+	rr.allow(r.HandleFunc("/games/{gameId}/queue/priority", postQueuePriority).Methods(http.MethodPost), roleAdmin)
+	rr.allow(r.HandleFunc("/games/{gameId}/goal", postGoal).Methods(http.MethodPost), roleReferee)
+	rr.allow(r.HandleFunc("/games/{gameId}/undo", postUndo).Methods(http.MethodPost), roleReferee)
+	rr.allow(r.HandleFunc("/games/{gameId}/remove", postRemovePlayer).Methods(http.MethodPost), rolePlayer)
+	// Venues: several tables sharing one queue
+	rr.allow(r.HandleFunc("/venues", getVenues).Methods(http.MethodGet), roleSpectator)
+	rr.allow(r.HandleFunc("/venues", postVenue).Methods(http.MethodPost), roleReferee)
+	rr.allow(r.HandleFunc("/venues/{venueId}", getVenue).Methods(http.MethodGet), roleSpectator)
+	rr.allow(r.HandleFunc("/venues/{venueId}/tables", postVenueTable).Methods(http.MethodPost), roleReferee)
+	rr.allow(r.HandleFunc("/venues/{venueId}/queue", postVenueQueue).Methods(http.MethodPost), rolePlayer)
+	rr.allow(r.HandleFunc("/venues/{venueId}/remove", postVenueRemove).Methods(http.MethodPost), rolePlayer)
+	rr.allow(r.HandleFunc("/venues/{venueId}/events", getVenueEvents).Methods(http.MethodGet), roleSpectator)
+	// Tournaments
+	rr.allow(r.HandleFunc("/tournaments", getTournaments).Methods(http.MethodGet), roleSpectator)
+	rr.allow(r.HandleFunc("/tournaments", postTournament).Methods(http.MethodPost), roleReferee)
+	rr.allow(r.HandleFunc("/tournaments/{tournamentId}", getTournament).Methods(http.MethodGet), roleSpectator)
+	rr.allow(r.HandleFunc("/tournaments/{tournamentId}/pairs", postTournamentPair).Methods(http.MethodPost), roleReferee)
+	rr.allow(r.HandleFunc("/tournaments/{tournamentId}/start", postTournamentStart).Methods(http.MethodPost), roleReferee)
+	rr.allow(r.HandleFunc("/tournaments/{tournamentId}/matches/{matchId:[0-9]+}/game", postMatchGame).Methods(http.MethodPost), roleReferee)
+	rr.allow(r.HandleFunc("/tournaments/{tournamentId}/matches/{matchId:[0-9]+}/result", postMatchResult).Methods(http.MethodPost), roleReferee)
+	// Seasons / leagues (require the database)
+	rr.allow(r.HandleFunc("/seasons", getSeasons).Methods(http.MethodGet), roleSpectator)
+	rr.allow(r.HandleFunc("/seasons", postSeason).Methods(http.MethodPost), roleReferee)
+	rr.allow(r.HandleFunc("/seasons/{seasonId:[0-9]+}", getSeason).Methods(http.MethodGet), roleSpectator)
+	rr.allow(r.HandleFunc("/seasons/{seasonId:[0-9]+}/fixtures", getSeasonFixtures).Methods(http.MethodGet), roleSpectator)
+	rr.allow(r.HandleFunc("/seasons/{seasonId:[0-9]+}/fixtures/{fixtureId:[0-9]+}/result", postFixtureResult).Methods(http.MethodPost), roleReferee)
+	rr.allow(r.HandleFunc("/seasons/{seasonId:[0-9]+}/standings", getSeasonStandings).Methods(http.MethodGet), roleSpectator)
 	// Players catalogue
-	r.HandleFunc("/players", getPlayers).Methods(http.MethodGet)
-	r.HandleFunc("/players", postPlayer).Methods(http.MethodPost)
-	r.HandleFunc("/players/stats", getPlayersStats).Methods(http.MethodGet)
+	rr.allow(r.HandleFunc("/players", getPlayers).Methods(http.MethodGet), roleSpectator)
+	rr.allow(r.HandleFunc("/players", postPlayer).Methods(http.MethodPost), roleReferee)
+	rr.allow(r.HandleFunc("/players/stats", getPlayersStats).Methods(http.MethodGet), roleSpectator)
+	rr.allow(r.HandleFunc("/players/merge", postMergePlayers).Methods(http.MethodPost), roleAdmin)
+	rr.allow(r.HandleFunc("/players/{id:[0-9]+}", getPlayer).Methods(http.MethodGet), roleSpectator)
+	rr.allow(r.HandleFunc("/players/{id:[0-9]+}", patchPlayer).Methods(http.MethodPatch), roleReferee)
+	rr.allow(r.HandleFunc("/players/{id:[0-9]+}/pin", postPlayerPIN).Methods(http.MethodPost), rolePlayer)
+	rr.allow(r.HandleFunc("/players/{id:[0-9]+}/rename", postRenamePlayer).Methods(http.MethodPost), roleAdmin)
+	rr.allow(r.HandleFunc("/players/{id:[0-9]+}/deactivate", postDeactivatePlayer).Methods(http.MethodPost), roleAdmin)
+	rr.allow(r.HandleFunc("/players/{id:[0-9]+}/reactivate", postReactivatePlayer).Methods(http.MethodPost), roleAdmin)
+	rr.allow(r.HandleFunc("/players/{id:[0-9]+}/anonymize", postAnonymizePlayer).Methods(http.MethodPost), roleAdmin)
+	rr.allow(r.HandleFunc("/players/{id:[0-9]+}/export", getPlayerExport).Methods(http.MethodGet), roleAdmin)
+	// Bulk exports for analysis (streamed)
+	rr.allow(r.HandleFunc("/export/goal_events", getExportGoalEvents).Methods(http.MethodGet), roleReferee)
+	rr.allow(r.HandleFunc("/export/players", getExportPlayers).Methods(http.MethodGet), roleReferee)
 	// Leaderboard data
-	r.HandleFunc("/leaderboard/data", getLeaderboardData).Methods(http.MethodGet)
+	rr.allow(r.HandleFunc("/leaderboard/data", getLeaderboardData).Methods(http.MethodGet), roleSpectator)
+	// Sessions
+	rr.allow(r.HandleFunc("/auth/session", postSession).Methods(http.MethodPost), roleSpectator)
+	rr.allow(r.HandleFunc("/auth/session", deleteSession).Methods(http.MethodDelete), roleSpectator)
+	rr.allow(r.HandleFunc("/auth/pin", postPINSession).Methods(http.MethodPost), roleSpectator)
+	rr.allow(r.HandleFunc("/auth/whoami", getWhoami).Methods(http.MethodGet), roleSpectator)
+	// API tokens
+	rr.allow(r.HandleFunc("/admin/tokens", getTokens).Methods(http.MethodGet), roleAdmin)
+	rr.allow(r.HandleFunc("/admin/tokens", postToken).Methods(http.MethodPost), roleAdmin)
+	rr.allow(r.HandleFunc("/admin/tokens/{id}", deleteToken).Methods(http.MethodDelete), roleAdmin)
+	// DB write queue dead letters
+	rr.allow(r.HandleFunc("/admin/dead-letters", getDeadLetters).Methods(http.MethodGet), roleAdmin)
+	rr.allow(r.HandleFunc("/admin/dead-letters/{id}/retry", postRetryDeadLetter).Methods(http.MethodPost), roleAdmin)
+	rr.allow(r.HandleFunc("/admin/dead-letters/{id}", deleteDeadLetter).Methods(http.MethodDelete), roleAdmin)
+	// Webhooks
+	rr.allow(r.HandleFunc("/admin/webhooks", getWebhooks).Methods(http.MethodGet), roleAdmin)
+	rr.allow(r.HandleFunc("/admin/webhooks", postWebhook).Methods(http.MethodPost), roleAdmin)
+	rr.allow(r.HandleFunc("/admin/webhooks/{id}", deleteWebhook).Methods(http.MethodDelete), roleAdmin)
+	rr.allow(r.HandleFunc("/admin/webhooks/{id}/deliveries", getWebhookDeliveries).Methods(http.MethodGet), roleAdmin)
+	rr.allow(r.HandleFunc("/admin/webhooks/{id}/ping", postWebhookPing).Methods(http.MethodPost), roleAdmin)
+	// Slack users linked to players
+	rr.allow(r.HandleFunc("/admin/slack-links", getSlackLinks).Methods(http.MethodGet), roleAdmin)
+	rr.allow(r.HandleFunc("/admin/slack-links/{userId}", putSlackLink).Methods(http.MethodPut), roleAdmin)
+	rr.allow(r.HandleFunc("/admin/slack-links/{userId}", deleteSlackLink).Methods(http.MethodDelete), roleAdmin)
+
+	// Chat integration; requests are authenticated by their Slack signature
+	rr.allow(r.HandleFunc("/integrations/slack/command", postSlackCommand).Methods(http.MethodPost), roleSpectator)
+	rr.allow(r.HandleFunc("/integrations/slack/interactive", postSlackInteractive).Methods(http.MethodPost), roleSpectator)
 
 	// Simple health check
-	r.HandleFunc("/healthz", func(w http.ResponseWriter, r *http.Request) {
+	rr.allow(r.HandleFunc("/healthz", func(w http.ResponseWriter, r *http.Request) {
 		w.WriteHeader(http.StatusOK)
 		_, _ = w.Write([]byte("ok"))
-	}).Methods(http.MethodGet)
+	}).Methods(http.MethodGet), roleSpectator)
 
 	addr := ":8080"
 	if port := strings.TrimSpace(os.Getenv("PORT")); port != "" {
@@ -64,6 +164,56 @@ func main() {
 			addr = ":" + port
 		}
 	}
-	log.Printf("kingofthetable listening on %s", addr)
-	log.Fatal(http.ListenAndServe(addr, r))
+	srv := &http.Server{Addr: addr, Handler: r}
+	// End event streams so Shutdown does not wait on them
+	srv.RegisterOnShutdown(events.Close)
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+	go runReadyChecks(ctx)
+	go runWaitEstimates(ctx)
+	go runWebhooks(ctx)
+	errc := make(chan error, 1)
+	go func() {
+		log.Printf("kingofthetable listening on %s", addr)
+		errc <- srv.ListenAndServe()
+	}()
+	select {
+	case err := <-errc:
+		if !errors.Is(err, http.ErrServerClosed) {
+			return err
+		}
+	case <-ctx.Done():
+	}
+	stop()
+	shutdown(srv)
+	return nil
+}
+
+// shutdown stops accepting requests, lets in-flight handlers finish, then
+// drains the DB write queue and closes the pool, each within its own deadline.
+func shutdown(srv *http.Server) {
+	log.Printf("shutting down")
+	httpCtx, cancel := context.WithTimeout(context.Background(), envDuration("SHUTDOWN_TIMEOUT", 15*time.Second))
+	defer cancel()
+	if err := srv.Shutdown(httpCtx); err != nil {
+		log.Printf("http shutdown: %v", err)
+	}
+	if db != nil {
+		drainCtx, cancel := context.WithTimeout(context.Background(), envDuration("DB_DRAIN_TIMEOUT", 30*time.Second))
+		defer cancel()
+		if err := db.Close(drainCtx); err != nil {
+			log.Printf("[db] close: %v", err)
+		}
+	}
+	log.Printf("bye")
+}
+
+// envDuration reads a Go duration (e.g. "10s") from the environment, falling back to def.
+func envDuration(key string, def time.Duration) time.Duration {
+	if s := strings.TrimSpace(os.Getenv(key)); s != "" {
+		if v, err := time.ParseDuration(s); err == nil && v > 0 {
+			return v
+		}
+	}
+	return def
 }
@@ -0,0 +1,292 @@
+package main
+
+import (
+	"context"
+	"database/sql"
+	"embed"
+	"errors"
+	"fmt"
+	"io/fs"
+	"path"
+	"slices"
+	"strings"
+)
+
+// The schema ships inside the binary so migrate needs no checkout.
+//
+//go:embed schema.sql migrations/*.sql
+var schemaFiles embed.FS
+
+// Applied migrations, one row per file name (without .sql).
+const schemaMigrationsDDL = `CREATE TABLE IF NOT EXISTS schema_migrations (
+  version VARCHAR(100) NOT NULL,
+  applied_at DATETIME NOT NULL DEFAULT CURRENT_TIMESTAMP,
+  PRIMARY KEY (version)
+) ENGINE=InnoDB DEFAULT CHARSET=utf8mb4 COLLATE=utf8mb4_unicode_ci`
+
+// migrationVersions lists the embedded migrations in order ("001_goal_events_seq", ...).
+func migrationVersions() []string {
+	entries, _ := fs.ReadDir(schemaFiles, "migrations")
+	var out []string
+	for _, e := range entries {
+		if name := e.Name(); strings.HasSuffix(name, ".sql") {
+			out = append(out, strings.TrimSuffix(name, ".sql"))
+		}
+	}
+	slices.Sort(out)
+	return out
+}
+
+// migrationNumber is the numeric prefix of a version ("001").
+func migrationNumber(version string) string {
+	n, _, _ := strings.Cut(version, "_")
+	return n
+}
+
+// splitStatements splits a SQL file on semicolons ending a line, dropping
+// comment lines. The schema files keep one statement per ";"-terminated block.
+func splitStatements(src string) []string {
+	var out []string
+	var cur []string
+	for _, line := range strings.Split(src, "\n") {
+		t := strings.TrimSpace(line)
+		if t == "" || strings.HasPrefix(t, "--") {
+			continue
+		}
+		cur = append(cur, line)
+		if strings.HasSuffix(t, ";") {
+			stmt := strings.TrimSuffix(strings.TrimSpace(strings.Join(cur, "\n")), ";")
+			out = append(out, stmt)
+			cur = nil
+		}
+	}
+	if stmt := strings.TrimSpace(strings.Join(cur, "\n")); stmt != "" {
+		out = append(out, stmt)
+	}
+	return out
+}
+
+// rowQuerier is a *sql.DB or a *sql.Conn.
+type rowQuerier interface {
+	QueryRowContext(ctx context.Context, query string, args ...any) *sql.Row
+}
+
+// tableExists reports whether the current database has the table.
+func tableExists(ctx context.Context, q rowQuerier, table string) (bool, error) {
+	var n int
+	err := q.QueryRowContext(ctx,
+		"SELECT COUNT(*) FROM information_schema.tables WHERE table_schema = DATABASE() AND table_name = ?", table).Scan(&n)
+	return n > 0, err
+}
+
+// columnExists reports whether the table in the current database has the column.
+func columnExists(ctx context.Context, q rowQuerier, table, column string) (bool, error) {
+	var n int
+	err := q.QueryRowContext(ctx,
+		"SELECT COUNT(*) FROM information_schema.columns WHERE table_schema = DATABASE() AND table_name = ? AND column_name = ?", table, column).Scan(&n)
+	return n > 0, err
+}
+
+// originalSchema reports whether an untracked database still has the schema
+// from before the first migration (goal_events without seq), so every
+// migration applies.
+func originalSchema(ctx context.Context, q rowQuerier) (bool, error) {
+	hasSeq, err := columnExists(ctx, q, "goal_events", "seq")
+	return !hasSeq, err
+}
+
+// appliedMigrations returns the recorded versions; ok is false when the
+// database has no schema_migrations table yet.
+func appliedMigrations(ctx context.Context, sqldb *sql.DB) (applied map[string]bool, ok bool, err error) {
+	if ok, err = tableExists(ctx, sqldb, "schema_migrations"); err != nil || !ok {
+		return nil, ok, err
+	}
+	rows, err := sqldb.QueryContext(ctx, "SELECT version FROM schema_migrations")
+	if err != nil {
+		return nil, true, err
+	}
+	defer rows.Close()
+	applied = map[string]bool{}
+	for rows.Next() {
+		var v string
+		if err := rows.Scan(&v); err != nil {
+			return nil, true, err
+		}
+		applied[v] = true
+	}
+	return applied, true, rows.Err()
+}
+
+// pendingMigrations lists the embedded migrations not yet applied.
+func pendingMigrations(ctx context.Context, sqldb *sql.DB) ([]string, error) {
+	applied, ok, err := appliedMigrations(ctx, sqldb)
+	if err != nil {
+		return nil, err
+	}
+	if !ok {
+		if hasPlayers, err := tableExists(ctx, sqldb, "players"); err != nil {
+			return nil, err
+		} else if !hasPlayers {
+			return nil, errors.New("empty database; run migrate to create the schema")
+		}
+		if orig, err := originalSchema(ctx, sqldb); err != nil {
+			return nil, err
+		} else if orig {
+			return nil, errors.New("no migration history and the original schema; run migrate to apply every migration")
+		}
+		return nil, errors.New("no migration history; run migrate -baseline NNN with the last migration the database has")
+	}
+	var out []string
+	for _, v := range migrationVersions() {
+		if !applied[v] {
+			out = append(out, v)
+		}
+	}
+	return out, nil
+}
+
+// runMigrate: migrate [-dry-run] [-baseline NNN]
+//
+// An empty database gets schema.sql and every migration is recorded as
+// applied. A database created before migrations were tracked gets every
+// migration when it still has the original schema; otherwise it must be
+// baselined once with the number of the last migration it already has
+// (000 for none).
+func runMigrate(args []string) error {
+	fset := commandFlags("migrate")
+	dryRun := fset.Bool("dry-run", false, "list what would run")
+	baseline := fset.String("baseline", "", "record migrations up to this number as applied without running them (000 or none: record nothing)")
+	if err := parseFlags(fset, args); err != nil {
+		return err
+	}
+	if fset.NArg() != 0 {
+		return usageError("unexpected arguments")
+	}
+	versions := migrationVersions()
+	if *baseline == "none" {
+		*baseline = "000"
+	}
+	if *baseline != "" && *baseline != "000" && !slices.ContainsFunc(versions, func(v string) bool { return migrationNumber(v) == *baseline }) {
+		return usageError("no migration numbered " + *baseline)
+	}
+	d, err := openAdminDB()
+	if err != nil {
+		return err
+	}
+	defer d.sql.Close()
+	ctx, cancel := commandContext()
+	defer cancel()
+	// One connection, so session settings in the files apply to what follows
+	conn, err := d.sql.Conn(ctx)
+	if err != nil {
+		return err
+	}
+	defer conn.Close()
+
+	applied, tracked, err := appliedMigrations(ctx, d.sql)
+	if err != nil {
+		return err
+	}
+	run := func(label, src string) error {
+		stmts := splitStatements(src)
+		if *dryRun {
+			fmt.Printf("would apply %s (%d statement(s))\n", label, len(stmts))
+			return nil
+		}
+		for i, stmt := range stmts {
+			if _, err := conn.ExecContext(ctx, stmt); err != nil {
+				return fmt.Errorf("%s, statement %d: %w", label, i+1, err)
+			}
+		}
+		fmt.Printf("applied %s\n", label)
+		return nil
+	}
+	record := func(versions ...string) error {
+		if *dryRun || len(versions) == 0 {
+			return nil
+		}
+		if _, err := conn.ExecContext(ctx, schemaMigrationsDDL); err != nil {
+			return err
+		}
+		for _, v := range versions {
+			if _, err := conn.ExecContext(ctx, "INSERT IGNORE INTO schema_migrations (version) VALUES (?)", v); err != nil {
+				return err
+			}
+		}
+		return nil
+	}
+
+	if !tracked {
+		hasPlayers, err := tableExists(ctx, conn, "players")
+		if err != nil {
+			return err
+		}
+		switch {
+		case !hasPlayers:
+			// Empty database: the full schema already includes every migration
+			src, err := schemaFiles.ReadFile("schema.sql")
+			if err != nil {
+				return err
+			}
+			if err := run("schema.sql", string(src)); err != nil {
+				return err
+			}
+			if err := record(versions...); err != nil {
+				return err
+			}
+			if *dryRun {
+				fmt.Printf("would record %d migration(s) as applied\n", len(versions))
+			}
+			return nil
+		case *baseline == "":
+			orig, err := originalSchema(ctx, conn)
+			if err != nil {
+				return err
+			}
+			if !orig {
+				return errors.New("database has tables but no migration history; rerun with -baseline NNN, the last migration it already has (000 for none)")
+			}
+			fmt.Println("database has the original schema and no migration history; applying every migration")
+			*baseline = "000"
+		}
+		applied = map[string]bool{}
+	} else if *baseline != "" {
+		return usageError("migration history already exists; -baseline is only for untracked databases")
+	}
+	if *baseline != "" {
+		var base []string
+		for _, v := range versions {
+			if migrationNumber(v) <= *baseline {
+				base = append(base, v)
+				applied[v] = true
+			}
+		}
+		if *dryRun {
+			fmt.Printf("would record %d migration(s) as applied (baseline)\n", len(base))
+		}
+		if err := record(base...); err != nil {
+			return err
+		}
+	}
+	pending := 0
+	for _, v := range versions {
+		if applied[v] {
+			continue
+		}
+		pending++
+		src, err := schemaFiles.ReadFile(path.Join("migrations", v+".sql"))
+		if err != nil {
+			return err
+		}
+		if err := run(v, string(src)); err != nil {
+			return err
+		}
+		if err := record(v); err != nil {
+			return err
+		}
+	}
+	if pending == 0 {
+		fmt.Println("schema up to date")
+	}
+	return nil
+}
@@ -0,0 +1,4 @@
+-- Per-game sequence numbers on goal events (undo reverses the exact event)
+ALTER TABLE goal_events
+  ADD COLUMN seq BIGINT UNSIGNED NULL AFTER game_id,
+  ADD UNIQUE KEY ux_goal_events_game_seq (game_id, seq);
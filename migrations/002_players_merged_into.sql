@@ -0,0 +1,10 @@
+-- Player merges: merged rows keep their name as an alias of the surviving player
+ALTER TABLE players
+  ADD COLUMN merged_into INT UNSIGNED NULL AFTER full_rotation,
+  ADD KEY ix_players_merged_into (merged_into);
+
+-- Normalize whitespace in existing names ("alice  b " -> "alice b") where it does not collide
+UPDATE players p
+  LEFT JOIN players o ON o.name = TRIM(REGEXP_REPLACE(p.name, '[[:space:]]+', ' ')) AND o.id <> p.id
+   SET p.name = TRIM(REGEXP_REPLACE(p.name, '[[:space:]]+', ' '))
+ WHERE o.id IS NULL;
@@ -0,0 +1,5 @@
+-- Optional player profile fields
+ALTER TABLE players
+  ADD COLUMN avatar_url VARCHAR(255) NULL AFTER full_rotation,
+  ADD COLUMN nickname VARCHAR(50) NULL AFTER avatar_url,
+  ADD COLUMN preferred_role ENUM('forward','goalkeeper','any') NULL AFTER nickname;
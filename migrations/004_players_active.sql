@@ -0,0 +1,5 @@
+-- Player deactivation and anonymization
+ALTER TABLE players
+  ADD COLUMN active TINYINT(1) NOT NULL DEFAULT 1 AFTER preferred_role,
+  ADD COLUMN deactivated_at DATETIME NULL AFTER active,
+  ADD COLUMN anonymized_at DATETIME NULL AFTER deactivated_at;
@@ -0,0 +1,13 @@
+-- API tokens for authentication
+CREATE TABLE IF NOT EXISTS api_tokens (
+  id CHAR(16) NOT NULL,
+  token_hash CHAR(64) NOT NULL,
+  role ENUM('spectator','player','referee','admin') NOT NULL,
+  player_id INT UNSIGNED NULL,
+  label VARCHAR(100) NOT NULL DEFAULT '',
+  created_at DATETIME NOT NULL DEFAULT CURRENT_TIMESTAMP,
+  revoked_at DATETIME NULL,
+  PRIMARY KEY (id),
+  UNIQUE KEY ux_api_tokens_hash (token_hash),
+  CONSTRAINT fk_api_tokens_player FOREIGN KEY (player_id) REFERENCES players(id)
+) ENGINE=InnoDB DEFAULT CHARSET=utf8mb4 COLLATE=utf8mb4_unicode_ci;
@@ -0,0 +1,3 @@
+-- Player self-service PINs
+ALTER TABLE players
+  ADD COLUMN pin_hash VARCHAR(90) NULL AFTER anonymized_at;
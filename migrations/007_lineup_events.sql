@@ -0,0 +1,21 @@
+-- Swap / substitute events
+CREATE TABLE IF NOT EXISTS lineup_events (
+  id BIGINT UNSIGNED NOT NULL AUTO_INCREMENT,
+  game_id CHAR(24) NOT NULL,
+  seq BIGINT UNSIGNED NULL,
+  kind ENUM('swap','substitute') NOT NULL,
+  team ENUM('red','blue') NOT NULL,
+  forward_id INT UNSIGNED NOT NULL,
+  goalkeeper_id INT UNSIGNED NOT NULL,
+  player_out_id INT UNSIGNED NULL,
+  player_in_id INT UNSIGNED NULL,
+  created_at DATETIME NOT NULL DEFAULT CURRENT_TIMESTAMP,
+  PRIMARY KEY (id),
+  UNIQUE KEY ux_lineup_events_game_seq (game_id, seq),
+  CONSTRAINT fk_le_game FOREIGN KEY (game_id) REFERENCES games(id)
+    ON DELETE CASCADE ON UPDATE RESTRICT,
+  CONSTRAINT fk_le_forward FOREIGN KEY (forward_id) REFERENCES players(id),
+  CONSTRAINT fk_le_goalkeeper FOREIGN KEY (goalkeeper_id) REFERENCES players(id),
+  CONSTRAINT fk_le_out FOREIGN KEY (player_out_id) REFERENCES players(id),
+  CONSTRAINT fk_le_in FOREIGN KEY (player_in_id) REFERENCES players(id)
+) ENGINE=InnoDB DEFAULT CHARSET=utf8mb4 COLLATE=utf8mb4_unicode_ci;
@@ -0,0 +1,62 @@
+-- Seasons / leagues: teams, fixtures and standings
+CREATE TABLE IF NOT EXISTS seasons (
+  id INT UNSIGNED NOT NULL AUTO_INCREMENT,
+  name VARCHAR(100) NOT NULL,
+  starts_on DATE NOT NULL,
+  ends_on DATE NOT NULL,
+  legs TINYINT UNSIGNED NOT NULL DEFAULT 1,
+  created_at DATETIME NOT NULL DEFAULT CURRENT_TIMESTAMP,
+  PRIMARY KEY (id),
+  UNIQUE KEY ux_seasons_name (name)
+) ENGINE=InnoDB DEFAULT CHARSET=utf8mb4 COLLATE=utf8mb4_unicode_ci;
+
+CREATE TABLE IF NOT EXISTS season_teams (
+  id INT UNSIGNED NOT NULL AUTO_INCREMENT,
+  season_id INT UNSIGNED NOT NULL,
+  name VARCHAR(100) NOT NULL,
+  forward_id INT UNSIGNED NOT NULL,
+  goalkeeper_id INT UNSIGNED NOT NULL,
+  PRIMARY KEY (id),
+  UNIQUE KEY ux_season_teams_name (season_id, name),
+  CONSTRAINT fk_st_season FOREIGN KEY (season_id) REFERENCES seasons(id)
+    ON DELETE CASCADE,
+  CONSTRAINT fk_st_forward FOREIGN KEY (forward_id) REFERENCES players(id),
+  CONSTRAINT fk_st_goalkeeper FOREIGN KEY (goalkeeper_id) REFERENCES players(id)
+) ENGINE=InnoDB DEFAULT CHARSET=utf8mb4 COLLATE=utf8mb4_unicode_ci;
+
+CREATE TABLE IF NOT EXISTS season_fixtures (
+  id INT UNSIGNED NOT NULL AUTO_INCREMENT,
+  season_id INT UNSIGNED NOT NULL,
+  round SMALLINT UNSIGNED NOT NULL,
+  scheduled_on DATE NOT NULL,
+  home_team_id INT UNSIGNED NOT NULL,
+  away_team_id INT UNSIGNED NOT NULL,
+  home_score TINYINT UNSIGNED NULL,
+  away_score TINYINT UNSIGNED NULL,
+  played_at DATETIME NULL,
+  PRIMARY KEY (id),
+  KEY ix_season_fixtures_round (season_id, round),
+  CONSTRAINT fk_sf_season FOREIGN KEY (season_id) REFERENCES seasons(id)
+    ON DELETE CASCADE,
+  CONSTRAINT fk_sf_home FOREIGN KEY (home_team_id) REFERENCES season_teams(id),
+  CONSTRAINT fk_sf_away FOREIGN KEY (away_team_id) REFERENCES season_teams(id)
+) ENGINE=InnoDB DEFAULT CHARSET=utf8mb4 COLLATE=utf8mb4_unicode_ci;
+
+-- Recomputed from season_fixtures whenever a result is recorded
+CREATE TABLE IF NOT EXISTS season_standings (
+  season_id INT UNSIGNED NOT NULL,
+  team_id INT UNSIGNED NOT NULL,
+  played SMALLINT UNSIGNED NOT NULL DEFAULT 0,
+  won SMALLINT UNSIGNED NOT NULL DEFAULT 0,
+  drawn SMALLINT UNSIGNED NOT NULL DEFAULT 0,
+  lost SMALLINT UNSIGNED NOT NULL DEFAULT 0,
+  goals_for INT UNSIGNED NOT NULL DEFAULT 0,
+  goals_against INT UNSIGNED NOT NULL DEFAULT 0,
+  points INT UNSIGNED NOT NULL DEFAULT 0,
+  updated_at DATETIME NOT NULL DEFAULT CURRENT_TIMESTAMP ON UPDATE CURRENT_TIMESTAMP,
+  PRIMARY KEY (season_id, team_id),
+  CONSTRAINT fk_ss_season FOREIGN KEY (season_id) REFERENCES seasons(id)
+    ON DELETE CASCADE,
+  CONSTRAINT fk_ss_team FOREIGN KEY (team_id) REFERENCES season_teams(id)
+    ON DELETE CASCADE
+) ENGINE=InnoDB DEFAULT CHARSET=utf8mb4 COLLATE=utf8mb4_unicode_ci;
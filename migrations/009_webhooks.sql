@@ -0,0 +1,10 @@
+-- Webhook subscriptions (the delivery log is kept in memory)
+CREATE TABLE IF NOT EXISTS webhooks (
+  id CHAR(16) NOT NULL,
+  url VARCHAR(2048) NOT NULL,
+  events VARCHAR(500) NOT NULL DEFAULT '',
+  secret VARCHAR(128) NOT NULL,
+  label VARCHAR(100) NOT NULL DEFAULT '',
+  created_at DATETIME NOT NULL DEFAULT CURRENT_TIMESTAMP,
+  PRIMARY KEY (id)
+) ENGINE=InnoDB DEFAULT CHARSET=utf8mb4 COLLATE=utf8mb4_unicode_ci;
@@ -0,0 +1,9 @@
+-- Slack users linked to the player they act as
+CREATE TABLE IF NOT EXISTS slack_links (
+  slack_user_id VARCHAR(32) NOT NULL,
+  player_id INT UNSIGNED NOT NULL,
+  created_at DATETIME NOT NULL DEFAULT CURRENT_TIMESTAMP,
+  PRIMARY KEY (slack_user_id),
+  KEY ix_slack_links_player (player_id),
+  CONSTRAINT fk_slack_links_player FOREIGN KEY (player_id) REFERENCES players(id)
+) ENGINE=InnoDB DEFAULT CHARSET=utf8mb4 COLLATE=utf8mb4_unicode_ci;
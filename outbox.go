@@ -0,0 +1,259 @@
+package main
+
+import (
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+)
+
+// outboxRecord is the on-disk (JSON lines) form of a dbOp. Ack lines carry
+// only the sequence number of the op they confirm.
+type outboxRecord struct {
+	Seq    uint64   `json:"seq"`
+	Ack    bool     `json:"ack,omitempty"`
+	Type   dbOpType `json:"type,omitempty"`
+	Names  []string `json:"names,omitempty"`
+	GameID string   `json:"game_id,omitempty"`
+	// Per-game mutation sequence
+	EventSeq int64           `json:"event_seq,omitempty"`
+	Team     string          `json:"team,omitempty"`
+	Red      TeamState       `json:"red"`
+	Blue     TeamState       `json:"blue"`
+	Rot      rotationSummary `json:"rotation"`
+	Award    bool            `json:"award,omitempty"`
+	Lineup   *lineupChange   `json:"lineup,omitempty"`
+}
+
+func (op dbOp) record() outboxRecord {
+	var lc *lineupChange
+	if op.typ == opLineupChange {
+		lc = &op.lineup
+	}
+	return outboxRecord{
+		Seq:      op.seq,
+		Type:     op.typ,
+		Names:    op.names,
+		GameID:   op.gameID,
+		EventSeq: op.eventSeq,
+		Team:     op.team,
+		Red:      op.gs.Red,
+		Blue:     op.gs.Blue,
+		Rot:      op.rot,
+		Award:    op.award,
+		Lineup:   lc,
+	}
+}
+
+func (r outboxRecord) op() dbOp {
+	var lc lineupChange
+	if r.Lineup != nil {
+		lc = *r.Lineup
+	}
+	return dbOp{
+		seq:      r.Seq,
+		typ:      r.Type,
+		names:    r.Names,
+		gameID:   r.GameID,
+		eventSeq: r.EventSeq,
+		team:     r.Team,
+		gs:       GameState{Red: r.Red, Blue: r.Blue},
+		rot:      r.Rot,
+		award:    r.Award,
+		lineup:   lc,
+	}
+}
+
+// outboxCompactBytes is the file size above which a fully-acked outbox is truncated.
+const outboxCompactBytes = 1 << 20
+
+// outbox is a write-ahead file backing the async DB queue. Every op is
+// appended before it is handed to the worker and acked once applied (or
+// dropped), so ops that were still pending when the process exited are
+// replayed on the next start.
+type outbox struct {
+	mu      sync.Mutex
+	path    string
+	f       *os.File
+	fsync   bool
+	nextSeq uint64
+	pending map[uint64]struct{}
+	size    int64
+}
+
+// openOutbox loads the file at path, rewrites it with only the un-acked ops
+// and returns those ops in their original order for replay.
+func openOutbox(path string, fsync bool) (*outbox, []dbOp, error) {
+	recs, lastSeq, err := readOutbox(path)
+	if err != nil {
+		return nil, nil, err
+	}
+	ops := make([]dbOp, 0, len(recs))
+	for _, r := range recs {
+		ops = append(ops, r.op())
+	}
+	// Compact: rewrite the file with pending records only.
+	tmp := path + ".tmp"
+	tf, err := os.OpenFile(tmp, os.O_CREATE|os.O_TRUNC|os.O_WRONLY, 0o600)
+	if err != nil {
+		return nil, nil, err
+	}
+	w := bufio.NewWriter(tf)
+	var size int64
+	for _, r := range recs {
+		b, _ := json.Marshal(r)
+		n, _ := w.Write(append(b, '\n'))
+		size += int64(n)
+	}
+	if err := w.Flush(); err != nil {
+		_ = tf.Close()
+		return nil, nil, err
+	}
+	if err := tf.Sync(); err != nil {
+		_ = tf.Close()
+		return nil, nil, err
+	}
+	if err := tf.Close(); err != nil {
+		return nil, nil, err
+	}
+	if err := os.Rename(tmp, path); err != nil {
+		return nil, nil, err
+	}
+	f, err := os.OpenFile(path, os.O_APPEND|os.O_WRONLY, 0o600)
+	if err != nil {
+		return nil, nil, err
+	}
+	o := &outbox{
+		path:    path,
+		f:       f,
+		fsync:   fsync,
+		nextSeq: lastSeq + 1,
+		pending: make(map[uint64]struct{}, len(recs)),
+		size:    size,
+	}
+	for _, r := range recs {
+		o.pending[r.Seq] = struct{}{}
+	}
+	return o, ops, nil
+}
+
+// readOutbox returns un-acked records sorted by sequence and the highest
+// sequence seen. A torn trailing line (crash mid-write) is ignored.
+func readOutbox(path string) ([]outboxRecord, uint64, error) {
+	if dir := filepath.Dir(path); dir != "" {
+		if err := os.MkdirAll(dir, 0o755); err != nil {
+			return nil, 0, err
+		}
+	}
+	f, err := os.Open(path)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil, 0, nil
+		}
+		return nil, 0, err
+	}
+	defer f.Close()
+	byseq := map[uint64]outboxRecord{}
+	var last uint64
+	rd := bufio.NewReader(f)
+	for lineNo := 1; ; lineNo++ {
+		line, err := rd.ReadBytes('\n')
+		if len(strings.TrimSpace(string(line))) > 0 {
+			var r outboxRecord
+			if jerr := json.Unmarshal(line, &r); jerr != nil {
+				log.Printf("[outbox] %s:%d: skipping unreadable record: %v", path, lineNo, jerr)
+			} else {
+				if r.Seq > last {
+					last = r.Seq
+				}
+				if r.Ack {
+					delete(byseq, r.Seq)
+				} else {
+					byseq[r.Seq] = r
+				}
+			}
+		}
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return nil, 0, err
+		}
+	}
+	recs := make([]outboxRecord, 0, len(byseq))
+	for _, r := range byseq {
+		recs = append(recs, r)
+	}
+	sort.Slice(recs, func(i, j int) bool { return recs[i].Seq < recs[j].Seq })
+	return recs, last, nil
+}
+
+// Append assigns the next sequence number to op and writes it durably.
+func (o *outbox) Append(op *dbOp) error {
+	o.mu.Lock()
+	defer o.mu.Unlock()
+	op.seq = o.nextSeq
+	o.nextSeq++
+	if err := o.writeLocked(op.record()); err != nil {
+		return err
+	}
+	o.pending[op.seq] = struct{}{}
+	return nil
+}
+
+// Ack marks the op with the given sequence as done. When nothing is pending
+// and the file has grown large it is truncated.
+func (o *outbox) Ack(seq uint64) error {
+	if seq == 0 {
+		return nil
+	}
+	o.mu.Lock()
+	defer o.mu.Unlock()
+	if _, ok := o.pending[seq]; !ok {
+		return nil
+	}
+	delete(o.pending, seq)
+	if len(o.pending) == 0 && o.size > outboxCompactBytes {
+		if err := o.f.Truncate(0); err != nil {
+			return err
+		}
+		o.size = 0
+		return nil
+	}
+	return o.writeLocked(outboxRecord{Seq: seq, Ack: true})
+}
+
+// Pending returns the number of appended but not yet acked ops.
+func (o *outbox) Pending() int {
+	o.mu.Lock()
+	defer o.mu.Unlock()
+	return len(o.pending)
+}
+
+func (o *outbox) writeLocked(r outboxRecord) error {
+	b, err := json.Marshal(r)
+	if err != nil {
+		return err
+	}
+	n, err := o.f.Write(append(b, '\n'))
+	o.size += int64(n)
+	if err != nil {
+		return fmt.Errorf("outbox write: %w", err)
+	}
+	if o.fsync {
+		return o.f.Sync()
+	}
+	return nil
+}
+
+func (o *outbox) Close() error {
+	o.mu.Lock()
+	defer o.mu.Unlock()
+	return o.f.Close()
+}
@@ -0,0 +1,170 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func openTestOutbox(t *testing.T, path string) (*outbox, []dbOp) {
+	t.Helper()
+	ob, replay, err := openOutbox(path, false)
+	if err != nil {
+		t.Fatalf("openOutbox: %v", err)
+	}
+	t.Cleanup(func() { _ = ob.Close() })
+	return ob, replay
+}
+
+func TestOutboxReplaysUnackedOps(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "outbox.jsonl")
+	ob, replay := openTestOutbox(t, path)
+	if len(replay) != 0 {
+		t.Fatalf("new outbox replayed %d op(s)", len(replay))
+	}
+	ops := []dbOp{
+		{typ: opEnsurePlayers, names: []string{"alice", "bob"}},
+		{typ: opRecordGoal, gameID: "g1", eventSeq: 3, team: "red", gs: GameState{Red: TeamState{Forward: "1", Goalkeeper: "2"}}},
+		{typ: opUndoLast, gameID: "g1", eventSeq: 3},
+	}
+	for i := range ops {
+		if err := ob.Append(&ops[i]); err != nil {
+			t.Fatalf("Append: %v", err)
+		}
+	}
+	if err := ob.Ack(ops[1].seq); err != nil {
+		t.Fatalf("Ack: %v", err)
+	}
+	if got := ob.Pending(); got != 2 {
+		t.Fatalf("Pending = %d, want 2", got)
+	}
+	_ = ob.Close()
+
+	ob2, replay := openTestOutbox(t, path)
+	if len(replay) != 2 {
+		t.Fatalf("replayed %d op(s), want 2", len(replay))
+	}
+	if replay[0].seq != ops[0].seq || replay[0].typ != opEnsurePlayers || len(replay[0].names) != 2 {
+		t.Errorf("first replayed op = %+v", replay[0])
+	}
+	if replay[1].seq != ops[2].seq || replay[1].typ != opUndoLast || replay[1].gameID != "g1" || replay[1].eventSeq != 3 {
+		t.Errorf("second replayed op = %+v", replay[1])
+	}
+	// Sequence numbers continue after the highest one seen, acked or not
+	next := dbOp{typ: opEnsurePlayers}
+	if err := ob2.Append(&next); err != nil {
+		t.Fatalf("Append: %v", err)
+	}
+	if next.seq != ops[2].seq+1 {
+		t.Errorf("next seq = %d, want %d", next.seq, ops[2].seq+1)
+	}
+}
+
+func TestOutboxSkipsTornLine(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "outbox.jsonl")
+	data := `{"seq":1,"type":1,"names":["alice"],"red":{},"blue":{},"rotation":{}}
+{"seq":2,"type":1,"names":["bob"],"red":{},"blue":{},"rotation":{}}
+{"seq":2,"ack":true,"red":{},"blue":{},"rotation":{}}
+{"seq":3,"type":1,"na`
+	if err := os.WriteFile(path, []byte(data), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	_, replay := openTestOutbox(t, path)
+	if len(replay) != 1 || replay[0].seq != 1 || replay[0].names[0] != "alice" {
+		t.Fatalf("replay = %+v, want only seq 1", replay)
+	}
+}
+
+func TestOutboxTruncatesOnceDrained(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "outbox.jsonl")
+	ob, _ := openTestOutbox(t, path)
+	op := dbOp{typ: opEnsurePlayers, names: []string{"alice"}}
+	if err := ob.Append(&op); err != nil {
+		t.Fatal(err)
+	}
+	ob.size = outboxCompactBytes + 1
+	if err := ob.Ack(op.seq); err != nil {
+		t.Fatal(err)
+	}
+	if fi, err := os.Stat(path); err != nil || fi.Size() != 0 {
+		t.Fatalf("outbox not truncated: %v, %v", fi, err)
+	}
+	// Acking twice (or seq 0) is a no-op
+	if err := ob.Ack(op.seq); err != nil {
+		t.Fatal(err)
+	}
+	if err := ob.Ack(0); err != nil {
+		t.Fatal(err)
+	}
+}
+
+// newTestQueue returns a DB with a one-slot worker channel and no worker.
+func newTestQueue(t *testing.T, policy overflowPolicy) *DB {
+	t.Helper()
+	ob, _ := openTestOutbox(t, filepath.Join(t.TempDir(), "outbox.jsonl"))
+	return &DB{
+		ops:       make(chan dbOp, 1),
+		outbox:    ob,
+		overflow:  policy,
+		spillWake: make(chan struct{}, 1),
+		stop:      make(chan struct{}),
+		done:      make(chan struct{}),
+	}
+}
+
+func TestEnqueueSpillsInOrder(t *testing.T) {
+	d := newTestQueue(t, overflowSpill)
+	for _, game := range []string{"g1", "g2", "g3"} {
+		d.enqueue(dbOp{typ: opUndoLast, gameID: game})
+	}
+	if len(d.ops) != 1 || len(d.spill) != 2 {
+		t.Fatalf("channel %d, spill %d; want 1 and 2", len(d.ops), len(d.spill))
+	}
+	if got := d.queued.Load(); got != 3 {
+		t.Fatalf("queued = %d, want 3", got)
+	}
+	if got := d.outbox.Pending(); got != 3 {
+		t.Fatalf("outbox pending = %d, want 3", got)
+	}
+	go d.pumpSpill()
+	defer close(d.stop)
+	for _, want := range []string{"g1", "g2", "g3"} {
+		op := <-d.ops
+		if op.gameID != want {
+			t.Fatalf("got %s, want %s", op.gameID, want)
+		}
+		d.ack(op)
+	}
+	if got := d.outbox.Pending(); got != 0 {
+		t.Errorf("outbox pending after acks = %d, want 0", got)
+	}
+}
+
+func TestEnqueueDropAcksDroppedOp(t *testing.T) {
+	d := newTestQueue(t, overflowDrop)
+	d.enqueue(dbOp{typ: opUndoLast, gameID: "g1"})
+	d.enqueue(dbOp{typ: opUndoLast, gameID: "g2"})
+	if len(d.ops) != 1 || len(d.spill) != 0 {
+		t.Fatalf("channel %d, spill %d; want 1 and 0", len(d.ops), len(d.spill))
+	}
+	if got := d.queued.Load(); got != 1 {
+		t.Errorf("queued = %d, want 1", got)
+	}
+	// The dropped op must not come back on the next start
+	if got := d.outbox.Pending(); got != 1 {
+		t.Errorf("outbox pending = %d, want 1", got)
+	}
+}
+
+func TestEnqueueAfterCloseIsRejected(t *testing.T) {
+	d := newTestQueue(t, overflowSpill)
+	d.closed = true
+	d.enqueue(dbOp{typ: opUndoLast, gameID: "g1"})
+	if len(d.ops) != 0 || d.queued.Load() != 0 {
+		t.Fatalf("op queued after close")
+	}
+	// Still in the outbox, so the next start replays it
+	if got := d.outbox.Pending(); got != 1 {
+		t.Errorf("outbox pending = %d, want 1", got)
+	}
+}
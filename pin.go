@@ -0,0 +1,178 @@
+package main
+
+import (
+	"context"
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/hex"
+	"errors"
+	"strings"
+	"sync"
+	"time"
+)
+
+var (
+	errPINInvalid = errors.New("pin must be 4 to 12 digits")
+	errPINLocked  = errors.New("too many failed attempts; try again later")
+)
+
+const (
+	// pinMaxFailures wrong PINs in a row lock the player out for pinLockout,
+	// doubling with every further lockout up to pinLockoutMax until the
+	// right PIN is entered.
+	pinMaxFailures = 5
+	pinLockout     = time.Minute
+	pinLockoutMax  = 24 * time.Hour
+)
+
+func validatePIN(pin string) error {
+	if len(pin) < 4 || len(pin) > 12 {
+		return errPINInvalid
+	}
+	for _, c := range pin {
+		if c < '0' || c > '9' {
+			return errPINInvalid
+		}
+	}
+	return nil
+}
+
+// hashPIN returns "salt$sha256(salt:pin)" in hex.
+func hashPIN(pin string) string {
+	salt := randomHex(8)
+	sum := sha256.Sum256([]byte(salt + ":" + pin))
+	return salt + "$" + hex.EncodeToString(sum[:])
+}
+
+func checkPIN(stored, pin string) bool {
+	salt, want, ok := strings.Cut(stored, "$")
+	if !ok {
+		return false
+	}
+	sum := sha256.Sum256([]byte(salt + ":" + pin))
+	return subtle.ConstantTimeCompare([]byte(hex.EncodeToString(sum[:])), []byte(want)) == 1
+}
+
+type pinFailures struct {
+	count    int // wrong PINs since the last lockout
+	pending  int // attempts being checked right now
+	lockouts int // lockouts since the last correct PIN
+	until    time.Time
+}
+
+// lockoutFor returns the lockout after the n-th one in a row.
+func lockoutFor(n int) time.Duration {
+	d := pinLockout
+	for i := 1; i < n && d < pinLockoutMax; i++ {
+		d *= 2
+	}
+	return min(d, pinLockoutMax)
+}
+
+// pinStore holds player PIN hashes. With the DB enabled it caches
+// players.pin_hash; otherwise it is the only copy.
+type pinStore struct {
+	mu     sync.Mutex
+	hashes map[int64]string
+	fails  map[int64]*pinFailures
+}
+
+var pins = &pinStore{hashes: map[int64]string{}, fails: map[int64]*pinFailures{}}
+
+func (ps *pinStore) hash(ctx context.Context, id int64) (string, error) {
+	ps.mu.Lock()
+	h, ok := ps.hashes[id]
+	ps.mu.Unlock()
+	if ok || db == nil {
+		return h, nil
+	}
+	h, err := db.GetPlayerPIN(ctx, id)
+	if err != nil {
+		return "", err
+	}
+	ps.mu.Lock()
+	ps.hashes[id] = h
+	ps.mu.Unlock()
+	return h, nil
+}
+
+// Set stores a new PIN for the player; an empty pin clears it.
+func (ps *pinStore) Set(ctx context.Context, id int64, pin string) error {
+	h := ""
+	if pin != "" {
+		if err := validatePIN(pin); err != nil {
+			return err
+		}
+		h = hashPIN(pin)
+	}
+	if db != nil {
+		if err := db.SetPlayerPIN(ctx, id, h); err != nil {
+			return err
+		}
+	}
+	ps.mu.Lock()
+	ps.hashes[id] = h
+	delete(ps.fails, id)
+	ps.mu.Unlock()
+	return nil
+}
+
+// Verify checks pin against the player's stored PIN, counting failures.
+// An attempt is reserved before the PIN is checked, so concurrent guesses
+// cannot get past pinMaxFailures before the lockout starts.
+func (ps *pinStore) Verify(ctx context.Context, id int64, pin string) (bool, error) {
+	ps.mu.Lock()
+	f := ps.fails[id]
+	if f == nil {
+		f = &pinFailures{}
+		ps.fails[id] = f
+	}
+	if time.Now().Before(f.until) || f.count+f.pending >= pinMaxFailures {
+		ps.mu.Unlock()
+		return false, errPINLocked
+	}
+	f.pending++
+	ps.mu.Unlock()
+
+	h, err := ps.hash(ctx, id)
+	ok := err == nil && h != "" && checkPIN(h, pin)
+	ps.mu.Lock()
+	defer ps.mu.Unlock()
+	f.pending--
+	if err != nil {
+		return false, err
+	}
+	if ok {
+		if ps.fails[id] == f && f.pending == 0 {
+			delete(ps.fails, id)
+		} else {
+			f.count, f.lockouts = 0, 0
+		}
+		return true, nil
+	}
+	f.count++
+	if f.count >= pinMaxFailures {
+		f.count = 0
+		f.lockouts++
+		f.until = time.Now().Add(lockoutFor(f.lockouts))
+	}
+	return false, nil
+}
+
+// Fingerprint identifies the current PIN without revealing it. Sessions
+// opened with a PIN carry it, so changing the PIN ends those sessions.
+func (ps *pinStore) Fingerprint(ctx context.Context, id int64) string {
+	h, err := ps.hash(ctx, id)
+	if err != nil || h == "" {
+		return ""
+	}
+	return hashToken(h)[:16]
+}
+
+// Forget drops the cached hash (e.g. after the player was anonymized).
+func (ps *pinStore) Forget(id int64) {
+	ps.mu.Lock()
+	defer ps.mu.Unlock()
+	delete(ps.hashes, id)
+	delete(ps.fails, id)
+}
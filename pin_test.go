@@ -0,0 +1,74 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"testing"
+	"time"
+)
+
+func newTestPINStore(id int64, pin string) *pinStore {
+	return &pinStore{hashes: map[int64]string{id: hashPIN(pin)}, fails: map[int64]*pinFailures{}}
+}
+
+func TestVerifyConcurrentGuessesStopAtLimit(t *testing.T) {
+	ps := newTestPINStore(1, "1234")
+	var mu sync.Mutex
+	checked, locked := 0, 0
+	var wg sync.WaitGroup
+	for i := 0; i < 50; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			_, err := ps.Verify(context.Background(), 1, "0000")
+			mu.Lock()
+			defer mu.Unlock()
+			if errors.Is(err, errPINLocked) {
+				locked++
+			} else {
+				checked++
+			}
+		}()
+	}
+	wg.Wait()
+	if checked != pinMaxFailures || locked != 50-pinMaxFailures {
+		t.Errorf("%d guesses checked, %d locked out; want %d checked", checked, locked, pinMaxFailures)
+	}
+}
+
+func TestVerifyLockoutEscalates(t *testing.T) {
+	ps := newTestPINStore(1, "1234")
+	ctx := context.Background()
+	fail := func() {
+		t.Helper()
+		for i := 0; i < pinMaxFailures; i++ {
+			if ok, err := ps.Verify(ctx, 1, "0000"); ok || err != nil {
+				t.Fatalf("attempt %d: %v, %v", i+1, ok, err)
+			}
+		}
+		if _, err := ps.Verify(ctx, 1, "1234"); !errors.Is(err, errPINLocked) {
+			t.Fatalf("right PIN during lockout: %v, want locked", err)
+		}
+	}
+	for n := 1; n <= 3; n++ {
+		fail()
+		f := ps.fails[1]
+		if left := time.Until(f.until); left <= lockoutFor(n)-time.Second || left > lockoutFor(n) {
+			t.Errorf("lockout %d lasts %v, want %v", n, left, lockoutFor(n))
+		}
+		f.until = time.Time{} // let it expire
+	}
+	if ok, err := ps.Verify(ctx, 1, "1234"); !ok || err != nil {
+		t.Fatalf("right PIN after lockout: %v, %v", ok, err)
+	}
+	if _, ok := ps.fails[1]; ok {
+		t.Error("failures kept after the right PIN")
+	}
+	if got := lockoutFor(100); got != pinLockoutMax {
+		t.Errorf("lockoutFor(100) = %v, want %v", got, pinLockoutMax)
+	}
+	if lockoutFor(2) != 2*pinLockout || lockoutFor(3) != 4*pinLockout {
+		t.Errorf("lockouts %v, %v do not double", lockoutFor(2), lockoutFor(3))
+	}
+}
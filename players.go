@@ -0,0 +1,386 @@
+package main
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+	"unicode"
+	"unicode/utf8"
+)
+
+var (
+	errPlayerNotFound    = errors.New("player not found")
+	errPlayerNameInvalid = errors.New("invalid player name")
+	// All-digit names would be read as player IDs
+	errPlayerNameNumeric = fmt.Errorf("%w: a name cannot be only digits", errPlayerNameInvalid)
+	errPlayerNameTaken   = errors.New("player name already taken")
+	errPlayerInactive    = errors.New("player is deactivated")
+)
+
+// maxPlayerNameLen matches players.name VARCHAR(100).
+const maxPlayerNameLen = 100
+
+// playerLookupTimeout bounds the DB round trip for a reference the
+// directory has not seen yet, so floor operations fail fast when MySQL is
+// down instead of waiting for the TCP timeout.
+const playerLookupTimeout = 2 * time.Second
+
+// normalizePlayerName trims the name and collapses inner whitespace runs
+// to a single space, so "alice " and " alice" are the same player.
+func normalizePlayerName(s string) string {
+	return strings.Join(strings.Fields(s), " ")
+}
+
+// playerNameKey is the case-insensitive lookup key for a name; it mirrors
+// the players table collation ("Alice" == "alice").
+func playerNameKey(s string) string {
+	return strings.ToLower(normalizePlayerName(s))
+}
+
+func validatePlayerName(name string) error {
+	if name == "" || utf8.RuneCountInString(name) > maxPlayerNameLen {
+		return errPlayerNameInvalid
+	}
+	for _, r := range name {
+		if unicode.IsControl(r) {
+			return errPlayerNameInvalid
+		}
+	}
+	if strings.Trim(name, "0123456789") == "" {
+		return errPlayerNameNumeric
+	}
+	return nil
+}
+
+// playerRefID parses a stable player ID reference.
+func playerRefID(ref string) (int64, bool) {
+	id, err := strconv.ParseInt(strings.TrimSpace(ref), 10, 64)
+	if err != nil || id <= 0 {
+		return 0, false
+	}
+	return id, true
+}
+
+func formatPlayerID(id int64) string { return strconv.FormatInt(id, 10) }
+
+// playerDirectory resolves player references (stable ID or name) to IDs and
+// caches display names and active flags. It is backed by the players table
+// when the DB is enabled, which is only asked about references not cached
+// yet, so known players keep resolving through a MySQL outage. Without
+// the DB, IDs are allocated in memory for the process lifetime.
+type playerDirectory struct {
+	mu       sync.RWMutex
+	names    map[int64]string
+	byKey    map[string]int64
+	merged   map[int64]int64
+	inactive map[int64]bool
+	nextID   int64
+}
+
+var directory = newPlayerDirectory()
+
+func newPlayerDirectory() *playerDirectory {
+	return &playerDirectory{
+		names:    map[int64]string{},
+		byKey:    map[string]int64{},
+		merged:   map[int64]int64{},
+		inactive: map[int64]bool{},
+	}
+}
+
+// remember caches a player's name and active flag.
+func (pd *playerDirectory) remember(p Player) {
+	pd.mu.Lock()
+	defer pd.mu.Unlock()
+	pd.rememberLocked(p)
+}
+
+func (pd *playerDirectory) rememberLocked(p Player) {
+	if old, ok := pd.names[p.ID]; ok && pd.byKey[playerNameKey(old)] == p.ID {
+		delete(pd.byKey, playerNameKey(old))
+	}
+	pd.names[p.ID] = p.Name
+	pd.byKey[playerNameKey(p.Name)] = p.ID
+	if p.Active {
+		delete(pd.inactive, p.ID)
+	} else {
+		pd.inactive[p.ID] = true
+	}
+}
+
+// load fills the cache from the players table, so players resolve without
+// a DB round trip from the start.
+func (pd *playerDirectory) load(ctx context.Context) error {
+	if db == nil {
+		return nil
+	}
+	rows, err := db.sql.QueryContext(ctx, "SELECT id, name, active, merged_into FROM players")
+	if err != nil {
+		return err
+	}
+	defer rows.Close()
+	pd.mu.Lock()
+	defer pd.mu.Unlock()
+	for rows.Next() {
+		var p Player
+		var merged sql.NullInt64
+		if err := rows.Scan(&p.ID, &p.Name, &p.Active, &merged); err != nil {
+			return err
+		}
+		if merged.Valid {
+			// The name keeps resolving to the surviving player
+			pd.merged[p.ID] = merged.Int64
+			if _, ok := pd.byKey[playerNameKey(p.Name)]; !ok {
+				pd.byKey[playerNameKey(p.Name)] = p.ID
+			}
+			continue
+		}
+		pd.rememberLocked(p)
+	}
+	return rows.Err()
+}
+
+// cached returns the cached player with the given (canonical) ID.
+func (pd *playerDirectory) cached(id int64) (Player, bool) {
+	pd.mu.RLock()
+	defer pd.mu.RUnlock()
+	name, ok := pd.names[id]
+	if !ok {
+		return Player{}, false
+	}
+	return Player{ID: id, Name: name, Active: !pd.inactive[id]}, true
+}
+
+// canonical follows merges to the surviving ID.
+func (pd *playerDirectory) canonical(id int64) int64 {
+	pd.mu.RLock()
+	defer pd.mu.RUnlock()
+	for i := 0; i < 8; i++ {
+		into, ok := pd.merged[id]
+		if !ok {
+			break
+		}
+		id = into
+	}
+	return id
+}
+
+// Resolve maps a reference to a player, creating the player when the
+// reference is a name not seen before. A reference made of digits is always
+// an ID; names cannot be all digits, so the two never collide.
+func (pd *playerDirectory) Resolve(ctx context.Context, ref string) (Player, error) {
+	if id, ok := playerRefID(ref); ok {
+		return pd.Get(ctx, id)
+	}
+	p, _, err := pd.Ensure(ctx, ref)
+	return p, err
+}
+
+// Find maps a reference to an existing player without creating one.
+func (pd *playerDirectory) Find(ctx context.Context, ref string) (Player, error) {
+	if id, ok := playerRefID(ref); ok {
+		p, err := pd.Get(ctx, id)
+		if !errors.Is(err, errPlayerNotFound) {
+			return p, err
+		}
+	}
+	name := normalizePlayerName(ref)
+	if name == "" {
+		return Player{}, errPlayerNotFound
+	}
+	pd.mu.RLock()
+	id, ok := pd.byKey[playerNameKey(name)]
+	pd.mu.RUnlock()
+	if ok {
+		return pd.Get(ctx, id)
+	}
+	if db == nil {
+		return Player{}, errPlayerNotFound
+	}
+	ctx, cancel := context.WithTimeout(ctx, playerLookupTimeout)
+	defer cancel()
+	p, err := db.GetPlayerByName(ctx, name)
+	if err != nil {
+		return Player{}, err
+	}
+	pd.remember(p)
+	return p, nil
+}
+
+// Ensure returns the player with the given name, creating it if needed.
+// created reports whether a new record was made.
+func (pd *playerDirectory) Ensure(ctx context.Context, rawName string) (p Player, created bool, err error) {
+	name := normalizePlayerName(rawName)
+	if err := validatePlayerName(name); err != nil {
+		return Player{}, false, err
+	}
+	key := playerNameKey(name)
+	pd.mu.RLock()
+	id, known := pd.byKey[key]
+	pd.mu.RUnlock()
+	if known {
+		if p, ok := pd.cached(pd.canonical(id)); ok {
+			// Only last_seen changes; the write queue rides out outages
+			db.EnqueueEnsurePlayers([]string{p.Name})
+			return p, false, nil
+		}
+	}
+	if db != nil {
+		ctx, cancel := context.WithTimeout(ctx, playerLookupTimeout)
+		defer cancel()
+		p, created, err = db.EnsurePlayer(ctx, name)
+		if err != nil {
+			return Player{}, false, err
+		}
+		pd.remember(p)
+		return p, created, nil
+	}
+	pd.mu.Lock()
+	defer pd.mu.Unlock()
+	if _, ok := pd.byKey[key]; ok {
+		// Created concurrently
+		id := pd.byKey[key]
+		return Player{ID: id, Name: pd.names[id], Active: !pd.inactive[id]}, false, nil
+	}
+	pd.nextID++
+	p = Player{ID: pd.nextID, Name: name, Active: true}
+	pd.names[p.ID] = name
+	pd.byKey[key] = p.ID
+	return p, true, nil
+}
+
+// Get returns the player with the given ID (following merges): ID, name
+// and active flag, from the cache when possible. Use Record for the full
+// row.
+func (pd *playerDirectory) Get(ctx context.Context, id int64) (Player, error) {
+	id = pd.canonical(id)
+	if p, ok := pd.cached(id); ok {
+		return p, nil
+	}
+	if db == nil {
+		return Player{}, errPlayerNotFound
+	}
+	ctx, cancel := context.WithTimeout(ctx, playerLookupTimeout)
+	defer cancel()
+	p, err := db.GetPlayer(ctx, id)
+	if err != nil {
+		return Player{}, err
+	}
+	pd.remember(p)
+	return p, nil
+}
+
+// Record returns the player's full record (counters and profile), read
+// from the DB when enabled.
+func (pd *playerDirectory) Record(ctx context.Context, id int64) (Player, error) {
+	id = pd.canonical(id)
+	if db == nil {
+		return pd.Get(ctx, id)
+	}
+	p, err := db.GetPlayer(ctx, id)
+	if err != nil {
+		return Player{}, err
+	}
+	pd.remember(p)
+	return p, nil
+}
+
+// Name returns the cached display name for a stable ID string, or the ID
+// itself when unknown.
+func (pd *playerDirectory) Name(id string) string {
+	n, ok := playerRefID(id)
+	if !ok {
+		return id
+	}
+	pd.mu.RLock()
+	defer pd.mu.RUnlock()
+	if name, ok := pd.names[n]; ok {
+		return name
+	}
+	return id
+}
+
+// Rename changes a player's display name. Game state is keyed by ID and
+// needs no update.
+func (pd *playerDirectory) Rename(ctx context.Context, id int64, rawName string) (Player, error) {
+	name := normalizePlayerName(rawName)
+	if err := validatePlayerName(name); err != nil {
+		return Player{}, err
+	}
+	if db != nil {
+		p, err := db.RenamePlayer(ctx, id, name)
+		if err != nil {
+			return Player{}, err
+		}
+		pd.remember(p)
+		return p, nil
+	}
+	pd.mu.Lock()
+	defer pd.mu.Unlock()
+	old, ok := pd.names[id]
+	if !ok {
+		return Player{}, errPlayerNotFound
+	}
+	key := playerNameKey(name)
+	if other, ok := pd.byKey[key]; ok && other != id {
+		return Player{}, errPlayerNameTaken
+	}
+	delete(pd.byKey, playerNameKey(old))
+	pd.names[id] = name
+	pd.byKey[key] = id
+	return Player{ID: id, Name: name, Active: !pd.inactive[id]}, nil
+}
+
+// Merge folds player from into player into: events and counters move over
+// and from's name keeps resolving to into.
+func (pd *playerDirectory) Merge(ctx context.Context, from, into int64) (Player, error) {
+	if db != nil {
+		p, err := db.MergePlayers(ctx, from, into)
+		if err != nil {
+			return Player{}, err
+		}
+		pd.mu.Lock()
+		pd.merged[from] = into
+		for k, id := range pd.byKey {
+			if id == from {
+				pd.byKey[k] = into
+			}
+		}
+		pd.mu.Unlock()
+		pd.remember(p)
+		return p, nil
+	}
+	pd.mu.Lock()
+	defer pd.mu.Unlock()
+	if _, ok := pd.names[from]; !ok {
+		return Player{}, errPlayerNotFound
+	}
+	name, ok := pd.names[into]
+	if !ok {
+		return Player{}, errPlayerNotFound
+	}
+	pd.merged[from] = into
+	for k, id := range pd.byKey {
+		if id == from {
+			pd.byKey[k] = into
+		}
+	}
+	return Player{ID: into, Name: name, Active: !pd.inactive[into]}, nil
+}
+
+// playerNames maps each stable ID in ids to its display name.
+func playerNames(ids ...string) map[string]string {
+	out := make(map[string]string, len(ids))
+	for _, id := range ids {
+		if id == "" {
+			continue
+		}
+		out[id] = directory.Name(id)
+	}
+	return out
+}
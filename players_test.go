@@ -0,0 +1,84 @@
+package main
+
+import (
+	"context"
+	"database/sql/driver"
+	"errors"
+	"strings"
+	"testing"
+)
+
+func TestValidatePlayerName(t *testing.T) {
+	tests := []struct {
+		name string
+		err  error
+	}{
+		{"Alice", nil},
+		{"R2D2", nil},
+		{"7 of Nine", nil},
+		{"", errPlayerNameInvalid},
+		{"7", errPlayerNameNumeric},
+		{"0042", errPlayerNameNumeric},
+		{"tab\there", errPlayerNameInvalid},
+		{strings.Repeat("x", maxPlayerNameLen+1), errPlayerNameInvalid},
+	}
+	for _, tt := range tests {
+		if err := validatePlayerName(tt.name); !errors.Is(err, tt.err) || (tt.err == nil) != (err == nil) {
+			t.Errorf("validatePlayerName(%q) = %v, want %v", tt.name, err, tt.err)
+		}
+	}
+}
+
+func TestResolveDigitsAreIDs(t *testing.T) {
+	pd := newPlayerDirectory()
+	ctx := context.Background()
+	alice, err := pd.Resolve(ctx, " alice ")
+	if err != nil {
+		t.Fatal(err)
+	}
+	byID, err := pd.Resolve(ctx, formatPlayerID(alice.ID))
+	if err != nil || byID.ID != alice.ID {
+		t.Fatalf("Resolve(%d) = %+v, %v", alice.ID, byID, err)
+	}
+	// An unknown ID is not taken as a new player's name
+	if _, err := pd.Resolve(ctx, "99"); !errors.Is(err, errPlayerNotFound) {
+		t.Errorf("Resolve(99) error = %v, want not found", err)
+	}
+	if _, _, err := pd.Ensure(ctx, "99"); !errors.Is(err, errPlayerNameNumeric) {
+		t.Errorf("Ensure(99) error = %v, want a numeric-name error", err)
+	}
+}
+
+func TestDirectoryServesKnownPlayersWithoutDB(t *testing.T) {
+	down := errors.New("mysql is down")
+	d, f := newFakeDB(t, func(string, []driver.Value) fakeResult { return fakeResult{Err: down} })
+	d.ops = make(chan dbOp, 8)
+	d.spillWake = make(chan struct{}, 1)
+	old := db
+	db = d
+	t.Cleanup(func() { db = old })
+
+	pd := newPlayerDirectory()
+	pd.remember(Player{ID: 5, Name: "Alice", Active: true})
+	pd.remember(Player{ID: 6, Name: "Bob"})
+	ctx := context.Background()
+	for _, ref := range []string{"5", "alice"} {
+		p, err := pd.Resolve(ctx, ref)
+		if err != nil || p.ID != 5 || !p.Active {
+			t.Errorf("Resolve(%q) = %+v, %v", ref, p, err)
+		}
+	}
+	if p, err := pd.Find(ctx, "bob"); err != nil || p.Active {
+		t.Errorf("Find(bob) = %+v, %v; want the cached inactive player", p, err)
+	}
+	if q := f.Queries(); len(q) != 0 {
+		t.Errorf("known players hit the DB: %v", q)
+	}
+	// Seeing Alice again is queued as a last_seen update
+	if len(d.ops) != 1 || (<-d.ops).typ != opEnsurePlayers {
+		t.Error("last_seen update not queued")
+	}
+	if _, err := pd.Resolve(ctx, "Carol"); !errors.Is(err, down) {
+		t.Errorf("Resolve(Carol) error = %v, want the DB error", err)
+	}
+}
@@ -0,0 +1,190 @@
+package main
+
+import (
+	"math/rand/v2"
+	"sort"
+	"time"
+)
+
+// QueueEntry is the metadata kept for a waiting player. The order of the
+// waiting queue itself is the RingQueue; entries never reorder it except
+// when a priority is applied.
+type QueueEntry struct {
+	PlayerID string `json:"player_id"`
+	// 1-based place in the queue (responses only)
+	Position int       `json:"position"`
+	JoinedAt time.Time `json:"joined_at"`
+	// Entries with a higher priority are queued ahead of lower ones
+	Priority int `json:"priority,omitempty"`
+	// Passed over once by the next rotation, keeping their place
+	SkipNext bool `json:"skip_next,omitempty"`
+	// Passed over by rotations until then, keeping their place
+	ReservedUntil *time.Time `json:"reserved_until,omitempty"`
+	// Ready check for the player up next: confirm by ReadyBy
+	ReadyBy *time.Time `json:"ready_by,omitempty"`
+	ReadyAt *time.Time `json:"ready_at,omitempty"`
+	// Consecutive missed ready checks
+	Missed int `json:"missed_ready_checks,omitempty"`
+	// Predicted turn (responses only): comes on at this goal, in about this long
+	GoalsUntilUp         int `json:"goals_until_up"`
+	EstimatedWaitSeconds int `json:"estimated_wait_seconds"`
+}
+
+// eligible reports whether rotation may call the player up now.
+func (e QueueEntry) eligible(now time.Time) bool {
+	return !e.SkipNext && (e.ReservedUntil == nil || !now.Before(*e.ReservedUntil))
+}
+
+// enqueueWaiting adds id to the waiting queue behind every entry with an
+// equal or higher priority (the tail, unless the player has a bump).
+func (gs *GameState) enqueueWaiting(id string, now time.Time) {
+	if gs.QueueMeta == nil {
+		gs.QueueMeta = map[string]QueueEntry{}
+	}
+	p := gs.Priorities[id]
+	gs.Waiting.InsertAt(gs.priorityIndex(p), id)
+	gs.QueueMeta[id] = QueueEntry{PlayerID: id, JoinedAt: now, Priority: p}
+}
+
+// priorityIndex is the queue index right after the last entry whose
+// priority is at least p.
+func (gs *GameState) priorityIndex(p int) int {
+	waiting := gs.Waiting.Snapshot()
+	if p <= 0 {
+		return len(waiting)
+	}
+	i := 0
+	for j, id := range waiting {
+		if gs.QueueMeta[id].Priority >= p {
+			i = j + 1
+		}
+	}
+	return i
+}
+
+// removeWaiting takes id out of the waiting queue.
+func (gs *GameState) removeWaiting(id string) bool {
+	if !gs.Waiting.RemoveValue(id) {
+		return false
+	}
+	delete(gs.QueueMeta, id)
+	return true
+}
+
+// nextWaiting dequeues the first player rotation may call up. Players who
+// stepped aside are passed over (a skip-next flag is used up in the
+// process); if nobody is eligible the front of the queue plays anyway.
+func (gs *GameState) nextWaiting(now time.Time) (string, bool) {
+	waiting := gs.Waiting.Snapshot()
+	if len(waiting) == 0 {
+		return "", false
+	}
+	next := ""
+	for _, id := range waiting {
+		e := gs.QueueMeta[id]
+		if e.eligible(now) {
+			next = id
+			break
+		}
+		if e.SkipNext {
+			e.SkipNext = false
+			gs.QueueMeta[id] = e
+		}
+	}
+	if next == "" {
+		next = waiting[0]
+	}
+	gs.removeWaiting(next)
+	return next, true
+}
+
+// upNext is the waiting player the next rotation will call up, or "" when
+// everyone has stepped aside.
+func (gs *GameState) upNext(now time.Time) string {
+	for _, id := range gs.Waiting.Snapshot() {
+		if gs.QueueMeta[id].eligible(now) {
+			return id
+		}
+	}
+	return ""
+}
+
+// waitingPosition is the 1-based place of id in the queue, or 0.
+func (gs *GameState) waitingPosition(id string) int {
+	for i, v := range gs.Waiting.Snapshot() {
+		if v == id {
+			return i + 1
+		}
+	}
+	return 0
+}
+
+// moveWaiting moves id to a 1-based position in the waiting queue.
+func (gs *GameState) moveWaiting(id string, position int) bool {
+	if !gs.Waiting.RemoveValue(id) {
+		return false
+	}
+	gs.Waiting.InsertAt(position-1, id)
+	return true
+}
+
+// reorderWaiting replaces the queue order; ids must be a permutation of
+// the current waiting players.
+func (gs *GameState) reorderWaiting(ids []string) {
+	q := NewRingQueue(max(8, len(ids)))
+	for _, id := range ids {
+		q.Enqueue(id)
+	}
+	gs.Waiting = q
+}
+
+// shuffleWaiting randomizes the queue order. Priority bumps still apply:
+// higher-priority players stay ahead of lower ones.
+func (gs *GameState) shuffleWaiting() {
+	ids := gs.Waiting.Snapshot()
+	rand.Shuffle(len(ids), func(i, j int) { ids[i], ids[j] = ids[j], ids[i] })
+	sort.SliceStable(ids, func(i, j int) bool { return gs.QueueMeta[ids[i]].Priority > gs.QueueMeta[ids[j]].Priority })
+	gs.reorderWaiting(ids)
+}
+
+// setPriority records a priority bump for the player in this game (kept
+// when they rejoin after being benched) and requeues them if waiting.
+func (gs *GameState) setPriority(id string, p int) {
+	if gs.Priorities == nil {
+		gs.Priorities = map[string]int{}
+	}
+	if p == 0 {
+		delete(gs.Priorities, id)
+	} else {
+		gs.Priorities[id] = p
+	}
+	e, ok := gs.QueueMeta[id]
+	if !ok || !gs.Waiting.RemoveValue(id) {
+		return
+	}
+	e.Priority = p
+	gs.Waiting.InsertAt(gs.priorityIndex(p), id)
+	gs.QueueMeta[id] = e
+}
+
+// queueEntries lists the waiting players in order with their metadata and
+// wait estimates. Expired reservations are left out. Caller holds gamesMu.
+func (gs *GameState) queueEntries(now time.Time) []QueueEntry {
+	waiting := gs.Waiting.Snapshot()
+	est := gs.estimateWaits(now)
+	out := make([]QueueEntry, 0, len(waiting))
+	for i, id := range waiting {
+		e, ok := gs.QueueMeta[id]
+		if !ok {
+			e = QueueEntry{PlayerID: id}
+		}
+		e.Position = i + 1
+		e.GoalsUntilUp = est[id].Goals
+		e.EstimatedWaitSeconds = int(est[id].Wait.Round(time.Second) / time.Second)
+		if e.ReservedUntil != nil && !now.Before(*e.ReservedUntil) {
+			e.ReservedUntil = nil
+		}
+		out = append(out, e)
+	}
+	return out
+}
@@ -0,0 +1,164 @@
+package main
+
+import (
+	"log"
+	"math"
+	"net"
+	"net/http"
+	"os"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// bucket is a token bucket refilled continuously at the limiter's rate.
+type bucket struct {
+	tokens float64
+	last   time.Time
+}
+
+// rateLimiter keeps one token bucket per key (client IP or credential).
+type rateLimiter struct {
+	mu      sync.Mutex
+	perSec  float64
+	burst   float64
+	buckets map[string]*bucket
+}
+
+// newRateLimiter allows perMinute requests per key on average, with bursts
+// of up to burst requests. Idle buckets are swept periodically.
+func newRateLimiter(perMinute, burst int) *rateLimiter {
+	rl := &rateLimiter{
+		perSec:  float64(perMinute) / 60,
+		burst:   float64(burst),
+		buckets: map[string]*bucket{},
+	}
+	go func() {
+		for range time.Tick(time.Minute) {
+			rl.sweep()
+		}
+	}()
+	return rl
+}
+
+// allow takes a token for key. When none is left it reports how long until
+// the next one is available.
+func (rl *rateLimiter) allow(key string) (bool, time.Duration) {
+	now := time.Now()
+	rl.mu.Lock()
+	defer rl.mu.Unlock()
+	b, ok := rl.buckets[key]
+	if !ok {
+		b = &bucket{tokens: rl.burst, last: now}
+		rl.buckets[key] = b
+	}
+	b.tokens = math.Min(rl.burst, b.tokens+now.Sub(b.last).Seconds()*rl.perSec)
+	b.last = now
+	if b.tokens >= 1 {
+		b.tokens--
+		return true, 0
+	}
+	return false, time.Duration((1 - b.tokens) / rl.perSec * float64(time.Second))
+}
+
+// sweep drops buckets that have refilled completely.
+func (rl *rateLimiter) sweep() {
+	now := time.Now()
+	rl.mu.Lock()
+	defer rl.mu.Unlock()
+	for k, b := range rl.buckets {
+		if b.tokens+now.Sub(b.last).Seconds()*rl.perSec >= rl.burst {
+			delete(rl.buckets, k)
+		}
+	}
+}
+
+// limitConfig is read once at startup by initLimits.
+var limitConfig struct {
+	byIP            *rateLimiter // nil when disabled
+	byCaller        *rateLimiter
+	trustProxy      bool
+	maxBodyBytes    int64
+	minGoalInterval time.Duration
+}
+
+// initLimits reads rate and size limits from the environment.
+func initLimits() {
+	limitConfig.maxBodyBytes = int64(envInt("KOTT_MAX_BODY_BYTES", 64<<10))
+	limitConfig.minGoalInterval = envDuration("KOTT_MIN_GOAL_INTERVAL", 3*time.Second)
+	limitConfig.trustProxy = strings.EqualFold(strings.TrimSpace(os.Getenv("KOTT_TRUST_PROXY")), "true")
+	if strings.EqualFold(strings.TrimSpace(os.Getenv("KOTT_RATE_LIMIT")), "off") {
+		log.Printf("[limit] KOTT_RATE_LIMIT=off; requests are not throttled")
+		return
+	}
+	limitConfig.byIP = newRateLimiter(envInt("KOTT_RATE_IP", 300), envInt("KOTT_RATE_IP_BURST", 60))
+	limitConfig.byCaller = newRateLimiter(envInt("KOTT_RATE_TOKEN", 600), envInt("KOTT_RATE_TOKEN_BURST", 120))
+}
+
+// clientIP is the peer address, or the first X-Forwarded-For hop when
+// running behind a trusted proxy.
+func clientIP(r *http.Request) string {
+	if limitConfig.trustProxy {
+		if xff := r.Header.Get("X-Forwarded-For"); xff != "" {
+			first, _, _ := strings.Cut(xff, ",")
+			if ip := strings.TrimSpace(first); ip != "" {
+				return ip
+			}
+		}
+	}
+	host, _, err := net.SplitHostPort(r.RemoteAddr)
+	if err != nil {
+		return r.RemoteAddr
+	}
+	return host
+}
+
+// callerKey identifies the credential behind a request, or "" for anonymous callers.
+func callerKey(id identity) string {
+	switch {
+	case id.TokenID != "":
+		return "token:" + id.TokenID
+	case id.PlayerID != "":
+		return "player:" + id.PlayerID
+	case id.Via == "bootstrap" || id.Via == "session":
+		return "bootstrap"
+	}
+	return ""
+}
+
+func writeRetryAfter(w http.ResponseWriter, wait time.Duration) {
+	w.Header().Set("Retry-After", strconv.Itoa(int(math.Ceil(wait.Seconds()))))
+}
+
+// limitByIP throttles every request by client address. It runs before
+// authentication so token guessing is throttled too.
+func limitByIP(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if limitConfig.byIP != nil {
+			if ok, wait := limitConfig.byIP.allow(clientIP(r)); !ok {
+				writeRetryAfter(w, wait)
+				writeError(w, http.StatusTooManyRequests, "rate limit exceeded")
+				return
+			}
+		}
+		next.ServeHTTP(w, r)
+	})
+}
+
+// limitByCaller throttles authenticated requests per token (or player
+// session), however many addresses they come from.
+func limitByCaller(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if limitConfig.byCaller != nil {
+			if key := callerKey(identityFrom(r)); key != "" {
+				if ok, wait := limitConfig.byCaller.allow(key); !ok {
+					writeRetryAfter(w, wait)
+					writeError(w, http.StatusTooManyRequests, "rate limit exceeded")
+					return
+				}
+			}
+		}
+		next.ServeHTTP(w, r)
+	})
+}
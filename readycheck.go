@@ -0,0 +1,115 @@
+package main
+
+import (
+	"context"
+	"log"
+	"os"
+	"strings"
+	"time"
+)
+
+// readyConfig is read once at startup by initReadyChecks. Ready checks are
+// off unless KOTT_READY_TIMEOUT is set.
+var readyConfig struct {
+	timeout   time.Duration
+	remove    bool // remove on a missed check instead of moving back
+	moveBack  int
+	maxMisses int
+}
+
+func initReadyChecks() {
+	readyConfig.timeout = envDuration("KOTT_READY_TIMEOUT", 0)
+	readyConfig.remove = strings.EqualFold(strings.TrimSpace(os.Getenv("KOTT_READY_ACTION")), "remove")
+	readyConfig.moveBack = envInt("KOTT_READY_MOVE_BACK", 1)
+	readyConfig.maxMisses = envInt("KOTT_READY_MAX_MISSES", 3)
+}
+
+// runReadyChecks advances ready checks once a second until ctx is done.
+func runReadyChecks(ctx context.Context) {
+	if readyConfig.timeout <= 0 {
+		return
+	}
+	t := time.NewTicker(time.Second)
+	defer t.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case now := <-t.C:
+			for _, ev := range sweepReadyChecks(now) {
+				events.Publish(ev)
+			}
+		}
+	}
+}
+
+func sweepReadyChecks(now time.Time) []gameEvent {
+	gamesMu.Lock()
+	defer gamesMu.Unlock()
+	var evs []gameEvent
+	for id, gs := range games {
+		evs = append(evs, gs.updateReadyCheck(id, now)...)
+	}
+	return evs
+}
+
+// updateReadyCheck starts a check for the player up next, and handles a
+// missed one: the player is moved back (or removed once they missed
+// KOTT_READY_MAX_MISSES checks, or always with KOTT_READY_ACTION=remove).
+// Only the player up next carries check state. Caller holds gamesMu.
+func (gs *GameState) updateReadyCheck(gameID string, now time.Time) []gameEvent {
+	up := gs.upNext(now)
+	for id, e := range gs.QueueMeta {
+		if id != up && (e.ReadyBy != nil || e.ReadyAt != nil) {
+			e.ReadyBy, e.ReadyAt = nil, nil
+			gs.QueueMeta[id] = e
+		}
+	}
+	if up == "" {
+		return nil
+	}
+	e := gs.QueueMeta[up]
+	if e.ReadyAt != nil {
+		return nil
+	}
+	if e.ReadyBy == nil {
+		by := now.Add(readyConfig.timeout)
+		e.ReadyBy = &by
+		gs.QueueMeta[up] = e
+		return []gameEvent{{Type: "ready_check", GameID: gameID, PlayerID: up, At: now, Data: map[string]any{"ready_by": by}}}
+	}
+	if now.Before(*e.ReadyBy) {
+		return nil
+	}
+
+	// Missed: snapshot so a referee can undo the decision
+	pushHistory(gs)
+	e.ReadyBy = nil
+	e.Missed++
+	ev := gameEvent{Type: "ready_timeout", GameID: gameID, PlayerID: up, At: now, Data: map[string]any{"missed": e.Missed}}
+	if readyConfig.remove || e.Missed >= readyConfig.maxMisses {
+		gs.removeWaiting(up)
+		ev.Data["action"] = "removed"
+	} else {
+		gs.QueueMeta[up] = e
+		pos := gs.waitingPosition(up) + readyConfig.moveBack
+		gs.moveWaiting(up, pos)
+		ev.Data["action"] = "moved_back"
+		ev.Data["position"] = gs.waitingPosition(up)
+	}
+	log.Printf("[ready] game %s: %s (%s) missed ready check %d; %s", gameID, up, directory.Name(up), e.Missed, ev.Data["action"])
+	return []gameEvent{ev}
+}
+
+// confirmReady records that the player up next is at the table.
+func (gs *GameState) confirmReady(id string, now time.Time) bool {
+	e, ok := gs.QueueMeta[id]
+	if !ok || e.ReadyBy == nil || e.ReadyAt != nil {
+		return false
+	}
+	e.ReadyAt = &now
+	e.ReadyBy = nil
+	e.Missed = 0
+	gs.QueueMeta[id] = e
+	return true
+}
@@ -79,3 +79,26 @@ func (q *RingQueue) RemoveValue(v string) bool {
 	}
 	return removed
 }
+
+// InsertAt inserts v so that it ends up at index i (0 = front), keeping the
+// order of the other elements. i is clamped to [0, Len()].
+func (q *RingQueue) InsertAt(i int, v string) {
+	items := q.Snapshot()
+	if i < 0 {
+		i = 0
+	}
+	if i > len(items) {
+		i = len(items)
+	}
+	q.data = make([]string, max(len(q.data), len(items)+1))
+	q.head, q.tail, q.size = 0, 0, 0
+	for j, cur := range items {
+		if j == i {
+			q.Enqueue(v)
+		}
+		q.Enqueue(cur)
+	}
+	if i == len(items) {
+		q.Enqueue(v)
+	}
+}
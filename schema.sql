@@ -12,8 +12,21 @@ CREATE TABLE IF NOT EXISTS players (
   wins INT UNSIGNED NOT NULL DEFAULT 0,
   survives INT UNSIGNED NOT NULL DEFAULT 0,
   full_rotation INT UNSIGNED NOT NULL DEFAULT 0,
+  -- Optional profile
+  avatar_url VARCHAR(255) NULL,
+  nickname VARCHAR(50) NULL,
+  preferred_role ENUM('forward','goalkeeper','any') NULL,
+  -- Deactivated players are hidden; anonymized ones had their personal data erased
+  active TINYINT(1) NOT NULL DEFAULT 1,
+  deactivated_at DATETIME NULL,
+  anonymized_at DATETIME NULL,
+  -- Salted SHA-256 of the player's self-service PIN
+  pin_hash VARCHAR(90) NULL,
+  -- Set when this player was merged into another; the row keeps its name as an alias
+  merged_into INT UNSIGNED NULL,
   PRIMARY KEY (id),
   UNIQUE KEY ux_players_name (name),
+  KEY ix_players_merged_into (merged_into),
   KEY ix_players_wins (wins),
   KEY ix_players_survives (survives),
   KEY ix_players_last_seen (last_seen)
@@ -30,6 +43,8 @@ CREATE TABLE IF NOT EXISTS games (
 CREATE TABLE IF NOT EXISTS goal_events (
   id BIGINT UNSIGNED NOT NULL AUTO_INCREMENT,
   game_id CHAR(24) NOT NULL,
+  -- Per-game mutation sequence assigned by the server (NULL for legacy rows)
+  seq BIGINT UNSIGNED NULL,
   scoring_team ENUM('red','blue') NOT NULL,
   red_forward_id INT UNSIGNED NOT NULL,
   red_goalkeeper_id INT UNSIGNED NOT NULL,
@@ -42,6 +57,7 @@ CREATE TABLE IF NOT EXISTS goal_events (
   created_at DATETIME NOT NULL DEFAULT CURRENT_TIMESTAMP,
   PRIMARY KEY (id),
   KEY ix_goal_events_game (game_id, created_at),
+  UNIQUE KEY ux_goal_events_game_seq (game_id, seq),
   CONSTRAINT fk_ge_game FOREIGN KEY (game_id) REFERENCES games(id)
     ON DELETE CASCADE ON UPDATE RESTRICT,
   CONSTRAINT fk_ge_red_f FOREIGN KEY (red_forward_id) REFERENCES players(id),
@@ -53,6 +69,127 @@ CREATE TABLE IF NOT EXISTS goal_events (
   CONSTRAINT fk_ge_newf FOREIGN KEY (new_forward_id) REFERENCES players(id)
 ) ENGINE=InnoDB DEFAULT CHARSET=utf8mb4 COLLATE=utf8mb4_unicode_ci;
 
+-- Mid-game lineup changes: a team's forward and goalkeeper swapped, or a
+-- waiting player substituted in. forward/goalkeeper are the team after the change.
+CREATE TABLE IF NOT EXISTS lineup_events (
+  id BIGINT UNSIGNED NOT NULL AUTO_INCREMENT,
+  game_id CHAR(24) NOT NULL,
+  seq BIGINT UNSIGNED NULL,
+  kind ENUM('swap','substitute') NOT NULL,
+  team ENUM('red','blue') NOT NULL,
+  forward_id INT UNSIGNED NOT NULL,
+  goalkeeper_id INT UNSIGNED NOT NULL,
+  player_out_id INT UNSIGNED NULL,
+  player_in_id INT UNSIGNED NULL,
+  created_at DATETIME NOT NULL DEFAULT CURRENT_TIMESTAMP,
+  PRIMARY KEY (id),
+  UNIQUE KEY ux_lineup_events_game_seq (game_id, seq),
+  CONSTRAINT fk_le_game FOREIGN KEY (game_id) REFERENCES games(id)
+    ON DELETE CASCADE ON UPDATE RESTRICT,
+  CONSTRAINT fk_le_forward FOREIGN KEY (forward_id) REFERENCES players(id),
+  CONSTRAINT fk_le_goalkeeper FOREIGN KEY (goalkeeper_id) REFERENCES players(id),
+  CONSTRAINT fk_le_out FOREIGN KEY (player_out_id) REFERENCES players(id),
+  CONSTRAINT fk_le_in FOREIGN KEY (player_in_id) REFERENCES players(id)
+) ENGINE=InnoDB DEFAULT CHARSET=utf8mb4 COLLATE=utf8mb4_unicode_ci;
+
+-- API tokens (only the SHA-256 of each secret is stored)
+CREATE TABLE IF NOT EXISTS api_tokens (
+  id CHAR(16) NOT NULL,
+  token_hash CHAR(64) NOT NULL,
+  role ENUM('spectator','player','referee','admin') NOT NULL,
+  player_id INT UNSIGNED NULL,
+  label VARCHAR(100) NOT NULL DEFAULT '',
+  created_at DATETIME NOT NULL DEFAULT CURRENT_TIMESTAMP,
+  revoked_at DATETIME NULL,
+  PRIMARY KEY (id),
+  UNIQUE KEY ux_api_tokens_hash (token_hash),
+  CONSTRAINT fk_api_tokens_player FOREIGN KEY (player_id) REFERENCES players(id)
+) ENGINE=InnoDB DEFAULT CHARSET=utf8mb4 COLLATE=utf8mb4_unicode_ci;
+
+-- Seasons / leagues: teams, fixtures and standings
+CREATE TABLE IF NOT EXISTS seasons (
+  id INT UNSIGNED NOT NULL AUTO_INCREMENT,
+  name VARCHAR(100) NOT NULL,
+  starts_on DATE NOT NULL,
+  ends_on DATE NOT NULL,
+  legs TINYINT UNSIGNED NOT NULL DEFAULT 1,
+  created_at DATETIME NOT NULL DEFAULT CURRENT_TIMESTAMP,
+  PRIMARY KEY (id),
+  UNIQUE KEY ux_seasons_name (name)
+) ENGINE=InnoDB DEFAULT CHARSET=utf8mb4 COLLATE=utf8mb4_unicode_ci;
+
+CREATE TABLE IF NOT EXISTS season_teams (
+  id INT UNSIGNED NOT NULL AUTO_INCREMENT,
+  season_id INT UNSIGNED NOT NULL,
+  name VARCHAR(100) NOT NULL,
+  forward_id INT UNSIGNED NOT NULL,
+  goalkeeper_id INT UNSIGNED NOT NULL,
+  PRIMARY KEY (id),
+  UNIQUE KEY ux_season_teams_name (season_id, name),
+  CONSTRAINT fk_st_season FOREIGN KEY (season_id) REFERENCES seasons(id)
+    ON DELETE CASCADE,
+  CONSTRAINT fk_st_forward FOREIGN KEY (forward_id) REFERENCES players(id),
+  CONSTRAINT fk_st_goalkeeper FOREIGN KEY (goalkeeper_id) REFERENCES players(id)
+) ENGINE=InnoDB DEFAULT CHARSET=utf8mb4 COLLATE=utf8mb4_unicode_ci;
+
+CREATE TABLE IF NOT EXISTS season_fixtures (
+  id INT UNSIGNED NOT NULL AUTO_INCREMENT,
+  season_id INT UNSIGNED NOT NULL,
+  round SMALLINT UNSIGNED NOT NULL,
+  scheduled_on DATE NOT NULL,
+  home_team_id INT UNSIGNED NOT NULL,
+  away_team_id INT UNSIGNED NOT NULL,
+  home_score TINYINT UNSIGNED NULL,
+  away_score TINYINT UNSIGNED NULL,
+  played_at DATETIME NULL,
+  PRIMARY KEY (id),
+  KEY ix_season_fixtures_round (season_id, round),
+  CONSTRAINT fk_sf_season FOREIGN KEY (season_id) REFERENCES seasons(id)
+    ON DELETE CASCADE,
+  CONSTRAINT fk_sf_home FOREIGN KEY (home_team_id) REFERENCES season_teams(id),
+  CONSTRAINT fk_sf_away FOREIGN KEY (away_team_id) REFERENCES season_teams(id)
+) ENGINE=InnoDB DEFAULT CHARSET=utf8mb4 COLLATE=utf8mb4_unicode_ci;
+
+-- Recomputed from season_fixtures whenever a result is recorded
+CREATE TABLE IF NOT EXISTS season_standings (
+  season_id INT UNSIGNED NOT NULL,
+  team_id INT UNSIGNED NOT NULL,
+  played SMALLINT UNSIGNED NOT NULL DEFAULT 0,
+  won SMALLINT UNSIGNED NOT NULL DEFAULT 0,
+  drawn SMALLINT UNSIGNED NOT NULL DEFAULT 0,
+  lost SMALLINT UNSIGNED NOT NULL DEFAULT 0,
+  goals_for INT UNSIGNED NOT NULL DEFAULT 0,
+  goals_against INT UNSIGNED NOT NULL DEFAULT 0,
+  points INT UNSIGNED NOT NULL DEFAULT 0,
+  updated_at DATETIME NOT NULL DEFAULT CURRENT_TIMESTAMP ON UPDATE CURRENT_TIMESTAMP,
+  PRIMARY KEY (season_id, team_id),
+  CONSTRAINT fk_ss_season FOREIGN KEY (season_id) REFERENCES seasons(id)
+    ON DELETE CASCADE,
+  CONSTRAINT fk_ss_team FOREIGN KEY (team_id) REFERENCES season_teams(id)
+    ON DELETE CASCADE
+) ENGINE=InnoDB DEFAULT CHARSET=utf8mb4 COLLATE=utf8mb4_unicode_ci;
+
+-- Webhook subscriptions (the delivery log is kept in memory)
+CREATE TABLE IF NOT EXISTS webhooks (
+  id CHAR(16) NOT NULL,
+  url VARCHAR(2048) NOT NULL,
+  events VARCHAR(500) NOT NULL DEFAULT '',
+  secret VARCHAR(128) NOT NULL,
+  label VARCHAR(100) NOT NULL DEFAULT '',
+  created_at DATETIME NOT NULL DEFAULT CURRENT_TIMESTAMP,
+  PRIMARY KEY (id)
+) ENGINE=InnoDB DEFAULT CHARSET=utf8mb4 COLLATE=utf8mb4_unicode_ci;
+
+-- Slack users linked to the player they act as
+CREATE TABLE IF NOT EXISTS slack_links (
+  slack_user_id VARCHAR(32) NOT NULL,
+  player_id INT UNSIGNED NOT NULL,
+  created_at DATETIME NOT NULL DEFAULT CURRENT_TIMESTAMP,
+  PRIMARY KEY (slack_user_id),
+  KEY ix_slack_links_player (player_id),
+  CONSTRAINT fk_slack_links_player FOREIGN KEY (player_id) REFERENCES players(id)
+) ENGINE=InnoDB DEFAULT CHARSET=utf8mb4 COLLATE=utf8mb4_unicode_ci;
+
 -- Optional helper view for leaderboard
 -- Aggregates are already denormalized in players, but this can be handy if using only events
 -- CREATE VIEW leaderboard AS
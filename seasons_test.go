@@ -0,0 +1,102 @@
+package main
+
+import (
+	"testing"
+	"time"
+)
+
+func TestSeasonFixtures(t *testing.T) {
+	day := func(s string) time.Time {
+		d, err := time.Parse(seasonDateLayout, s)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return d
+	}
+	tests := []struct {
+		name       string
+		teams      int
+		legs       int
+		start, end string
+		rounds     int
+	}{
+		{"even teams", 4, 1, "2026-09-01", "2026-09-03", 3},
+		{"odd teams sit out a round each", 5, 1, "2026-09-01", "2026-09-30", 5},
+		{"two legs", 4, 2, "2026-09-01", "2026-12-15", 6},
+		{"odd teams over two legs", 3, 2, "2026-09-01", "2026-09-06", 6},
+		{"one day", 4, 2, "2026-09-01", "2026-09-01", 6},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			fixtures := seasonFixtures(tt.teams, tt.legs, day(tt.start), day(tt.end))
+			if want := tt.teams * (tt.teams - 1) / 2 * tt.legs; len(fixtures) != want {
+				t.Fatalf("%d fixtures, want %d", len(fixtures), want)
+			}
+
+			// Every ordered pairing is played at most once; with two legs
+			// both orders are played, with one leg either
+			played := map[[2]int64]int{}
+			perRound := map[int]map[int64]bool{}
+			dates := map[int]string{}
+			for _, f := range fixtures {
+				valid := func(id int64) bool { return id >= 0 && id < int64(tt.teams) }
+				if f.HomeTeamID == f.AwayTeamID || !valid(f.HomeTeamID) || !valid(f.AwayTeamID) {
+					t.Fatalf("fixture %+v has invalid teams", f)
+				}
+				played[[2]int64{f.HomeTeamID, f.AwayTeamID}]++
+				if perRound[f.Round] == nil {
+					perRound[f.Round] = map[int64]bool{}
+				}
+				for _, team := range []int64{f.HomeTeamID, f.AwayTeamID} {
+					if perRound[f.Round][team] {
+						t.Errorf("team %d plays twice in round %d", team, f.Round)
+					}
+					perRound[f.Round][team] = true
+				}
+				if d, ok := dates[f.Round]; ok && d != f.ScheduledOn {
+					t.Errorf("round %d on %s and %s", f.Round, d, f.ScheduledOn)
+				}
+				dates[f.Round] = f.ScheduledOn
+			}
+			for a := int64(0); a < int64(tt.teams); a++ {
+				for b := a + 1; b < int64(tt.teams); b++ {
+					ab, ba := played[[2]int64{a, b}], played[[2]int64{b, a}]
+					if tt.legs == 2 && (ab != 1 || ba != 1) || tt.legs == 1 && ab+ba != 1 {
+						t.Errorf("teams %d and %d: %d home, %d away", a, b, ab, ba)
+					}
+				}
+			}
+
+			if len(perRound) != tt.rounds {
+				t.Fatalf("%d rounds, want %d", len(perRound), tt.rounds)
+			}
+			// Rounds are numbered from 1, spread from start to end in order
+			prev := ""
+			for r := 1; r <= tt.rounds; r++ {
+				d, ok := dates[r]
+				if !ok {
+					t.Fatalf("round %d missing", r)
+				}
+				if d < prev || d < tt.start || d > tt.end {
+					t.Errorf("round %d on %s, after %s in %s..%s", r, d, prev, tt.start, tt.end)
+				}
+				prev = d
+			}
+			if dates[1] != tt.start || dates[tt.rounds] != tt.end {
+				t.Errorf("rounds from %s to %s, want %s to %s", dates[1], dates[tt.rounds], tt.start, tt.end)
+			}
+		})
+	}
+}
+
+func TestSeasonFixturesSecondLegSwapsHome(t *testing.T) {
+	start := time.Date(2026, 9, 1, 0, 0, 0, 0, time.UTC)
+	fixtures := seasonFixtures(4, 2, start, start.AddDate(0, 0, 50))
+	half := len(fixtures) / 2
+	for i, f := range fixtures[:half] {
+		g := fixtures[half+i]
+		if g.Round != f.Round+3 || g.HomeTeamID != f.AwayTeamID || g.AwayTeamID != f.HomeTeamID {
+			t.Errorf("leg 1 %+v, leg 2 %+v", f, g)
+		}
+	}
+}
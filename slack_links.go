@@ -0,0 +1,134 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"sort"
+	"sync"
+	"time"
+)
+
+var errSlackUserInvalid = errors.New("slack user id must be 1 to 32 letters or digits")
+
+// slackLink binds a Slack user (by user ID, which unlike the username never
+// changes) to the player they act as.
+type slackLink struct {
+	SlackUserID string    `json:"slack_user_id"`
+	PlayerID    string    `json:"player_id"`
+	CreatedAt   time.Time `json:"created_at"`
+}
+
+// slackLinkStore caches Slack links in memory and writes through to the
+// slack_links table when the DB is enabled.
+type slackLinkStore struct {
+	mu     sync.Mutex
+	byUser map[string]slackLink
+}
+
+var slackLinks = &slackLinkStore{byUser: map[string]slackLink{}}
+
+func validateSlackUserID(id string) error {
+	if id == "" || len(id) > 32 {
+		return errSlackUserInvalid
+	}
+	for _, c := range id {
+		if (c < 'A' || c > 'Z') && (c < 'a' || c > 'z') && (c < '0' || c > '9') {
+			return errSlackUserInvalid
+		}
+	}
+	return nil
+}
+
+// load reads existing links from the DB.
+func (s *slackLinkStore) load(ctx context.Context) error {
+	if db == nil {
+		return nil
+	}
+	rows, err := db.sql.QueryContext(ctx, "SELECT slack_user_id, player_id, created_at FROM slack_links")
+	if err != nil {
+		return err
+	}
+	defer rows.Close()
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for rows.Next() {
+		var l slackLink
+		var pid int64
+		if err := rows.Scan(&l.SlackUserID, &pid, &l.CreatedAt); err != nil {
+			return err
+		}
+		l.PlayerID = formatPlayerID(pid)
+		s.byUser[l.SlackUserID] = l
+	}
+	return rows.Err()
+}
+
+// Get returns the link of a Slack user.
+func (s *slackLinkStore) Get(userID string) (slackLink, bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	l, ok := s.byUser[userID]
+	return l, ok
+}
+
+// List returns all links, newest first.
+func (s *slackLinkStore) List() []slackLink {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	out := make([]slackLink, 0, len(s.byUser))
+	for _, l := range s.byUser {
+		out = append(out, l)
+	}
+	sort.Slice(out, func(i, j int) bool { return out[i].CreatedAt.After(out[j].CreatedAt) })
+	return out
+}
+
+// Link binds the Slack user to the player, replacing an earlier link of
+// that user.
+func (s *slackLinkStore) Link(ctx context.Context, userID string, playerID int64) (slackLink, error) {
+	if err := validateSlackUserID(userID); err != nil {
+		return slackLink{}, err
+	}
+	l := slackLink{SlackUserID: userID, PlayerID: formatPlayerID(playerID), CreatedAt: time.Now().UTC()}
+	if db != nil {
+		if _, err := db.sql.ExecContext(ctx,
+			`INSERT INTO slack_links (slack_user_id, player_id, created_at) VALUES (?, ?, ?)
+             ON DUPLICATE KEY UPDATE player_id = VALUES(player_id), created_at = VALUES(created_at)`,
+			userID, playerID, l.CreatedAt); err != nil {
+			return slackLink{}, err
+		}
+	}
+	s.mu.Lock()
+	s.byUser[userID] = l
+	s.mu.Unlock()
+	return l, nil
+}
+
+// Unlink removes a Slack user's link. Returns false if there was none.
+func (s *slackLinkStore) Unlink(ctx context.Context, userID string) (bool, error) {
+	if _, ok := s.Get(userID); !ok {
+		return false, nil
+	}
+	if db != nil {
+		if _, err := db.sql.ExecContext(ctx, "DELETE FROM slack_links WHERE slack_user_id = ?", userID); err != nil {
+			return true, err
+		}
+	}
+	s.mu.Lock()
+	delete(s.byUser, userID)
+	s.mu.Unlock()
+	return true, nil
+}
+
+// Forget drops the cached links to a player, or to players merged into
+// them, whose rows were already removed from the DB (e.g. after the player
+// was anonymized).
+func (s *slackLinkStore) Forget(playerID int64) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for u, l := range s.byUser {
+		if id, ok := playerRefID(l.PlayerID); ok && directory.canonical(id) == playerID {
+			delete(s.byUser, u)
+		}
+	}
+}
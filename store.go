@@ -44,7 +44,7 @@ func hasDuplicate(ids []string) (string, bool) {
 }
 
 func playerExistsInGame(gs *GameState, id string) bool {
-	if gs.Red.Forward == id || gs.Red.Goalkeeper == id || gs.Blue.Forward == id || gs.Blue.Goalkeeper == id {
+	if playerOnTable(gs, id) {
 		return true
 	}
 	for _, v := range gs.Waiting.Snapshot() {
@@ -65,17 +65,171 @@ func max(a, b int) int {
 func newGameIDLocked() string {
 	// Assumes gamesMu is already held when called.
 	for {
-		b := make([]byte, 12)
-		if _, err := crand.Read(b); err != nil {
-			// Fallback to timestamp-based entropy if crypto fails (unlikely)
-			t := time.Now().UnixNano()
-			for i := 0; i < len(b); i++ {
-				b[i] = byte(t >> (8 * (i % 8)))
-			}
-		}
-		id := hex.EncodeToString(b)
+		id := randomID()
 		if _, exists := games[id]; !exists {
 			return id
 		}
 	}
 }
+
+// newIDLocked allocates a random key unused in m (venues, tournaments).
+func newIDLocked[V any](m map[string]V) string {
+	// Assumes gamesMu is already held when called.
+	for {
+		id := randomID()
+		if _, exists := m[id]; !exists {
+			return id
+		}
+	}
+}
+
+func randomID() string {
+	b := make([]byte, 12)
+	if _, err := crand.Read(b); err != nil {
+		// Fallback to timestamp-based entropy if crypto fails (unlikely)
+		t := time.Now().UnixNano()
+		for i := 0; i < len(b); i++ {
+			b[i] = byte(t >> (8 * (i % 8)))
+		}
+	}
+	return hex.EncodeToString(b)
+}
+
+// playersShareGame describes a game (or venue) in which both players
+// currently appear, e.g. "game 1a2b".
+func playersShareGame(a, b string) (string, bool) {
+	gamesMu.RLock()
+	defer gamesMu.RUnlock()
+	for id, gs := range games {
+		if playerExistsInGame(gs, a) && playerExistsInGame(gs, b) {
+			return "game " + id, true
+		}
+	}
+	// Both somewhere in one venue (queue or tables) counts as well
+	for id, v := range venues {
+		_, inA := v.conflict("", a)
+		_, inB := v.conflict("", b)
+		if inA && inB {
+			return "venue " + id, true
+		}
+	}
+	return "", false
+}
+
+// gamesWithPlayer lists the games in which the player currently appears.
+func gamesWithPlayer(id string) []string {
+	gamesMu.RLock()
+	defer gamesMu.RUnlock()
+	out := []string{}
+	for gid, gs := range games {
+		if playerExistsInGame(gs, id) {
+			out = append(out, gid)
+		}
+	}
+	return out
+}
+
+// playerOnTable reports whether the player is in one of the four positions.
+func playerOnTable(gs *GameState, id string) bool {
+	return gs.Red.Forward == id || gs.Red.Goalkeeper == id || gs.Blue.Forward == id || gs.Blue.Goalkeeper == id
+}
+
+// replacePlayerInGames swaps player ID from for into across all games,
+// including undo history and streak tracking, and venue queues. Callers
+// check playersShareGame first, but a player may have joined since: where
+// both now appear and one of them is only waiting, that queue entry is
+// dropped; games with both on the table are left untouched and returned.
+func replacePlayerInGames(from, into string) (skipped []string) {
+	gamesMu.Lock()
+	defer gamesMu.Unlock()
+	swap := func(s *string) {
+		if *s == from {
+			*s = into
+		}
+	}
+	swapTeam := func(t *TeamState) {
+		swap(&t.Forward)
+		swap(&t.Goalkeeper)
+	}
+	for gid, gs := range games {
+		if playerExistsInGame(gs, from) && playerExistsInGame(gs, into) {
+			switch {
+			case playerOnTable(gs, from) && playerOnTable(gs, into):
+				skipped = append(skipped, gid)
+				continue
+			case playerOnTable(gs, from):
+				gs.removeWaiting(into)
+			default:
+				gs.removeWaiting(from)
+			}
+		}
+		swapTeam(&gs.Red)
+		swapTeam(&gs.Blue)
+		waiting := gs.Waiting.Snapshot()
+		for i := range waiting {
+			swap(&waiting[i])
+		}
+		q := NewRingQueue(max(8, len(waiting)))
+		for _, v := range waiting {
+			q.Enqueue(v)
+		}
+		gs.Waiting = q
+		rekeyQueueMeta(gs.QueueMeta, from, into)
+		rekeyMap(gs.Priorities, from, into)
+		for i := range gs.History {
+			swapTeam(&gs.History[i].Red)
+			swapTeam(&gs.History[i].Blue)
+			for j := range gs.History[i].Waiting {
+				swap(&gs.History[i].Waiting[j])
+			}
+			// A snapshot may have had both waiting; keep the first entry
+			gs.History[i].Waiting = uniqueStrings(gs.History[i].Waiting)
+			rekeyQueueMeta(gs.History[i].QueueMeta, from, into)
+			rekeyMap(gs.History[i].Priorities, from, into)
+			swap(&gs.History[i].Venue.Took)
+			swap(&gs.History[i].Venue.Returned)
+		}
+		swap(&gs.StreakForward)
+		swap(&gs.StreakGoalkeeper)
+		swap(&gs.StreakOppStartF)
+		swap(&gs.StreakOppStartG)
+		for j := range gs.StreakQueueBaseline {
+			swap(&gs.StreakQueueBaseline[j])
+		}
+		if _, ok := gs.StreakSeenFromQueue[from]; ok {
+			delete(gs.StreakSeenFromQueue, from)
+			gs.StreakSeenFromQueue[into] = struct{}{}
+		}
+	}
+	for _, v := range venues {
+		if v.queued(from) && v.queued(into) {
+			v.remove(from)
+		}
+		waiting := v.Waiting.Snapshot()
+		for i := range waiting {
+			swap(&waiting[i])
+		}
+		q := NewRingQueue(max(8, len(waiting)))
+		for _, id := range waiting {
+			q.Enqueue(id)
+		}
+		v.Waiting = q
+		rekeyMap(v.Joined, from, into)
+	}
+	return skipped
+}
+
+func rekeyMap[V any](m map[string]V, from, into string) {
+	if v, ok := m[from]; ok {
+		delete(m, from)
+		m[into] = v
+	}
+}
+
+func rekeyQueueMeta(m map[string]QueueEntry, from, into string) {
+	if e, ok := m[from]; ok {
+		e.PlayerID = into
+		delete(m, from)
+		m[into] = e
+	}
+}
@@ -0,0 +1,44 @@
+package main
+
+import (
+	"slices"
+	"testing"
+)
+
+func TestReplacePlayerInGamesRepairsConcurrentJoins(t *testing.T) {
+	gamesMu.Lock()
+	saved := games
+	games = map[string]*GameState{}
+	newGame := func(id string, red, blue TeamState, waiting ...string) *GameState {
+		gs := &GameState{Red: red, Blue: blue, Waiting: NewRingQueue(8)}
+		for _, w := range waiting {
+			gs.Waiting.Enqueue(w)
+		}
+		games[id] = gs
+		return gs
+	}
+	// "1" is merged into "2"
+	fromPlays := newGame("a", TeamState{Forward: "1", Goalkeeper: "3"}, TeamState{Forward: "4", Goalkeeper: "5"}, "2", "6")
+	bothWait := newGame("b", TeamState{Forward: "3", Goalkeeper: "4"}, TeamState{Forward: "5", Goalkeeper: "6"}, "1", "7", "2")
+	bothPlay := newGame("c", TeamState{Forward: "1", Goalkeeper: "2"}, TeamState{Forward: "3", Goalkeeper: "4"})
+	gamesMu.Unlock()
+	t.Cleanup(func() {
+		gamesMu.Lock()
+		games = saved
+		gamesMu.Unlock()
+	})
+
+	skipped := replacePlayerInGames("1", "2")
+	if !slices.Equal(skipped, []string{"c"}) {
+		t.Errorf("skipped = %v, want [c]", skipped)
+	}
+	if fromPlays.Red.Forward != "2" || !slices.Equal(fromPlays.Waiting.Snapshot(), []string{"6"}) {
+		t.Errorf("game a: forward %q, waiting %v", fromPlays.Red.Forward, fromPlays.Waiting.Snapshot())
+	}
+	if got := bothWait.Waiting.Snapshot(); !slices.Equal(got, []string{"7", "2"}) {
+		t.Errorf("game b waiting %v, want [7 2]", got)
+	}
+	if bothPlay.Red.Forward != "1" || bothPlay.Red.Goalkeeper != "2" {
+		t.Errorf("game c changed: %+v", bothPlay.Red)
+	}
+}
@@ -0,0 +1,157 @@
+package main
+
+import (
+	"context"
+	"log"
+	"math"
+	"math/rand/v2"
+	"sort"
+	"time"
+)
+
+// Team generation modes for POST /games/start with a players list.
+const (
+	teamsBalanced = "balanced"
+	teamsRandom   = "random"
+)
+
+// ratingPriorGoals pulls the rating of players with few recorded goals
+// towards an even 0.5.
+const ratingPriorGoals = 10
+
+// playerStrength is what team generation knows about a player.
+type playerStrength struct {
+	Rating float64
+	Role   string // preferred_role: forward, goalkeeper, any or ""
+}
+
+// rating is the share of goal events won by the player's side, smoothed
+// with ratingPriorGoals even results.
+func (r goalRecord) rating() float64 {
+	return (float64(r.Won) + 0.5*ratingPriorGoals) / (float64(r.Played) + ratingPriorGoals)
+}
+
+// playerStrengths loads ratings and preferred roles. Without the database,
+// or if it fails, everyone is rated evenly: a game should still start.
+func playerStrengths(ctx context.Context, ids []string) map[string]playerStrength {
+	out := make(map[string]playerStrength, len(ids))
+	for _, id := range ids {
+		out[id] = playerStrength{Rating: 0.5}
+	}
+	if db == nil {
+		return out
+	}
+	nums := make([]int64, 0, len(ids))
+	for _, id := range ids {
+		if n, ok := playerRefID(id); ok {
+			nums = append(nums, n)
+		}
+	}
+	ctx, cancel := context.WithTimeout(ctx, 3*time.Second)
+	defer cancel()
+	records, err := db.GoalRecords(ctx, nums)
+	if err != nil {
+		log.Printf("[teams] goal records unavailable, rating evenly: %v", err)
+		return out
+	}
+	players, err := db.GetPlayersByIDs(ctx, nums)
+	if err != nil {
+		log.Printf("[teams] player profiles unavailable: %v", err)
+	}
+	for _, id := range ids {
+		n, _ := playerRefID(id)
+		out[id] = playerStrength{Rating: records[n].rating(), Role: players[n].PreferredRole}
+	}
+	return out
+}
+
+// teamGeneration describes how the server formed the starting teams.
+type teamGeneration struct {
+	Mode       string             `json:"mode"`
+	RedRating  float64            `json:"red_rating"`
+	BlueRating float64            `json:"blue_rating"`
+	Ratings    map[string]float64 `json:"ratings"`
+}
+
+// generateTeams forms the starting teams and queue from the present
+// players (at least four).
+//
+// balanced: players are ordered strongest, weakest, second strongest,
+// second weakest, ... The first four start, split into the two pairs with
+// the closest combined rating; the rest queue in that order, so strong and
+// weak players alternate coming on.
+//
+// random: a shuffle; the first four start.
+//
+// Within a team, preferred roles decide who plays forward.
+func generateTeams(mode string, ids []string, st map[string]playerStrength) (red, blue TeamState, waiting []string, gen teamGeneration) {
+	order := append([]string(nil), ids...)
+	if mode == teamsRandom {
+		rand.Shuffle(len(order), func(i, j int) { order[i], order[j] = order[j], order[i] })
+	} else {
+		sort.SliceStable(order, func(i, j int) bool { return st[order[i]].Rating > st[order[j]].Rating })
+		order = interleave(order)
+	}
+	a, b, c, d := order[0], order[1], order[2], order[3]
+	if mode != teamsRandom {
+		a, b, c, d = closestSplit(order[:4], st)
+	}
+	red, blue = positions(a, b, st), positions(c, d, st)
+	gen = teamGeneration{
+		Mode:       mode,
+		RedRating:  round3(st[a].Rating + st[b].Rating),
+		BlueRating: round3(st[c].Rating + st[d].Rating),
+		Ratings:    make(map[string]float64, len(ids)),
+	}
+	for _, id := range ids {
+		gen.Ratings[id] = round3(st[id].Rating)
+	}
+	return red, blue, order[4:], gen
+}
+
+// interleave reorders a strongest-first list as strongest, weakest, second
+// strongest, second weakest, ...
+func interleave(sorted []string) []string {
+	out := make([]string, 0, len(sorted))
+	for i, j := 0, len(sorted)-1; i <= j; i, j = i+1, j-1 {
+		out = append(out, sorted[i])
+		if i != j {
+			out = append(out, sorted[j])
+		}
+	}
+	return out
+}
+
+// closestSplit picks, of the three ways to pair up four players, the one
+// whose pairs' combined ratings differ least.
+func closestSplit(four []string, st map[string]playerStrength) (a, b, c, d string) {
+	p := four
+	splits := [3][4]string{
+		{p[0], p[1], p[2], p[3]},
+		{p[0], p[2], p[1], p[3]},
+		{p[0], p[3], p[1], p[2]},
+	}
+	best, bestDiff := 0, math.Inf(1)
+	for i, s := range splits {
+		diff := math.Abs(st[s[0]].Rating + st[s[1]].Rating - st[s[2]].Rating - st[s[3]].Rating)
+		if diff < bestDiff-1e-9 {
+			best, bestDiff = i, diff
+		}
+	}
+	s := splits[best]
+	return s[0], s[1], s[2], s[3]
+}
+
+// positions puts x up front unless preferred roles say otherwise.
+func positions(x, y string, st map[string]playerStrength) TeamState {
+	if st[x].Role == "goalkeeper" || st[y].Role == "forward" {
+		if st[y].Role != "goalkeeper" && st[x].Role != "forward" {
+			x, y = y, x
+		}
+	}
+	return TeamState{Forward: x, Goalkeeper: y}
+}
+
+func round3(v float64) float64 {
+	return math.Round(v*1000) / 1000
+}
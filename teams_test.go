@@ -0,0 +1,151 @@
+package main
+
+import (
+	"math"
+	"slices"
+	"testing"
+)
+
+func TestInterleave(t *testing.T) {
+	tests := []struct {
+		sorted, want []string
+	}{
+		{[]string{"a", "b", "c", "d"}, []string{"a", "d", "b", "c"}},
+		{[]string{"a", "b", "c", "d", "e"}, []string{"a", "e", "b", "d", "c"}},
+		{[]string{"a"}, []string{"a"}},
+	}
+	for _, tt := range tests {
+		if got := interleave(tt.sorted); !slices.Equal(got, tt.want) {
+			t.Errorf("interleave(%v) = %v, want %v", tt.sorted, got, tt.want)
+		}
+	}
+}
+
+func TestClosestSplit(t *testing.T) {
+	tests := []struct {
+		name    string
+		four    []string
+		ratings map[string]float64
+		want    [4]string
+	}{
+		{"strongest with weakest", []string{"a", "d", "b", "c"},
+			map[string]float64{"a": 0.9, "b": 0.8, "c": 0.5, "d": 0.1}, [4]string{"a", "d", "b", "c"}},
+		{"strongest with second", []string{"a", "b", "c", "d"},
+			map[string]float64{"a": 0.5, "b": 0.1, "c": 0.4, "d": 0.2}, [4]string{"a", "b", "c", "d"}},
+		{"strongest with third", []string{"a", "b", "c", "d"},
+			map[string]float64{"a": 0.9, "b": 0.8, "c": 0.1, "d": 0.2}, [4]string{"a", "c", "b", "d"}},
+		{"ties keep the first split", []string{"a", "b", "c", "d"},
+			map[string]float64{"a": 0.5, "b": 0.5, "c": 0.5, "d": 0.5}, [4]string{"a", "b", "c", "d"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			st := map[string]playerStrength{}
+			for id, r := range tt.ratings {
+				st[id] = playerStrength{Rating: r}
+			}
+			a, b, c, d := closestSplit(tt.four, st)
+			if got := [4]string{a, b, c, d}; got != tt.want {
+				t.Errorf("closestSplit = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestPositions(t *testing.T) {
+	tests := []struct {
+		x, y    string // preferred roles
+		forward string
+	}{
+		{"", "", "x"},
+		{"any", "any", "x"},
+		{"goalkeeper", "", "y"},
+		{"", "forward", "y"},
+		{"goalkeeper", "forward", "y"},
+		{"forward", "forward", "x"},
+		{"goalkeeper", "goalkeeper", "x"},
+		{"forward", "goalkeeper", "x"},
+	}
+	for _, tt := range tests {
+		st := map[string]playerStrength{"x": {Role: tt.x}, "y": {Role: tt.y}}
+		got := positions("x", "y", st)
+		other := "y"
+		if tt.forward == "y" {
+			other = "x"
+		}
+		if got.Forward != tt.forward || got.Goalkeeper != other {
+			t.Errorf("x %q, y %q: forward %s, goalkeeper %s; want forward %s", tt.x, tt.y, got.Forward, got.Goalkeeper, tt.forward)
+		}
+	}
+}
+
+func TestGenerateTeamsBalanced(t *testing.T) {
+	tests := []struct {
+		name    string
+		ids     []string
+		st      map[string]playerStrength
+		red     TeamState
+		blue    TeamState
+		waiting []string
+	}{
+		{
+			name: "four players",
+			ids:  []string{"1", "2", "3", "4"},
+			st: map[string]playerStrength{
+				"1": {Rating: 0.2}, "2": {Rating: 0.9}, "3": {Rating: 0.6}, "4": {Rating: 0.4},
+			},
+			red:  TeamState{Forward: "2", Goalkeeper: "1"},
+			blue: TeamState{Forward: "3", Goalkeeper: "4"},
+		},
+		{
+			name: "rest queue strong and weak alternating",
+			ids:  []string{"1", "2", "3", "4", "5", "6", "7"},
+			st: map[string]playerStrength{
+				"1": {Rating: 0.9}, "2": {Rating: 0.8}, "3": {Rating: 0.7}, "4": {Rating: 0.6},
+				"5": {Rating: 0.3}, "6": {Rating: 0.2}, "7": {Rating: 0.1},
+			},
+			// Order 1 7 2 6 3 5 4: the first four split 1+7 against 2+6
+			red:     TeamState{Forward: "1", Goalkeeper: "7"},
+			blue:    TeamState{Forward: "2", Goalkeeper: "6"},
+			waiting: []string{"3", "5", "4"},
+		},
+		{
+			name: "preferred roles swap within a team",
+			ids:  []string{"1", "2", "3", "4"},
+			st: map[string]playerStrength{
+				"1": {Rating: 0.9, Role: "goalkeeper"}, "2": {Rating: 0.6},
+				"3": {Rating: 0.4, Role: "forward"}, "4": {Rating: 0.1, Role: "any"},
+			},
+			red:  TeamState{Forward: "4", Goalkeeper: "1"},
+			blue: TeamState{Forward: "3", Goalkeeper: "2"},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			red, blue, waiting, gen := generateTeams(teamsBalanced, tt.ids, tt.st)
+			if red != tt.red || blue != tt.blue {
+				t.Errorf("red %+v, blue %+v; want %+v, %+v", red, blue, tt.red, tt.blue)
+			}
+			if !slices.Equal(waiting, tt.waiting) {
+				t.Errorf("waiting %v, want %v", waiting, tt.waiting)
+			}
+			wantRed := tt.st[tt.red.Forward].Rating + tt.st[tt.red.Goalkeeper].Rating
+			wantBlue := tt.st[tt.blue.Forward].Rating + tt.st[tt.blue.Goalkeeper].Rating
+			if math.Abs(gen.RedRating-wantRed) > 1e-9 || math.Abs(gen.BlueRating-wantBlue) > 1e-9 {
+				t.Errorf("ratings red %v, blue %v; want %v, %v", gen.RedRating, gen.BlueRating, wantRed, wantBlue)
+			}
+			if gen.Mode != teamsBalanced || len(gen.Ratings) != len(tt.ids) {
+				t.Errorf("generation = %+v", gen)
+			}
+		})
+	}
+}
+
+func TestGenerateTeamsRandomUsesEveryone(t *testing.T) {
+	ids := []string{"1", "2", "3", "4", "5", "6"}
+	red, blue, waiting, _ := generateTeams(teamsRandom, ids, map[string]playerStrength{})
+	got := append([]string{red.Forward, red.Goalkeeper, blue.Forward, blue.Goalkeeper}, waiting...)
+	slices.Sort(got)
+	if !slices.Equal(got, ids) {
+		t.Errorf("players %v, want each of %v once", got, ids)
+	}
+}
@@ -0,0 +1,554 @@
+package main
+
+import (
+	"math/bits"
+	"sort"
+	"time"
+)
+
+// Tournament formats
+const (
+	formatSingleElimination = "single_elimination"
+	formatDoubleElimination = "double_elimination"
+	formatRoundRobin        = "round_robin"
+)
+
+// Match brackets
+const (
+	bracketWinners    = "winners"
+	bracketLosers     = "losers"
+	bracketFinal      = "final" // grand final (double elimination)
+	bracketRoundRobin = "round_robin"
+)
+
+// noPair fills a match side no pair will ever take (a bye).
+const noPair = -1
+
+// Tournament is a bracket of fixed pairs. Each match is played as a game
+// (see startMatchGame) that scores to GoalsToWin instead of rotating;
+// finishing it advances the bracket. Tournaments live in memory next to
+// games and are guarded by gamesMu.
+type Tournament struct {
+	Name       string
+	Format     string
+	GoalsToWin int
+	Pairs      []tournamentPair
+	Matches    []*tournamentMatch
+	Started    bool
+	// Pair ID of the champion once decided
+	Winner    int
+	CreatedAt time.Time
+}
+
+type tournamentPair struct {
+	ID         int    `json:"id"`
+	Name       string `json:"name"`
+	Forward    string `json:"forward"`
+	Goalkeeper string `json:"goalkeeper"`
+}
+
+// matchSlot is one side of a match, where a result feeds into.
+type matchSlot struct {
+	Match int    `json:"match"`
+	Side  string `json:"side"` // "red" or "blue"
+}
+
+type tournamentMatch struct {
+	ID      int
+	Bracket string
+	Round   int
+	// Pair IDs: 0 until known, noPair for a bye
+	Red, Blue int
+	// Where the winner and loser go (nil: nowhere)
+	WinnerTo, LoserTo *matchSlot
+	GameID            string
+	RedScore          int
+	BlueScore         int
+	Done              bool
+	// Decided without being played (a bye, or a reset final not needed)
+	Bye           bool
+	Winner, Loser int
+	// Second grand final, played only if the losers' bracket side wins the first
+	Reset bool
+}
+
+// matchRef ties a game to the tournament match it plays.
+type matchRef struct {
+	TournamentID string
+	MatchID      int
+	GoalsToWin   int
+}
+
+type matchScore struct {
+	Red, Blue int
+}
+
+var tournaments = map[string]*Tournament{}
+
+func (t *Tournament) match(id int) *tournamentMatch {
+	if id < 1 || id > len(t.Matches) {
+		return nil
+	}
+	return t.Matches[id-1]
+}
+
+func (t *Tournament) pair(id int) *tournamentPair {
+	if id < 1 || id > len(t.Pairs) {
+		return nil
+	}
+	return &t.Pairs[id-1]
+}
+
+func (t *Tournament) addMatch(bracket string, round int) *tournamentMatch {
+	m := &tournamentMatch{ID: len(t.Matches) + 1, Bracket: bracket, Round: round}
+	t.Matches = append(t.Matches, m)
+	return m
+}
+
+// generate builds the bracket from the registered pairs (seeded in order)
+// and settles first-round byes.
+func (t *Tournament) generate() {
+	if t.Format == formatRoundRobin {
+		t.generateRoundRobin()
+	} else {
+		t.generateElimination(t.Format == formatDoubleElimination)
+	}
+	t.Started = true
+	for _, m := range t.Matches {
+		t.settle(m)
+	}
+}
+
+// seedOrder lists seeds in bracket order so that top seeds meet last:
+// 1, 4, 2, 3 for four.
+func seedOrder(size int) []int {
+	order := []int{1}
+	for len(order) < size {
+		n := len(order) * 2
+		next := make([]int, 0, n)
+		for _, s := range order {
+			next = append(next, s, n+1-s)
+		}
+		order = next
+	}
+	return order
+}
+
+func (t *Tournament) seedPair(seed int) int {
+	if seed > len(t.Pairs) {
+		return noPair
+	}
+	return t.Pairs[seed-1].ID
+}
+
+func (t *Tournament) generateElimination(double bool) {
+	size := 2
+	for size < len(t.Pairs) {
+		size *= 2
+	}
+	rounds := bits.Len(uint(size)) - 1
+	wb := make([][]*tournamentMatch, rounds+1)
+	order := seedOrder(size)
+	for r := 1; r <= rounds; r++ {
+		for i := 0; i < size>>r; i++ {
+			m := t.addMatch(bracketWinners, r)
+			wb[r] = append(wb[r], m)
+			if r == 1 {
+				m.Red, m.Blue = t.seedPair(order[2*i]), t.seedPair(order[2*i+1])
+				continue
+			}
+			wb[r-1][2*i].WinnerTo = &matchSlot{m.ID, "red"}
+			wb[r-1][2*i+1].WinnerTo = &matchSlot{m.ID, "blue"}
+		}
+	}
+	if !double {
+		return
+	}
+
+	// Losers' bracket: first-round losers meet, then each winners' round
+	// drops its losers in against the survivors.
+	var prev []*tournamentMatch
+	for i := 0; i < len(wb[1])/2; i++ {
+		m := t.addMatch(bracketLosers, 1)
+		wb[1][2*i].LoserTo = &matchSlot{m.ID, "red"}
+		wb[1][2*i+1].LoserTo = &matchSlot{m.ID, "blue"}
+		prev = append(prev, m)
+	}
+	lr := 1
+	for r := 2; r <= rounds; r++ {
+		lr++
+		drop := wb[r]
+		cur := make([]*tournamentMatch, 0, len(prev))
+		for i := range prev {
+			m := t.addMatch(bracketLosers, lr)
+			prev[i].WinnerTo = &matchSlot{m.ID, "red"}
+			// Reversed to put off rematches from the winners' bracket
+			drop[len(drop)-1-i].LoserTo = &matchSlot{m.ID, "blue"}
+			cur = append(cur, m)
+		}
+		prev = cur
+		if len(prev) > 1 {
+			lr++
+			cur = make([]*tournamentMatch, 0, len(prev)/2)
+			for i := 0; i < len(prev)/2; i++ {
+				m := t.addMatch(bracketLosers, lr)
+				prev[2*i].WinnerTo = &matchSlot{m.ID, "red"}
+				prev[2*i+1].WinnerTo = &matchSlot{m.ID, "blue"}
+				cur = append(cur, m)
+			}
+			prev = cur
+		}
+	}
+
+	// Grand final, and its reset right after it
+	gf := t.addMatch(bracketFinal, 1)
+	reset := t.addMatch(bracketFinal, 2)
+	reset.Reset = true
+	wb[rounds][0].WinnerTo = &matchSlot{gf.ID, "red"}
+	if len(prev) == 0 {
+		// Two pairs: the loser goes straight to the final
+		wb[1][0].LoserTo = &matchSlot{gf.ID, "blue"}
+		return
+	}
+	prev[0].WinnerTo = &matchSlot{gf.ID, "blue"}
+}
+
+// generateRoundRobin schedules every pair against every other once.
+func (t *Tournament) generateRoundRobin() {
+	for r, round := range roundRobinRounds(len(t.Pairs)) {
+		for _, p := range round {
+			m := t.addMatch(bracketRoundRobin, r+1)
+			m.Red, m.Blue = t.Pairs[p[0]].ID, t.Pairs[p[1]].ID
+		}
+	}
+}
+
+// roundRobinRounds pairs n entries (by index) so each meets every other
+// once, in rounds (circle method; with an odd n one entry sits out each
+// round). Sides alternate for the fixed entry.
+func roundRobinRounds(n int) [][][2]int {
+	idx := make([]int, n, n+1)
+	for i := range idx {
+		idx[i] = i
+	}
+	if n%2 == 1 {
+		idx = append(idx, -1)
+	}
+	n = len(idx)
+	rounds := make([][][2]int, 0, n-1)
+	for r := 0; r < n-1; r++ {
+		round := make([][2]int, 0, n/2)
+		for i := 0; i < n/2; i++ {
+			a, b := idx[i], idx[n-1-i]
+			if a < 0 || b < 0 {
+				continue
+			}
+			if i == 0 && r%2 == 1 {
+				a, b = b, a
+			}
+			round = append(round, [2]int{a, b})
+		}
+		rounds = append(rounds, round)
+		// Keep the first in place and rotate the rest
+		idx = append([]int{idx[0], idx[n-1]}, idx[1:n-1]...)
+	}
+	return rounds
+}
+
+// settle decides a match that cannot be played because a side is a bye.
+func (t *Tournament) settle(m *tournamentMatch) {
+	if m.Done || m.Red == 0 || m.Blue == 0 || (m.Red != noPair && m.Blue != noPair) {
+		return
+	}
+	winner := m.Red
+	if winner == noPair {
+		winner = m.Blue
+	}
+	t.decide(m, winner, noPair, true)
+}
+
+// decide records a match result and feeds the winner and loser onward.
+func (t *Tournament) decide(m *tournamentMatch, winner, loser int, bye bool) {
+	m.Done, m.Bye, m.Winner, m.Loser = true, bye, winner, loser
+	if m.Bracket == bracketFinal && !m.Reset {
+		reset := t.match(m.ID + 1)
+		if winner == m.Red {
+			// The winners' bracket champion is still unbeaten
+			reset.Done, reset.Bye = true, true
+			t.Winner = winner
+			return
+		}
+		reset.Red, reset.Blue = m.Red, m.Blue
+		return
+	}
+	t.fill(m.WinnerTo, winner)
+	t.fill(m.LoserTo, loser)
+	switch {
+	case m.Bracket == bracketRoundRobin:
+		if t.allDone() {
+			t.Winner = t.standings()[0].PairID
+		}
+	case m.WinnerTo == nil:
+		t.Winner = winner
+	}
+}
+
+func (t *Tournament) fill(slot *matchSlot, pairID int) {
+	if slot == nil {
+		return
+	}
+	d := t.match(slot.Match)
+	if slot.Side == "red" {
+		d.Red = pairID
+	} else {
+		d.Blue = pairID
+	}
+	t.settle(d)
+}
+
+func (t *Tournament) allDone() bool {
+	for _, m := range t.Matches {
+		if !m.Done {
+			return false
+		}
+	}
+	return true
+}
+
+// recordResult decides a played match from its score.
+func (t *Tournament) recordResult(m *tournamentMatch, red, blue int) {
+	m.RedScore, m.BlueScore = red, blue
+	if red > blue {
+		t.decide(m, m.Red, m.Blue, false)
+	} else {
+		t.decide(m, m.Blue, m.Red, false)
+	}
+}
+
+// reopenBlocked reports whether a match result has been built on: a match
+// it fed has a game or a played result.
+func (t *Tournament) reopenBlocked(m *tournamentMatch) bool {
+	var next []*tournamentMatch
+	if m.Bracket == bracketFinal && !m.Reset {
+		next = append(next, t.match(m.ID+1))
+	}
+	for _, slot := range []*matchSlot{m.WinnerTo, m.LoserTo} {
+		if slot != nil {
+			next = append(next, t.match(slot.Match))
+		}
+	}
+	for _, d := range next {
+		if d.GameID != "" || (d.Done && !d.Bye) {
+			return true
+		}
+		if d.Done && t.reopenBlocked(d) {
+			return true
+		}
+	}
+	return false
+}
+
+// reopen clears a match result and everything it decided by bye; check
+// reopenBlocked first.
+func (t *Tournament) reopen(m *tournamentMatch) {
+	if m.Bracket == bracketFinal && !m.Reset {
+		reset := t.match(m.ID + 1)
+		*reset = tournamentMatch{ID: reset.ID, Bracket: reset.Bracket, Round: reset.Round, Reset: true}
+	}
+	for _, slot := range []*matchSlot{m.WinnerTo, m.LoserTo} {
+		if slot == nil {
+			continue
+		}
+		d := t.match(slot.Match)
+		if d.Done {
+			t.reopen(d)
+		}
+		if slot.Side == "red" {
+			d.Red = 0
+		} else {
+			d.Blue = 0
+		}
+	}
+	m.Done, m.Bye, m.Winner, m.Loser = false, false, 0, 0
+	m.RedScore, m.BlueScore = 0, 0
+	t.Winner = 0
+}
+
+// status is how a match stands: pending (sides not known yet), ready,
+// playing, done, bye or not_needed (a reset final).
+func (m *tournamentMatch) status() string {
+	switch {
+	case m.Done && m.Bye && m.Red == 0:
+		return "not_needed"
+	case m.Done && m.Bye:
+		return "bye"
+	case m.Done:
+		return "done"
+	case m.GameID != "":
+		return "playing"
+	case m.Red > 0 && m.Blue > 0:
+		return "ready"
+	}
+	return "pending"
+}
+
+// standings ranks pairs by played matches: wins, then goal difference,
+// then goals scored.
+func (t *Tournament) standings() []tournamentStanding {
+	rows := make([]tournamentStanding, len(t.Pairs))
+	for i, p := range t.Pairs {
+		rows[i].PairID = p.ID
+	}
+	for _, m := range t.Matches {
+		if !m.Done || m.Bye {
+			continue
+		}
+		red, blue := &rows[m.Red-1], &rows[m.Blue-1]
+		red.Played++
+		blue.Played++
+		red.GoalsFor += m.RedScore
+		red.GoalsAgainst += m.BlueScore
+		blue.GoalsFor += m.BlueScore
+		blue.GoalsAgainst += m.RedScore
+		if m.Winner == m.Red {
+			red.Won++
+			blue.Lost++
+		} else {
+			blue.Won++
+			red.Lost++
+		}
+	}
+	sort.SliceStable(rows, func(i, j int) bool {
+		a, b := rows[i], rows[j]
+		if a.Won != b.Won {
+			return a.Won > b.Won
+		}
+		if da, db := a.GoalsFor-a.GoalsAgainst, b.GoalsFor-b.GoalsAgainst; da != db {
+			return da > db
+		}
+		return a.GoalsFor > b.GoalsFor
+	})
+	return rows
+}
+
+// startMatchGame creates the game a ready match is played in. Caller holds
+// gamesMu.
+func (t *Tournament) startMatchGame(tournamentID string, m *tournamentMatch) string {
+	red, blue := t.pair(m.Red), t.pair(m.Blue)
+	gs := &GameState{
+		Red:     TeamState{Forward: red.Forward, Goalkeeper: red.Goalkeeper},
+		Blue:    TeamState{Forward: blue.Forward, Goalkeeper: blue.Goalkeeper},
+		Waiting: NewRingQueue(8),
+		Started: true,
+		Match:   &matchRef{TournamentID: tournamentID, MatchID: m.ID, GoalsToWin: t.GoalsToWin},
+	}
+	id := newGameIDLocked()
+	games[id] = gs
+	m.GameID = id
+	return id
+}
+
+// matchPlayed is the tournament match the game plays, if any.
+func (gs *GameState) matchPlayed() (*Tournament, *tournamentMatch) {
+	if gs.Match == nil {
+		return nil, nil
+	}
+	t, ok := tournaments[gs.Match.TournamentID]
+	if !ok {
+		return nil, nil
+	}
+	return t, t.match(gs.Match.MatchID)
+}
+
+// scoreMatchGoal counts a goal in a match game instead of rotating. The
+// goal that reaches GoalsToWin ends the game and decides the match.
+func (gs *GameState) scoreMatchGoal(team string) {
+	if team == "red" {
+		gs.Score.Red++
+	} else {
+		gs.Score.Blue++
+	}
+	if gs.Score.Red < gs.Match.GoalsToWin && gs.Score.Blue < gs.Match.GoalsToWin {
+		return
+	}
+	gs.Started = false
+	if t, m := gs.matchPlayed(); m != nil {
+		t.recordResult(m, gs.Score.Red, gs.Score.Blue)
+	}
+}
+
+// matchUndoBlocked reports whether undoing to snap would reopen a match
+// whose result later matches already build on.
+func (gs *GameState) matchUndoBlocked(snap GameSnapshot) bool {
+	t, m := gs.matchPlayed()
+	return m != nil && m.Done && snap.Started && !gs.Started && t.reopenBlocked(m)
+}
+
+// matchUndo reopens the match when undo takes back its deciding goal.
+// Call before applying snap.
+func (gs *GameState) matchUndo(snap GameSnapshot) {
+	t, m := gs.matchPlayed()
+	if m != nil && m.Done && snap.Started && !gs.Started {
+		t.reopen(m)
+	}
+}
+
+// toTournamentResponse renders a tournament; caller holds gamesMu.
+func toTournamentResponse(id string, t *Tournament) tournamentResponse {
+	resp := tournamentResponse{
+		ID:         id,
+		Name:       t.Name,
+		Format:     t.Format,
+		GoalsToWin: t.GoalsToWin,
+		Status:     "registering",
+		Pairs:      t.Pairs,
+		Matches:    make([]tournamentMatchResponse, 0, len(t.Matches)),
+		Winner:     t.Winner,
+		CreatedAt:  t.CreatedAt,
+	}
+	if resp.Pairs == nil {
+		resp.Pairs = []tournamentPair{}
+	}
+	switch {
+	case t.Winner != 0:
+		resp.Status = "finished"
+	case t.Started:
+		resp.Status = "running"
+	}
+	ids := []string{}
+	for _, p := range t.Pairs {
+		ids = append(ids, p.Forward, p.Goalkeeper)
+	}
+	side := func(p int) int {
+		if p == noPair {
+			return 0
+		}
+		return p
+	}
+	for _, m := range t.Matches {
+		mr := tournamentMatchResponse{
+			ID:        m.ID,
+			Bracket:   m.Bracket,
+			Round:     m.Round,
+			Status:    m.status(),
+			RedPair:   side(m.Red),
+			BluePair:  side(m.Blue),
+			GameID:    m.GameID,
+			RedScore:  m.RedScore,
+			BlueScore: m.BlueScore,
+			Winner:    side(m.Winner),
+			WinnerTo:  m.WinnerTo,
+			LoserTo:   m.LoserTo,
+		}
+		if gs, ok := games[m.GameID]; ok && !m.Done {
+			// Live score of the game in progress
+			mr.RedScore, mr.BlueScore = gs.Score.Red, gs.Score.Blue
+		}
+		resp.Matches = append(resp.Matches, mr)
+	}
+	if t.Format == formatRoundRobin && t.Started {
+		resp.Standings = t.standings()
+	}
+	resp.Players = playerNames(ids...)
+	return resp
+}
@@ -0,0 +1,204 @@
+package main
+
+import (
+	"fmt"
+	"math/rand"
+	"slices"
+	"testing"
+)
+
+func newTestTournament(format string, pairs int) *Tournament {
+	t := &Tournament{Name: "test", Format: format, GoalsToWin: 10}
+	for i := 1; i <= pairs; i++ {
+		t.Pairs = append(t.Pairs, tournamentPair{ID: i, Name: fmt.Sprintf("pair %d", i)})
+	}
+	t.generate()
+	return t
+}
+
+// playOut plays every ready match, the winner chosen by redWins, until the
+// tournament has a champion. It returns the played losses per pair.
+func playOut(t *testing.T, tm *Tournament, redWins func(m *tournamentMatch) bool) map[int]int {
+	t.Helper()
+	losses := map[int]int{}
+	for step := 0; tm.Winner == 0; step++ {
+		if step > 4*len(tm.Matches) {
+			t.Fatalf("no champion after %d steps", step)
+		}
+		var ready *tournamentMatch
+		for _, m := range tm.Matches {
+			if m.status() == "ready" {
+				ready = m
+				break
+			}
+		}
+		if ready == nil {
+			t.Fatalf("no ready match and no champion: %s", dumpMatches(tm))
+		}
+		if ready.Red == ready.Blue {
+			t.Fatalf("match %d: pair %d plays itself", ready.ID, ready.Red)
+		}
+		if redWins(ready) {
+			tm.recordResult(ready, tm.GoalsToWin, 3)
+			losses[ready.Blue]++
+		} else {
+			tm.recordResult(ready, 3, tm.GoalsToWin)
+			losses[ready.Red]++
+		}
+	}
+	return losses
+}
+
+func dumpMatches(tm *Tournament) string {
+	s := ""
+	for _, m := range tm.Matches {
+		s += fmt.Sprintf("\n  #%d %s r%d %d-%d done=%v bye=%v", m.ID, m.Bracket, m.Round, m.Red, m.Blue, m.Done, m.Bye)
+	}
+	return s
+}
+
+func higherSeedWins(m *tournamentMatch) bool { return m.Red < m.Blue }
+func lowerSeedWins(m *tournamentMatch) bool  { return m.Red > m.Blue }
+
+func TestSeedOrder(t *testing.T) {
+	if got, want := seedOrder(8), []int{1, 8, 4, 5, 2, 7, 3, 6}; !slices.Equal(got, want) {
+		t.Errorf("seedOrder(8) = %v, want %v", got, want)
+	}
+}
+
+func TestSingleEliminationBracket(t *testing.T) {
+	for _, n := range []int{3, 4, 5, 8, 16} {
+		t.Run(fmt.Sprint(n), func(t *testing.T) {
+			tm := newTestTournament(formatSingleElimination, n)
+			size := 1
+			for size < n {
+				size *= 2
+			}
+			if len(tm.Matches) != size-1 {
+				t.Fatalf("%d matches, want %d", len(tm.Matches), size-1)
+			}
+			// Every pair is placed once in round one; the top seeds get the byes
+			seen := map[int]bool{}
+			byes := 0
+			for _, m := range tm.Matches {
+				if m.Round != 1 {
+					continue
+				}
+				for _, p := range []int{m.Red, m.Blue} {
+					if p == noPair {
+						continue
+					}
+					if seen[p] {
+						t.Errorf("pair %d placed twice", p)
+					}
+					seen[p] = true
+				}
+				if m.Bye {
+					byes++
+					if !m.Done || m.Winner > size-n {
+						t.Errorf("bye match %d: done=%v winner=%d", m.ID, m.Done, m.Winner)
+					}
+				}
+			}
+			if len(seen) != n || byes != size-n {
+				t.Fatalf("%d pairs placed, %d byes; want %d and %d", len(seen), byes, n, size-n)
+			}
+
+			losses := playOut(t, tm, higherSeedWins)
+			if tm.Winner != 1 {
+				t.Errorf("champion %d, want seed 1", tm.Winner)
+			}
+			for p := 2; p <= n; p++ {
+				if losses[p] != 1 {
+					t.Errorf("pair %d lost %d match(es), want 1", p, losses[p])
+				}
+			}
+			if !tm.allDone() {
+				t.Errorf("matches left undecided:%s", dumpMatches(tm))
+			}
+
+			upset := newTestTournament(formatSingleElimination, n)
+			playOut(t, upset, lowerSeedWins)
+			if upset.Winner == 0 || upset.Winner == 1 {
+				t.Errorf("upsets: champion %d", upset.Winner)
+			}
+		})
+	}
+}
+
+func TestDoubleEliminationBracket(t *testing.T) {
+	outcomes := []struct {
+		name    string
+		redWins func(*tournamentMatch) bool
+	}{
+		{"higher seed wins", higherSeedWins},
+		{"lower seed wins", lowerSeedWins},
+		{"random", nil},
+	}
+	for _, n := range []int{3, 4, 5, 8, 16} {
+		for _, o := range outcomes {
+			t.Run(fmt.Sprintf("%d/%s", n, o.name), func(t *testing.T) {
+				redWins := o.redWins
+				if redWins == nil {
+					r := rand.New(rand.NewSource(int64(n)))
+					redWins = func(*tournamentMatch) bool { return r.Intn(2) == 0 }
+				}
+				tm := newTestTournament(formatDoubleElimination, n)
+				final := tm.Matches[len(tm.Matches)-2]
+				reset := tm.Matches[len(tm.Matches)-1]
+				if final.Bracket != bracketFinal || reset.Bracket != bracketFinal || !reset.Reset {
+					t.Fatalf("bracket does not end with the grand final and its reset:%s", dumpMatches(tm))
+				}
+				losses := playOut(t, tm, redWins)
+				if tm.Winner == 0 {
+					t.Fatal("no champion")
+				}
+				// Everyone but the champion is out after exactly two losses;
+				// the champion lost at most once (the first grand final)
+				for p := 1; p <= n; p++ {
+					want := 2
+					if p == tm.Winner {
+						want = losses[p]
+						if want > 1 {
+							t.Errorf("champion %d lost %d matches", p, want)
+						}
+					}
+					if losses[p] != want {
+						t.Errorf("pair %d lost %d match(es), want %d", p, losses[p], want)
+					}
+				}
+				if reset.Bye != (losses[tm.Winner] == 0) {
+					t.Errorf("reset final bye=%v with champion losses %d", reset.Bye, losses[tm.Winner])
+				}
+				if !tm.allDone() {
+					t.Errorf("matches left undecided:%s", dumpMatches(tm))
+				}
+			})
+		}
+	}
+}
+
+func TestRoundRobinRounds(t *testing.T) {
+	for _, n := range []int{3, 4, 5, 8} {
+		rounds := roundRobinRounds(n)
+		met := map[[2]int]int{}
+		for r, round := range rounds {
+			busy := map[int]bool{}
+			for _, p := range round {
+				if busy[p[0]] || busy[p[1]] {
+					t.Errorf("n=%d round %d: entry plays twice", n, r+1)
+				}
+				busy[p[0]], busy[p[1]] = true, true
+				met[[2]int{min(p[0], p[1]), max(p[0], p[1])}]++
+			}
+		}
+		if len(met) != n*(n-1)/2 {
+			t.Errorf("n=%d: %d distinct meetings, want %d", n, len(met), n*(n-1)/2)
+		}
+		for k, c := range met {
+			if c != 1 {
+				t.Errorf("n=%d: %v met %d times", n, k, c)
+			}
+		}
+	}
+}
@@ -1,5 +1,7 @@
 package main
 
+import "time"
+
 type TeamState struct {
 	Forward    string `json:"forward"`
 	Goalkeeper string `json:"goalkeeper"`
@@ -11,6 +13,21 @@ type GameState struct {
 	Waiting *RingQueue
 	Started bool
 	History []GameSnapshot
+	// Venue this game is a table of ("" for a standalone game)
+	VenueID string `json:"-"`
+	// Set for a tournament match game: goals are scored up to
+	// Match.GoalsToWin instead of rotating the losing team
+	Match *matchRef  `json:"-"`
+	Score matchScore `json:"-"`
+	// Last per-game mutation sequence number; never rewound by undo
+	Seq int64 `json:"-"`
+	// When the last goal was recorded (minimum goal interval)
+	LastGoalAt time.Time `json:"-"`
+	// Times of the most recent goals (wait estimates)
+	RecentGoals []time.Time `json:"-"`
+	// Metadata of waiting players and per-game priority bumps, by player ID
+	QueueMeta  map[string]QueueEntry `json:"-"`
+	Priorities map[string]int        `json:"-"`
 	// Streak/achievement tracking (not serialized)
 	StreakTeam          string              `json:"-"`
 	StreakForward       string              `json:"-"`
@@ -29,15 +46,61 @@ type GameSnapshot struct {
 	Blue    TeamState
 	Waiting []string
 	Started bool
+	// Sequence number of the mutation made right after this snapshot
+	Seq        int64
+	LastGoalAt time.Time
+	QueueMeta  map[string]QueueEntry
+	Priorities map[string]int
+	Streak     streakSnapshot
+	// Venue queue changes made by the mutation (rotations at venue tables)
+	Venue venueMove
+	Score matchScore
+}
+
+// streakSnapshot is the streak tracking restored by undo.
+type streakSnapshot struct {
+	Team, Forward, Goalkeeper string
+	OppStartF, OppStartG      string
+	Awarded                   bool
 }
 
 func snapshotGame(gs *GameState) GameSnapshot {
 	return GameSnapshot{
-		Red:     gs.Red,
-		Blue:    gs.Blue,
-		Waiting: gs.Waiting.Snapshot(),
-		Started: gs.Started,
+		Red:        gs.Red,
+		Blue:       gs.Blue,
+		Waiting:    gs.Waiting.Snapshot(),
+		Started:    gs.Started,
+		LastGoalAt: gs.LastGoalAt,
+		QueueMeta:  copyMap(gs.QueueMeta),
+		Priorities: copyMap(gs.Priorities),
+		Score:      gs.Score,
+		Streak: streakSnapshot{
+			Team:       gs.StreakTeam,
+			Forward:    gs.StreakForward,
+			Goalkeeper: gs.StreakGoalkeeper,
+			OppStartF:  gs.StreakOppStartF,
+			OppStartG:  gs.StreakOppStartG,
+			Awarded:    gs.StreakAwarded,
+		},
+	}
+}
+
+func copyMap[K comparable, V any](m map[K]V) map[K]V {
+	out := make(map[K]V, len(m))
+	for k, v := range m {
+		out[k] = v
 	}
+	return out
+}
+
+// pushHistory snapshots gs for undo and assigns the next sequence number to
+// the mutation about to be applied.
+func pushHistory(gs *GameState) int64 {
+	gs.Seq++
+	snap := snapshotGame(gs)
+	snap.Seq = gs.Seq
+	gs.History = append(gs.History, snap)
+	return gs.Seq
 }
 
 func applySnapshot(gs *GameState, snap GameSnapshot) {
@@ -49,19 +112,202 @@ func applySnapshot(gs *GameState, snap GameSnapshot) {
 	}
 	gs.Waiting = q
 	gs.Started = snap.Started
+	gs.LastGoalAt = snap.LastGoalAt
+	gs.QueueMeta = copyMap(snap.QueueMeta)
+	gs.Priorities = copyMap(snap.Priorities)
+	gs.Score = snap.Score
+	gs.StreakTeam = snap.Streak.Team
+	gs.StreakForward = snap.Streak.Forward
+	gs.StreakGoalkeeper = snap.Streak.Goalkeeper
+	gs.StreakOppStartF = snap.Streak.OppStartF
+	gs.StreakOppStartG = snap.Streak.OppStartG
+	gs.StreakAwarded = snap.Streak.Awarded
 }
 
 // Request/response models
+// Players replaces red/blue/waiting: the server forms the starting teams
+// and queue from everyone present, by Mode ("balanced" or "random").
 type resetRequest struct {
 	Red     TeamState `json:"red"`
 	Blue    TeamState `json:"blue"`
 	Waiting []string  `json:"waiting"`
+	Players []string  `json:"players"`
+	Mode    string    `json:"mode"`
 }
 
+// PlayerID accepts a stable player ID or, for convenience, a player name
+// (normalized and resolved to its ID). Players may omit it to act as
+// themselves.
 type queueRequest struct {
 	PlayerID string `json:"player_id"`
 }
 
+// batchQueueRequest lists players for bulk queue operations (IDs or
+// names); for reorder it is the complete new order.
+type batchQueueRequest struct {
+	PlayerIDs []string `json:"player_ids"`
+}
+
+// stepAsideRequest keeps the player's place while rotation passes them
+// over: once, or until Minutes have elapsed. Cancel clears either.
+type stepAsideRequest struct {
+	PlayerID string `json:"player_id"`
+	Minutes  int    `json:"minutes"`
+	Cancel   bool   `json:"cancel"`
+}
+
+// moveRequest moves a waiting player to a 1-based position.
+type moveRequest struct {
+	PlayerID string `json:"player_id"`
+	Position int    `json:"position"`
+}
+
+// priorityRequest sets a player's priority bump in a game (0 clears it).
+type priorityRequest struct {
+	PlayerID string `json:"player_id"`
+	Priority int    `json:"priority"`
+}
+
+// gameCommandRequest is the body of POST /games/{gameId}.
+//   - swap: {"command": "swap", "team": "red"} swaps the team's forward and goalkeeper
+//   - substitute: {"command": "substitute", "out": "12", "in": "15"} replaces an
+//     active player with a waiting one, who takes over their slot; the
+//     player going out takes the other's place in the queue
+type gameCommandRequest struct {
+	Command string `json:"command"`
+	Team    string `json:"team"`
+	Out     string `json:"out"`
+	In      string `json:"in"`
+}
+
+// lineupChange describes a swap or substitution (persisted in lineup_events).
+type lineupChange struct {
+	Kind string `json:"kind"` // "swap" or "substitute"
+	Team string `json:"team"`
+	// Slot affected by a substitution ("forward" or "goalkeeper")
+	Position string `json:"position,omitempty"`
+	Out      string `json:"out,omitempty"`
+	In       string `json:"in,omitempty"`
+}
+
+// venueRequest creates a venue.
+type venueRequest struct {
+	Name string `json:"name"`
+}
+
+// venueTableRequest adds a running game to a venue as a named table.
+type venueTableRequest struct {
+	Name   string `json:"name"`
+	GameID string `json:"game_id"`
+}
+
+type venueResponse struct {
+	ID     string               `json:"id"`
+	Name   string               `json:"name"`
+	Tables []venueTableResponse `json:"tables"`
+	// The shared queue, in order
+	Waiting []string          `json:"waiting"`
+	Queue   []venueQueueEntry `json:"queue"`
+	Players map[string]string `json:"players"`
+}
+
+type venueTableResponse struct {
+	Name    string    `json:"name"`
+	GameID  string    `json:"game_id"`
+	Red     TeamState `json:"red"`
+	Blue    TeamState `json:"blue"`
+	Waiting []string  `json:"waiting"`
+}
+
+type venueQueueEntry struct {
+	PlayerID string    `json:"player_id"`
+	Position int       `json:"position"`
+	JoinedAt time.Time `json:"joined_at"`
+	// Predicted turn at whichever table rotates first
+	GoalsUntilUp         int `json:"goals_until_up"`
+	EstimatedWaitSeconds int `json:"estimated_wait_seconds"`
+}
+
+// tournamentRequest creates a tournament; pairs may also be registered
+// afterwards until it starts.
+type tournamentRequest struct {
+	Name       string        `json:"name"`
+	Format     string        `json:"format"`
+	GoalsToWin int           `json:"goals_to_win"`
+	Pairs      []pairRequest `json:"pairs"`
+}
+
+// pairRequest registers a fixed pair (player IDs or names). Name defaults
+// to "Forward & Goalkeeper".
+type pairRequest struct {
+	Name       string `json:"name"`
+	Forward    string `json:"forward"`
+	Goalkeeper string `json:"goalkeeper"`
+}
+
+// tournamentStartRequest: Shuffle seeds the pairs randomly instead of in
+// registration order.
+type tournamentStartRequest struct {
+	Shuffle bool `json:"shuffle"`
+}
+
+// matchResultRequest records a match played outside the app.
+type matchResultRequest struct {
+	RedScore  int `json:"red_score"`
+	BlueScore int `json:"blue_score"`
+}
+
+type tournamentResponse struct {
+	ID         string `json:"id"`
+	Name       string `json:"name"`
+	Format     string `json:"format"`
+	GoalsToWin int    `json:"goals_to_win"`
+	// registering, running or finished
+	Status  string                    `json:"status"`
+	Pairs   []tournamentPair          `json:"pairs"`
+	Matches []tournamentMatchResponse `json:"matches"`
+	// Round robin only
+	Standings []tournamentStanding `json:"standings,omitempty"`
+	// Champion pair ID once finished
+	Winner    int               `json:"winner_pair,omitempty"`
+	CreatedAt time.Time         `json:"created_at"`
+	Players   map[string]string `json:"players"`
+}
+
+// tournamentMatchResponse: pair IDs are 0 while unknown; see status.
+type tournamentMatchResponse struct {
+	ID        int        `json:"id"`
+	Bracket   string     `json:"bracket"`
+	Round     int        `json:"round"`
+	Status    string     `json:"status"`
+	RedPair   int        `json:"red_pair,omitempty"`
+	BluePair  int        `json:"blue_pair,omitempty"`
+	GameID    string     `json:"game_id,omitempty"`
+	RedScore  int        `json:"red_score"`
+	BlueScore int        `json:"blue_score"`
+	Winner    int        `json:"winner_pair,omitempty"`
+	WinnerTo  *matchSlot `json:"winner_to,omitempty"`
+	LoserTo   *matchSlot `json:"loser_to,omitempty"`
+}
+
+type tournamentStanding struct {
+	PairID       int `json:"pair_id"`
+	Played       int `json:"played"`
+	Won          int `json:"won"`
+	Lost         int `json:"lost"`
+	GoalsFor     int `json:"goals_for"`
+	GoalsAgainst int `json:"goals_against"`
+}
+
+// matchStatus is the score of a tournament match game.
+type matchStatus struct {
+	TournamentID string `json:"tournament_id"`
+	MatchID      int    `json:"match_id"`
+	GoalsToWin   int    `json:"goals_to_win"`
+	RedScore     int    `json:"red_score"`
+	BlueScore    int    `json:"blue_score"`
+}
+
 type goalRequest struct {
 	Team string `json:"team"`
 }
@@ -79,12 +325,22 @@ type celebrationResponse struct {
 }
 
 type gameResponse struct {
-	Red         TeamState            `json:"red"`
-	Blue        TeamState            `json:"blue"`
-	Waiting     []string             `json:"waiting"`
-	Rotation    *rotationSummary     `json:"rotation,omitempty"`
-	Started     bool                 `json:"started"`
+	Red     TeamState `json:"red"`
+	Blue    TeamState `json:"blue"`
+	Waiting []string  `json:"waiting"`
+	// Waiting players in the same order, with their queue metadata
+	Queue    []QueueEntry     `json:"queue"`
+	Rotation *rotationSummary `json:"rotation,omitempty"`
+	Started  bool             `json:"started"`
+	// Set when the game is a table of a venue
+	VenueID string `json:"venue_id,omitempty"`
+	// Set when the game plays a tournament match
+	Match       *matchStatus         `json:"match,omitempty"`
 	Celebration *celebrationResponse `json:"celebration,omitempty"`
+	// Set in responses to swap / substitute commands
+	Lineup *lineupChange `json:"lineup,omitempty"`
+	// Display names keyed by the stable player IDs used above
+	Players map[string]string `json:"players"`
 }
 
 type gameSummary struct {
@@ -93,6 +349,7 @@ type gameSummary struct {
 }
 
 type startNewGameResponse struct {
-	ID    string       `json:"id"`
-	State gameResponse `json:"state"`
+	ID    string          `json:"id"`
+	State gameResponse    `json:"state"`
+	Teams *teamGeneration `json:"teams,omitempty"`
 }
@@ -0,0 +1,184 @@
+package main
+
+import "time"
+
+// Venue groups several tables (games) on one floor with a shared waiting
+// queue: players in it come on at whichever table rotates first. Within a
+// venue a player is in at most one place — on or waiting at one table, or
+// in the venue queue — so nobody is ever active on two tables at once.
+// Venues live in memory next to games and are guarded by gamesMu.
+type Venue struct {
+	Name    string
+	Tables  []venueTable
+	Waiting *RingQueue
+	// When each player joined the venue queue
+	Joined map[string]time.Time
+}
+
+type venueTable struct {
+	Name   string
+	GameID string
+}
+
+var venues = map[string]*Venue{}
+
+// venueMove records how a rotation used the venue queue, so that undo can
+// reverse exactly that without touching other tables' moves.
+type venueMove struct {
+	// Came on from the venue queue, and when they had joined it
+	Took       string
+	TookJoined time.Time
+	// Benched into the venue queue
+	Returned string
+}
+
+func newVenue(name string) *Venue {
+	return &Venue{Name: name, Waiting: NewRingQueue(8), Joined: map[string]time.Time{}}
+}
+
+func (v *Venue) enqueue(id string, now time.Time) {
+	v.Waiting.Enqueue(id)
+	v.Joined[id] = now
+}
+
+func (v *Venue) remove(id string) bool {
+	if !v.Waiting.RemoveValue(id) {
+		return false
+	}
+	delete(v.Joined, id)
+	return true
+}
+
+func (v *Venue) queued(id string) bool {
+	_, ok := v.Joined[id]
+	return ok
+}
+
+// venue is the venue the game is a table of, or nil.
+func (gs *GameState) venue() *Venue {
+	if gs.VenueID == "" {
+		return nil
+	}
+	return venues[gs.VenueID]
+}
+
+// canRotate reports whether anyone can come on: from the table's own queue
+// or, for a venue table, the venue queue.
+func (gs *GameState) canRotate() bool {
+	if gs.Waiting.Len() > 0 {
+		return true
+	}
+	v := gs.venue()
+	return v != nil && v.Waiting.Len() > 0
+}
+
+// nextForward dequeues the player coming on at this table. At a venue
+// table, whoever has waited longest between the table's next player and
+// the front of the venue queue comes on.
+func (gs *GameState) nextForward(now time.Time) (string, venueMove) {
+	if v := gs.venue(); v != nil && v.Waiting.Len() > 0 {
+		front := v.Waiting.Snapshot()[0]
+		local := gs.upNext(now)
+		if local == "" || v.Joined[front].Before(gs.QueueMeta[local].JoinedAt) {
+			mv := venueMove{Took: front, TookJoined: v.Joined[front]}
+			v.remove(front)
+			return front, mv
+		}
+	}
+	id, _ := gs.nextWaiting(now)
+	return id, venueMove{}
+}
+
+// bench queues a player leaving the table: at a venue table they join the
+// venue queue, free to come on at any table.
+func (gs *GameState) bench(id string, now time.Time, mv *venueMove) {
+	if v := gs.venue(); v != nil {
+		v.enqueue(id, now)
+		mv.Returned = id
+		return
+	}
+	gs.enqueueWaiting(id, now)
+}
+
+// venueUndoBlocked reports a player an undo would bring back to this table
+// who has since come on at another one.
+func (gs *GameState) venueUndoBlocked(mv venueMove) (string, bool) {
+	v := gs.venue()
+	if v == nil || mv.Returned == "" || v.queued(mv.Returned) {
+		return "", false
+	}
+	return mv.Returned, true
+}
+
+// undoVenueMove reverses a rotation's venue queue changes after the game's
+// own snapshot has been restored.
+func (gs *GameState) undoVenueMove(mv venueMove) {
+	v := gs.venue()
+	if v == nil {
+		return
+	}
+	if mv.Returned != "" {
+		v.remove(mv.Returned)
+	}
+	if mv.Took != "" {
+		v.Waiting.InsertAt(0, mv.Took)
+		v.Joined[mv.Took] = mv.TookJoined
+	}
+}
+
+// venueConflict finds a player among ids who is already elsewhere in the
+// game's venue: in the venue queue or at another table. Caller holds gamesMu.
+func venueConflict(gs *GameState, gameID string, ids ...string) (string, bool) {
+	v := gs.venue()
+	if v == nil {
+		return "", false
+	}
+	return v.conflict(gameID, ids...)
+}
+
+// conflict finds a player among ids who is in the venue queue or at a
+// table other than exceptGame.
+func (v *Venue) conflict(exceptGame string, ids ...string) (string, bool) {
+	for _, id := range ids {
+		if id == "" {
+			continue
+		}
+		if v.queued(id) {
+			return id, true
+		}
+		for _, t := range v.Tables {
+			if t.GameID == exceptGame {
+				continue
+			}
+			if gs, ok := games[t.GameID]; ok && playerExistsInGame(gs, id) {
+				return id, true
+			}
+		}
+	}
+	return "", false
+}
+
+// toVenueResponse renders a venue; caller holds gamesMu.
+func toVenueResponse(id string, v *Venue) venueResponse {
+	resp := venueResponse{ID: id, Name: v.Name, Tables: []venueTableResponse{}, Waiting: v.Waiting.Snapshot()}
+	ids := append([]string{}, resp.Waiting...)
+	for _, t := range v.Tables {
+		tr := venueTableResponse{Name: t.Name, GameID: t.GameID}
+		if gs, ok := games[t.GameID]; ok {
+			tr.Red, tr.Blue, tr.Waiting = gs.Red, gs.Blue, gs.Waiting.Snapshot()
+			ids = append(ids, collectAllIDs(gs)...)
+		}
+		resp.Tables = append(resp.Tables, tr)
+	}
+	resp.Queue = make([]venueQueueEntry, len(resp.Waiting))
+	est := v.estimateWaits(time.Now())
+	for i, pid := range resp.Waiting {
+		resp.Queue[i] = venueQueueEntry{
+			PlayerID: pid, Position: i + 1, JoinedAt: v.Joined[pid],
+			GoalsUntilUp:         est[pid].Goals,
+			EstimatedWaitSeconds: int(est[pid].Wait.Round(time.Second) / time.Second),
+		}
+	}
+	resp.Players = playerNames(ids...)
+	return resp
+}
@@ -0,0 +1,177 @@
+package main
+
+import (
+	"context"
+	"log"
+	"sort"
+	"sync/atomic"
+	"time"
+)
+
+const (
+	// defaultGoalInterval is assumed until there is any history.
+	defaultGoalInterval = 90 * time.Second
+	// maxGoalGap: longer gaps between goals are breaks, not play.
+	maxGoalGap = 10 * time.Minute
+	// recentGoalsKept goal times are kept per game for its own pace.
+	recentGoalsKept = 20
+)
+
+// historicalGoalInterval caches the average interval between goals from
+// goal_events (nanoseconds; 0 until known).
+var historicalGoalInterval atomic.Int64
+
+// runWaitEstimates refreshes historicalGoalInterval from the DB every few
+// minutes until ctx is done.
+func runWaitEstimates(ctx context.Context) {
+	if db == nil {
+		return
+	}
+	t := time.NewTicker(5 * time.Minute)
+	defer t.Stop()
+	for {
+		qctx, cancel := context.WithTimeout(ctx, 10*time.Second)
+		avg, ok, err := db.AverageGoalInterval(qctx, time.Now().AddDate(0, 0, -30), maxGoalGap)
+		cancel()
+		switch {
+		case err != nil:
+			log.Printf("[wait] goal interval query failed: %v", err)
+		case ok:
+			historicalGoalInterval.Store(int64(avg))
+		}
+		select {
+		case <-ctx.Done():
+			return
+		case <-t.C:
+		}
+	}
+}
+
+// recordGoalTime remembers when a goal was scored, for the game's own pace.
+func (gs *GameState) recordGoalTime(t time.Time) {
+	gs.RecentGoals = append(gs.RecentGoals, t)
+	if len(gs.RecentGoals) > recentGoalsKept {
+		gs.RecentGoals = gs.RecentGoals[len(gs.RecentGoals)-recentGoalsKept:]
+	}
+}
+
+// goalInterval estimates the time between goals for this game: the median
+// of its recent intervals once there are a few, else the historical
+// average, else a default.
+func (gs *GameState) goalInterval() time.Duration {
+	var gaps []time.Duration
+	for i := 1; i < len(gs.RecentGoals); i++ {
+		if g := gs.RecentGoals[i].Sub(gs.RecentGoals[i-1]); g >= time.Second && g <= maxGoalGap {
+			gaps = append(gaps, g)
+		}
+	}
+	if len(gaps) >= 3 {
+		sort.Slice(gaps, func(i, j int) bool { return gaps[i] < gaps[j] })
+		return gaps[len(gaps)/2]
+	}
+	if v := historicalGoalInterval.Load(); v > 0 {
+		return time.Duration(v)
+	}
+	return defaultGoalInterval
+}
+
+// waitEstimate is the predicted turn of one waiting player.
+type waitEstimate struct {
+	// The player comes on as forward at this goal (1 = the next goal)
+	Goals int
+	Wait  time.Duration
+}
+
+// estimateWaits simulates the coming rotations on a copy of the queue to
+// predict when each waiting player comes on. Players who stepped aside are
+// passed over as they would be; benched players rejoining are ignored
+// (they queue behind everyone unless bumped). At a venue table the whole
+// venue is simulated, so the estimates include the venue queue players and
+// the tables they may come on at. Caller holds gamesMu.
+func (gs *GameState) estimateWaits(now time.Time) map[string]waitEstimate {
+	if v := gs.venue(); v != nil {
+		return v.estimateWaits(now)
+	}
+	return simulateWaits(now, nil, gs)
+}
+
+// estimateWaits predicts when each player waiting in the venue, in its
+// queue or at one of its tables, comes on. Caller holds gamesMu.
+func (v *Venue) estimateWaits(now time.Time) map[string]waitEstimate {
+	tables := make([]*GameState, 0, len(v.Tables))
+	for _, t := range v.Tables {
+		if gs, ok := games[t.GameID]; ok {
+			tables = append(tables, gs)
+		}
+	}
+	return simulateWaits(now, v, tables...)
+}
+
+// waitSim is one table in a wait simulation.
+type waitSim struct {
+	gs       *GameState
+	interval time.Duration
+	// When the table's next goal is due, and how many goals it has had
+	next  time.Duration
+	goals int
+}
+
+// simulateWaits plays the tables' coming goals in the order they are due.
+// Each goal calls up the table's next player or, as in nextForward, the
+// front of the venue queue (v may be nil) if they have waited longer.
+func simulateWaits(now time.Time, v *Venue, tables ...*GameState) map[string]waitEstimate {
+	sims := make([]*waitSim, len(tables))
+	for i, gs := range tables {
+		interval := gs.goalInterval()
+		elapsed := time.Duration(0)
+		if !gs.LastGoalAt.IsZero() {
+			elapsed = now.Sub(gs.LastGoalAt)
+		}
+		sim := &GameState{Waiting: NewRingQueue(max(8, gs.Waiting.Len())), QueueMeta: copyMap(gs.QueueMeta)}
+		for _, id := range gs.Waiting.Snapshot() {
+			sim.Waiting.Enqueue(id)
+		}
+		// The next goal is due one interval after the last; later ones follow
+		first := interval - elapsed
+		if first < 0 {
+			first = 0
+		}
+		sims[i] = &waitSim{gs: sim, interval: interval, next: first}
+	}
+	var queue []string
+	var joined map[string]time.Time
+	if v != nil {
+		queue, joined = v.Waiting.Snapshot(), v.Joined
+	}
+
+	out := map[string]waitEstimate{}
+	for {
+		// The table whose goal is due first rotates next
+		var s *waitSim
+		for _, c := range sims {
+			if c.gs.Waiting.Len() == 0 && len(queue) == 0 {
+				continue
+			}
+			if s == nil || c.next < s.next {
+				s = c
+			}
+		}
+		if s == nil {
+			return out
+		}
+		s.goals++
+		at := now.Add(s.next)
+		id := ""
+		if len(queue) > 0 {
+			local := s.gs.upNext(at)
+			if local == "" || joined[queue[0]].Before(s.gs.QueueMeta[local].JoinedAt) {
+				id, queue = queue[0], queue[1:]
+			}
+		}
+		if id == "" {
+			id, _ = s.gs.nextWaiting(at)
+		}
+		out[id] = waitEstimate{Goals: s.goals, Wait: s.next}
+		s.next += s.interval
+	}
+}
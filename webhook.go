@@ -0,0 +1,418 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"io"
+	"log"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// webhookEvents are the event types a webhook can subscribe to.
+var webhookEvents = []string{
+	"game_started", "game_ended", "goal", "rotation", "full_rotation", "player_joined_queue",
+	"player_left", "undo", "swap", "substitute", "ready_check", "ready_timeout", "ready_confirmed",
+}
+
+// webhook is a registered receiver. The secret signs deliveries and is only
+// returned when the webhook is created.
+type webhook struct {
+	ID        string    `json:"id"`
+	URL       string    `json:"url"`
+	Events    []string  `json:"events"` // empty = every event
+	Label     string    `json:"label"`
+	CreatedAt time.Time `json:"created_at"`
+	secret    string
+}
+
+func (h *webhook) wants(eventType string) bool {
+	if len(h.Events) == 0 {
+		return true
+	}
+	for _, e := range h.Events {
+		if e == eventType {
+			return true
+		}
+	}
+	return false
+}
+
+// Delivery statuses
+const (
+	deliveryPending   = "pending"
+	deliveryDelivered = "delivered"
+	deliveryFailed    = "failed"
+)
+
+// webhookDelivery is one event sent (or being sent) to one webhook.
+type webhookDelivery struct {
+	ID            uint64     `json:"id"`
+	WebhookID     string     `json:"webhook_id"`
+	Event         string     `json:"event"`
+	GameID        string     `json:"game_id,omitempty"`
+	Status        string     `json:"status"`
+	Attempts      int        `json:"attempts"`
+	StatusCode    int        `json:"status_code,omitempty"`
+	Error         string     `json:"error,omitempty"`
+	CreatedAt     time.Time  `json:"created_at"`
+	LastAttemptAt *time.Time `json:"last_attempt_at,omitempty"`
+	NextAttemptAt *time.Time `json:"next_attempt_at,omitempty"`
+	payload       []byte
+}
+
+// webhookPayload is the JSON body POSTed to receivers.
+type webhookPayload struct {
+	DeliveryID uint64 `json:"delivery_id"`
+	gameEvent
+}
+
+// webhookStore caches webhooks in memory and writes through to the
+// webhooks table when the DB is enabled. The delivery log is memory only
+// and keeps the most recent webhookConfig.logSize deliveries.
+type webhookStore struct {
+	mu         sync.Mutex
+	byID       map[string]*webhook
+	deliveries []*webhookDelivery // oldest first
+	nextID     uint64
+	jobs       chan uint64
+	feed       <-chan gameEvent
+}
+
+var webhooks = &webhookStore{byID: map[string]*webhook{}, nextID: 1, jobs: make(chan uint64, 256)}
+
+// webhookConfig is read once at startup by initWebhooks.
+var webhookConfig struct {
+	maxAttempts int
+	retryBase   time.Duration
+	logSize     int
+	workers     int
+	feedSize    int
+	client      *http.Client
+}
+
+func initWebhooks() {
+	webhookConfig.maxAttempts = envInt("KOTT_WEBHOOK_MAX_ATTEMPTS", 5)
+	webhookConfig.retryBase = envDuration("KOTT_WEBHOOK_RETRY_BASE", 2*time.Second)
+	webhookConfig.logSize = envInt("KOTT_WEBHOOK_LOG_SIZE", 500)
+	webhookConfig.workers = envInt("KOTT_WEBHOOK_WORKERS", 4)
+	webhookConfig.feedSize = envInt("KOTT_WEBHOOK_FEED_SIZE", 1024)
+	webhookConfig.client = &http.Client{Timeout: envDuration("KOTT_WEBHOOK_TIMEOUT", 5*time.Second)}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+	if err := webhooks.load(ctx); err != nil {
+		log.Printf("[webhook] loading webhooks failed: %v", err)
+	}
+	// Subscribe now so no event published before runWebhooks starts is missed
+	webhooks.feed, _ = events.SubscribeBuffered("", webhookConfig.feedSize, webhooks.dropped)
+}
+
+// load reads existing webhooks from the DB.
+func (s *webhookStore) load(ctx context.Context) error {
+	if db == nil {
+		return nil
+	}
+	rows, err := db.sql.QueryContext(ctx, "SELECT id, url, events, secret, label, created_at FROM webhooks")
+	if err != nil {
+		return err
+	}
+	defer rows.Close()
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for rows.Next() {
+		h := webhook{Events: []string{}}
+		var evs string
+		if err := rows.Scan(&h.ID, &h.URL, &evs, &h.secret, &h.Label, &h.CreatedAt); err != nil {
+			return err
+		}
+		if evs != "" {
+			h.Events = strings.Split(evs, ",")
+		}
+		s.byID[h.ID] = &h
+	}
+	return rows.Err()
+}
+
+// Add registers a webhook, generating its ID (and secret when empty).
+func (s *webhookStore) Add(ctx context.Context, h webhook, secret string) (*webhook, string, error) {
+	if secret == "" {
+		secret = randomHex(32)
+	}
+	h.ID = randomHex(8)
+	h.CreatedAt = time.Now().UTC()
+	h.secret = secret
+	if db != nil {
+		if _, err := db.sql.ExecContext(ctx,
+			"INSERT INTO webhooks (id, url, events, secret, label, created_at) VALUES (?,?,?,?,?,?)",
+			h.ID, h.URL, strings.Join(h.Events, ","), h.secret, h.Label, h.CreatedAt); err != nil {
+			return nil, "", err
+		}
+	}
+	s.mu.Lock()
+	s.byID[h.ID] = &h
+	s.mu.Unlock()
+	return &h, secret, nil
+}
+
+// Remove deletes a webhook. Returns false if unknown. Pending retries to it
+// are abandoned.
+func (s *webhookStore) Remove(ctx context.Context, id string) (bool, error) {
+	s.mu.Lock()
+	_, ok := s.byID[id]
+	s.mu.Unlock()
+	if !ok {
+		return false, nil
+	}
+	if db != nil {
+		if _, err := db.sql.ExecContext(ctx, "DELETE FROM webhooks WHERE id = ?", id); err != nil {
+			return true, err
+		}
+	}
+	s.mu.Lock()
+	delete(s.byID, id)
+	s.mu.Unlock()
+	return true, nil
+}
+
+// List returns all webhooks, newest first.
+func (s *webhookStore) List() []webhook {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	out := make([]webhook, 0, len(s.byID))
+	for _, h := range s.byID {
+		out = append(out, *h)
+	}
+	sort.Slice(out, func(i, j int) bool { return out[i].CreatedAt.After(out[j].CreatedAt) })
+	return out
+}
+
+func (s *webhookStore) Get(id string) (webhook, bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	h, ok := s.byID[id]
+	if !ok {
+		return webhook{}, false
+	}
+	return *h, true
+}
+
+// Deliveries returns the logged deliveries to a webhook, newest first.
+func (s *webhookStore) Deliveries(webhookID string) []webhookDelivery {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	out := []webhookDelivery{}
+	for i := len(s.deliveries) - 1; i >= 0; i-- {
+		if d := s.deliveries[i]; d.WebhookID == webhookID {
+			out = append(out, *d)
+		}
+	}
+	return out
+}
+
+// dispatch logs a delivery of ev to every webhook that wants it and queues
+// the first attempts.
+func (s *webhookStore) dispatch(ev gameEvent) {
+	s.mu.Lock()
+	var ids []uint64
+	for _, h := range s.byID {
+		if h.wants(ev.Type) {
+			ids = append(ids, s.newDeliveryLocked(h.ID, ev).ID)
+		}
+	}
+	s.mu.Unlock()
+	for _, id := range ids {
+		s.queue(id)
+	}
+}
+
+// dropped records ev as a failed delivery to every webhook that wants it,
+// for events the feed had no room for.
+func (s *webhookStore) dropped(ev gameEvent) {
+	s.mu.Lock()
+	n := 0
+	for _, h := range s.byID {
+		if h.wants(ev.Type) {
+			d := s.newDeliveryLocked(h.ID, ev)
+			d.Status, d.Error = deliveryFailed, "event feed full"
+			n++
+		}
+	}
+	s.mu.Unlock()
+	if n > 0 {
+		log.Printf("[webhook] %s event for game %s dropped for %d webhook(s): event feed full", ev.Type, ev.GameID, n)
+	}
+}
+
+// ping sends a "ping" event to one webhook regardless of its event filter.
+func (s *webhookStore) ping(webhookID string) (webhookDelivery, bool) {
+	s.mu.Lock()
+	if _, ok := s.byID[webhookID]; !ok {
+		s.mu.Unlock()
+		return webhookDelivery{}, false
+	}
+	d := s.newDeliveryLocked(webhookID, gameEvent{Type: "ping", At: time.Now()})
+	out := *d
+	s.mu.Unlock()
+	s.queue(d.ID)
+	return out, true
+}
+
+func (s *webhookStore) newDeliveryLocked(webhookID string, ev gameEvent) *webhookDelivery {
+	d := &webhookDelivery{
+		ID:        s.nextID,
+		WebhookID: webhookID,
+		Event:     ev.Type,
+		GameID:    ev.GameID,
+		Status:    deliveryPending,
+		CreatedAt: time.Now().UTC(),
+	}
+	s.nextID++
+	d.payload, _ = json.Marshal(webhookPayload{DeliveryID: d.ID, gameEvent: ev})
+	s.deliveries = append(s.deliveries, d)
+	if over := len(s.deliveries) - webhookConfig.logSize; over > 0 {
+		s.deliveries = append([]*webhookDelivery(nil), s.deliveries[over:]...)
+	}
+	return d
+}
+
+// queue hands a delivery to the workers; when they are saturated the
+// delivery fails rather than blocking the event stream.
+func (s *webhookStore) queue(id uint64) {
+	select {
+	case s.jobs <- id:
+	default:
+		s.mu.Lock()
+		if d := s.findLocked(id); d != nil {
+			d.Status, d.Error, d.NextAttemptAt = deliveryFailed, "delivery queue full", nil
+		}
+		s.mu.Unlock()
+		log.Printf("[webhook] delivery %d dropped: queue full", id)
+	}
+}
+
+func (s *webhookStore) findLocked(id uint64) *webhookDelivery {
+	// IDs are increasing, so the log is sorted by ID
+	i := sort.Search(len(s.deliveries), func(i int) bool { return s.deliveries[i].ID >= id })
+	if i < len(s.deliveries) && s.deliveries[i].ID == id {
+		return s.deliveries[i]
+	}
+	return nil
+}
+
+// runWebhooks turns published events into deliveries and sends them until
+// ctx is done. Retries still waiting at shutdown are dropped.
+func runWebhooks(ctx context.Context) {
+	for i := 0; i < webhookConfig.workers; i++ {
+		go func() {
+			for {
+				select {
+				case <-ctx.Done():
+					return
+				case id := <-webhooks.jobs:
+					webhooks.attempt(ctx, id)
+				}
+			}
+		}()
+	}
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case ev, ok := <-webhooks.feed:
+			if !ok {
+				return
+			}
+			webhooks.dispatch(ev)
+		}
+	}
+}
+
+// attempt POSTs a delivery once and schedules a retry on failure:
+// connection errors, 429 and 5xx responses are retried with exponential
+// backoff, other responses fail the delivery.
+func (s *webhookStore) attempt(ctx context.Context, id uint64) {
+	s.mu.Lock()
+	d := s.findLocked(id)
+	if d == nil {
+		// Rotated out of the log
+		s.mu.Unlock()
+		return
+	}
+	h, ok := s.byID[d.WebhookID]
+	if !ok {
+		d.Status, d.Error, d.NextAttemptAt = deliveryFailed, "webhook deleted", nil
+		s.mu.Unlock()
+		return
+	}
+	url, secret, payload, event := h.URL, h.secret, d.payload, d.Event
+	d.Attempts++
+	attempts := d.Attempts
+	s.mu.Unlock()
+
+	code, err := sendWebhook(ctx, url, secret, id, event, payload)
+	retry := err != nil || code == http.StatusTooManyRequests || code >= 500
+	now := time.Now().UTC()
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	d.StatusCode, d.LastAttemptAt, d.NextAttemptAt, d.Error = code, &now, nil, ""
+	switch {
+	case err == nil && code >= 200 && code < 300:
+		d.Status = deliveryDelivered
+		return
+	case err != nil:
+		d.Error = err.Error()
+	default:
+		d.Error = "receiver responded " + strconv.Itoa(code)
+	}
+	if !retry || attempts >= webhookConfig.maxAttempts || ctx.Err() != nil {
+		d.Status = deliveryFailed
+		log.Printf("[webhook] delivery %d to %s failed after %d attempt(s): %s", id, url, attempts, d.Error)
+		return
+	}
+	wait := webhookConfig.retryBase << (attempts - 1)
+	next := now.Add(wait)
+	d.NextAttemptAt = &next
+	time.AfterFunc(wait, func() { s.queue(id) })
+}
+
+// sendWebhook sends one signed request. X-Kott-Timestamp is the send time
+// in Unix seconds and X-Kott-Signature is "sha256=" + hex HMAC-SHA256 of
+// "<timestamp>.<body>" keyed with the webhook secret, so receivers can
+// reject replayed requests.
+func sendWebhook(ctx context.Context, url, secret string, id uint64, event string, body []byte) (int, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, url, bytes.NewReader(body))
+	if err != nil {
+		return 0, err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("User-Agent", "kingofthetable-webhook")
+	req.Header.Set("X-Kott-Event", event)
+	req.Header.Set("X-Kott-Delivery", strconv.FormatUint(id, 10))
+	ts := strconv.FormatInt(time.Now().Unix(), 10)
+	req.Header.Set("X-Kott-Timestamp", ts)
+	req.Header.Set("X-Kott-Signature", signWebhook(secret, ts, body))
+	resp, err := webhookConfig.client.Do(req)
+	if err != nil {
+		return 0, err
+	}
+	defer resp.Body.Close()
+	_, _ = io.Copy(io.Discard, io.LimitReader(resp.Body, 64<<10))
+	return resp.StatusCode, nil
+}
+
+func signWebhook(secret, timestamp string, body []byte) string {
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write([]byte(timestamp + "."))
+	mac.Write(body)
+	return "sha256=" + hex.EncodeToString(mac.Sum(nil))
+}
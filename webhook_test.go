@@ -0,0 +1,197 @@
+package main
+
+import (
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"sync"
+	"testing"
+	"time"
+)
+
+// webhookReceiver records the requests it gets and answers with the
+// scripted status codes (200 once they run out).
+type webhookReceiver struct {
+	mu       sync.Mutex
+	statuses []int
+	got      []receivedWebhook
+}
+
+type receivedWebhook struct {
+	header http.Header
+	body   []byte
+	at     time.Time
+}
+
+func (rc *webhookReceiver) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	body, _ := io.ReadAll(r.Body)
+	rc.mu.Lock()
+	defer rc.mu.Unlock()
+	rc.got = append(rc.got, receivedWebhook{r.Header.Clone(), body, time.Now()})
+	status := http.StatusOK
+	if len(rc.statuses) > 0 {
+		status, rc.statuses = rc.statuses[0], rc.statuses[1:]
+	}
+	w.WriteHeader(status)
+}
+
+func (rc *webhookReceiver) requests() []receivedWebhook {
+	rc.mu.Lock()
+	defer rc.mu.Unlock()
+	return append([]receivedWebhook(nil), rc.got...)
+}
+
+// newTestWebhooks returns a store with one webhook pointing at rc, and
+// starts a sender that works off its jobs until the test ends.
+func newTestWebhooks(t *testing.T, rc *webhookReceiver, secret string) *webhookStore {
+	t.Helper()
+	srv := httptest.NewServer(rc)
+	t.Cleanup(srv.Close)
+	webhookConfig.maxAttempts = 3
+	webhookConfig.retryBase = 20 * time.Millisecond
+	webhookConfig.logSize = 100
+	webhookConfig.client = srv.Client()
+
+	s := &webhookStore{byID: map[string]*webhook{}, nextID: 1, jobs: make(chan uint64, 16)}
+	s.byID["h1"] = &webhook{ID: "h1", URL: srv.URL, secret: secret}
+	ctx, cancel := context.WithCancel(context.Background())
+	t.Cleanup(cancel)
+	go func() {
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case id := <-s.jobs:
+				s.attempt(ctx, id)
+			}
+		}
+	}()
+	return s
+}
+
+// waitDelivery waits until the delivery is no longer pending.
+func waitDelivery(t *testing.T, s *webhookStore) webhookDelivery {
+	t.Helper()
+	deadline := time.Now().Add(5 * time.Second)
+	for {
+		ds := s.Deliveries("h1")
+		if len(ds) == 1 && ds[0].Status != deliveryPending {
+			return ds[0]
+		}
+		if time.Now().After(deadline) {
+			t.Fatalf("delivery still pending: %+v", ds)
+		}
+		time.Sleep(5 * time.Millisecond)
+	}
+}
+
+func TestWebhookDeliverySigned(t *testing.T) {
+	rc := &webhookReceiver{}
+	s := newTestWebhooks(t, rc, "s3cret")
+	s.dispatch(gameEvent{Type: "goal", GameID: "g1", At: time.Now()})
+	d := waitDelivery(t, s)
+	if d.Status != deliveryDelivered || d.Attempts != 1 || d.StatusCode != http.StatusOK {
+		t.Fatalf("delivery = %+v", d)
+	}
+
+	reqs := rc.requests()
+	if len(reqs) != 1 {
+		t.Fatalf("%d requests, want 1", len(reqs))
+	}
+	h, body := reqs[0].header, reqs[0].body
+	if h.Get("X-Kott-Event") != "goal" || h.Get("X-Kott-Delivery") != strconv.FormatUint(d.ID, 10) {
+		t.Errorf("event %q, delivery %q", h.Get("X-Kott-Event"), h.Get("X-Kott-Delivery"))
+	}
+	ts, err := strconv.ParseInt(h.Get("X-Kott-Timestamp"), 10, 64)
+	if err != nil || time.Since(time.Unix(ts, 0)) > time.Minute {
+		t.Errorf("timestamp %q", h.Get("X-Kott-Timestamp"))
+	}
+	mac := hmac.New(sha256.New, []byte("s3cret"))
+	mac.Write([]byte(h.Get("X-Kott-Timestamp") + "." + string(body)))
+	if want := "sha256=" + hex.EncodeToString(mac.Sum(nil)); h.Get("X-Kott-Signature") != want {
+		t.Errorf("signature %q, want %q", h.Get("X-Kott-Signature"), want)
+	}
+	var payload webhookPayload
+	if err := json.Unmarshal(body, &payload); err != nil || payload.DeliveryID != d.ID || payload.GameID != "g1" {
+		t.Errorf("payload %s: %v", body, err)
+	}
+}
+
+func TestWebhookRetriesServerErrors(t *testing.T) {
+	rc := &webhookReceiver{statuses: []int{http.StatusBadGateway, http.StatusServiceUnavailable}}
+	s := newTestWebhooks(t, rc, "s3cret")
+	s.dispatch(gameEvent{Type: "goal", GameID: "g1"})
+	d := waitDelivery(t, s)
+	if d.Status != deliveryDelivered || d.Attempts != 3 || d.Error != "" || d.NextAttemptAt != nil {
+		t.Fatalf("delivery = %+v", d)
+	}
+	reqs := rc.requests()
+	if len(reqs) != 3 {
+		t.Fatalf("%d requests, want 3", len(reqs))
+	}
+	// The wait doubles after each failure
+	if gap := reqs[1].at.Sub(reqs[0].at); gap < webhookConfig.retryBase {
+		t.Errorf("first retry after %v, want at least %v", gap, webhookConfig.retryBase)
+	}
+	if gap := reqs[2].at.Sub(reqs[1].at); gap < 2*webhookConfig.retryBase {
+		t.Errorf("second retry after %v, want at least %v", gap, 2*webhookConfig.retryBase)
+	}
+	if reqs[0].header.Get("X-Kott-Delivery") != reqs[2].header.Get("X-Kott-Delivery") {
+		t.Error("retries carry a different delivery ID")
+	}
+}
+
+func TestWebhookDeliveryFails(t *testing.T) {
+	tests := []struct {
+		name     string
+		statuses []int
+		attempts int
+		error    string
+	}{
+		{"client error is not retried", []int{http.StatusBadRequest}, 1, "receiver responded 400"},
+		{"gives up after max attempts", []int{500, 500, 500, 500}, 3, "receiver responded 500"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			rc := &webhookReceiver{statuses: tt.statuses}
+			s := newTestWebhooks(t, rc, "s3cret")
+			s.dispatch(gameEvent{Type: "goal", GameID: "g1"})
+			d := waitDelivery(t, s)
+			if d.Status != deliveryFailed || d.Attempts != tt.attempts || d.Error != tt.error || d.LastAttemptAt == nil {
+				t.Errorf("delivery = %+v", d)
+			}
+			if n := len(rc.requests()); n != tt.attempts {
+				t.Errorf("%d requests, want %d", n, tt.attempts)
+			}
+		})
+	}
+}
+
+func TestWebhookFeedDropsAreRecorded(t *testing.T) {
+	webhookConfig.logSize = 100
+	s := &webhookStore{byID: map[string]*webhook{}, nextID: 1, jobs: make(chan uint64, 16)}
+	s.byID["h1"] = &webhook{ID: "h1", URL: "http://receiver.invalid"}
+	s.byID["h2"] = &webhook{ID: "h2", URL: "http://receiver.invalid", Events: []string{"rotation"}}
+	bus := &eventBus{subs: map[chan gameEvent]subscription{}}
+	feed, cancel := bus.SubscribeBuffered("", 1, s.dropped)
+	defer cancel()
+
+	bus.Publish(gameEvent{Type: "goal", GameID: "g1"})
+	bus.Publish(gameEvent{Type: "goal", GameID: "g2"})
+	if ev := <-feed; ev.GameID != "g1" {
+		t.Errorf("feed got %+v, want the first event", ev)
+	}
+	ds := s.Deliveries("h1")
+	if len(ds) != 1 || ds[0].Status != deliveryFailed || ds[0].Error != "event feed full" || ds[0].GameID != "g2" {
+		t.Errorf("h1 deliveries = %+v", ds)
+	}
+	if ds := s.Deliveries("h2"); len(ds) != 0 {
+		t.Errorf("h2 does not want goals, got %+v", ds)
+	}
+}